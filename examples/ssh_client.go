@@ -234,6 +234,7 @@ func main() {
 	trzszFilter.SetDefaultDownloadPath("~/Downloads") // automatically save to the path for tsz downloading
 	trzszFilter.SetDragFileUploadCommand("trz -y")    // overwrite existing files when dragging to upload
 	trzszFilter.SetProgressColorPair("B14FFF 00FFA3") // progress bar gradient from the first color to the second color
+	trzszFilter.SetPreserveSymlinks(true)             // transfer symlinks in directories as links instead of following them
 
 	// recommended: setup tunnel connect
 	trzszFilter.SetTunnelConnector(func(port int) net.Conn {
@@ -245,6 +246,10 @@ func main() {
 		// call TrzszFilter to upload some files and directories as you want
 		// trzszFilter.UploadFiles([]string{"/path/to/file", "/path/to/directory"})
 
+		// or answer the next `tsz` / `trz -d` on the server without any dialog
+		// results, err := trzszFilter.Download(ctx, "/path/to/save", trzsz.TransferOptions{Overwrite: true})
+		// results, err := trzszFilter.Upload(ctx, []string{"/path/to/directory"}, trzsz.TransferOptions{Directory: true})
+
 		// tell TrzszFilter to stop transferring files if necessary
 		// trzszFilter.StopTransferringFiles()
 	}()
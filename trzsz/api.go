@@ -0,0 +1,255 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"context"
+	"time"
+)
+
+// TransferOptions specify the options of a programmatic transfer by Download or Upload.
+type TransferOptions struct {
+	// Overwrite the existing local files while downloading, same as `tsz -y`.
+	// Whether to overwrite the remote files while uploading is decided by `trz -y`.
+	Overwrite bool
+	// Directory allows uploading directories, the server should be running `trz -d`.
+	Directory bool
+	// Progress is called while transferring, nil means no progress.
+	Progress func(progress TransferProgress)
+}
+
+// TransferProgress is the progress of the current file.
+type TransferProgress struct {
+	FileCount int64
+	FileIndex int64
+	FileName  string
+	FileSize  int64 // -1 if the size is unknown, e.g. a stream sent by `tsz -`
+	FileStep  int64
+	Retry     int   // the retry count after a recoverable failure
+	TotalSize int64 // the sum of the file sizes, -1 if unknown, 0 for an old server
+	TotalStep int64
+}
+
+// TransferResult is the result of a file transferred by Download or Upload.
+type TransferResult struct {
+	// Name is the relative path of the source file.
+	Name string
+	// SavedName is the name saved by the receiver, may be renamed to avoid overwriting.
+	SavedName string
+	Size      int64
+	Hash      string
+	Directory bool
+	Symlink   bool
+	Skipped   bool
+	Resumed   bool
+}
+
+type transferRequest struct {
+	upload   bool
+	destPath string
+	paths    []string
+	options  TransferOptions
+	response chan transferResponse
+}
+
+type transferResponse struct {
+	results []TransferResult
+	err     error
+}
+
+// Download answers a pending or the next `tsz` on the server, saving the files to destDir without any dialog.
+//
+// Returns the results after the transfer is done, or ctx is done.
+func (filter *TrzszFilter) Download(ctx context.Context, destDir string, options TransferOptions) ([]TransferResult, error) {
+	if err := checkPathWritable(destDir); err != nil {
+		return nil, err
+	}
+	return filter.requestTransfer(ctx, &transferRequest{destPath: destDir, options: options})
+}
+
+// Upload answers a pending or the next `trz` on the server, sending the paths without any dialog.
+//
+// Returns the results after the transfer is done, or ctx is done.
+func (filter *TrzszFilter) Upload(ctx context.Context, paths []string, options TransferOptions) ([]TransferResult, error) {
+	if len(paths) == 0 {
+		return nil, simpleTrzszError("Nothing to upload")
+	}
+	if _, err := checkPathsReadable(paths, options.Directory, filter.isPreserveSymlinks(), filter.getPathFilter()); err != nil {
+		return nil, err
+	}
+	return filter.requestTransfer(ctx, &transferRequest{upload: true, paths: paths, options: options})
+}
+
+func (filter *TrzszFilter) requestTransfer(ctx context.Context, req *transferRequest) ([]TransferResult, error) {
+	req.response = make(chan transferResponse, 1)
+	select {
+	case filter.transferRequests <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case resp := <-req.response:
+		return resp.results, resp.err
+	case <-ctx.Done():
+		filter.StopTransferringFiles(false)
+		<-req.response
+		return nil, ctx.Err()
+	}
+}
+
+// acceptTransferRequest returns the request of Download or Upload if any.
+// If ManualTransfer is set, waits for the request until the transfer is stopped.
+func (filter *TrzszFilter) acceptTransferRequest(transfer *trzszTransfer) (*transferRequest, error) {
+	select {
+	case req := <-filter.transferRequests:
+		return req, nil
+	default:
+	}
+	if !filter.options.ManualTransfer {
+		return nil, nil
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case req := <-filter.transferRequests:
+			return req, nil
+		case <-ticker.C:
+			if transfer.stopped.Load() || filter.closed.Load() {
+				return nil, errUserCanceled
+			}
+		}
+	}
+}
+
+func (req *transferRequest) checkMode(mode byte) error {
+	switch {
+	case mode == 'S' && req.upload:
+		return simpleTrzszError("The server is sending files, not receiving")
+	case mode != 'S' && !req.upload:
+		return simpleTrzszError("The server is receiving files, not sending")
+	case mode == 'R' && req.options.Directory:
+		return simpleTrzszError("The server is not receiving directories, use `trz -d` instead")
+	}
+	return nil
+}
+
+func (req *transferRequest) getProgress() progressCallback {
+	if req.options.Progress == nil {
+		return nil
+	}
+	return &requestProgress{callback: req.options.Progress}
+}
+
+func (req *transferRequest) finish(transfer *trzszTransfer, err error) {
+	var results []TransferResult
+	if transfer != nil && transfer.report != nil {
+		for _, file := range transfer.report.Files {
+			results = append(results, TransferResult{
+				Name:      file.Name,
+				SavedName: file.SavedName,
+				Size:      file.Size,
+				Hash:      file.Hash,
+				Directory: file.Directory,
+				Symlink:   file.Symlink,
+				Skipped:   file.Skipped,
+				Resumed:   file.Resumed,
+			})
+		}
+	}
+	req.response <- transferResponse{results, err}
+}
+
+type requestProgress struct {
+	callback func(progress TransferProgress)
+	progress TransferProgress
+	doneSize int64
+}
+
+func (p *requestProgress) onNum(num int64) {
+	if p.progress.Retry > 0 { // only the remaining files are sent again
+		p.progress.FileIndex = p.progress.FileCount - num
+		return
+	}
+	p.progress.FileCount = num
+}
+
+func (p *requestProgress) onTotal(total int64) {
+	if p.progress.Retry > 0 { // only the remaining files are sent again
+		if p.progress.TotalSize > 0 && total >= 0 {
+			p.doneSize = max(p.progress.TotalSize-total, 0)
+		}
+		return
+	}
+	p.progress.TotalSize = total
+}
+
+func (p *requestProgress) onName(name string) {
+	p.progress.FileIndex++
+	p.progress.FileName = name
+	p.progress.FileSize = 0
+	p.setFileStep(0)
+	p.callback(p.progress)
+}
+
+func (p *requestProgress) onSize(size int64) {
+	p.progress.FileSize = size
+	p.callback(p.progress)
+}
+
+func (p *requestProgress) onStep(step int64) {
+	p.setFileStep(step)
+	p.callback(p.progress)
+}
+
+func (p *requestProgress) onDone() {
+	p.setFileStep(p.progress.FileSize)
+	p.callback(p.progress)
+	p.doneSize += max(p.progress.FileSize, 0)
+}
+
+func (p *requestProgress) onSkip(size int64) {
+	p.doneSize += max(size, 0)
+	p.setFileStep(p.progress.FileStep)
+	p.callback(p.progress)
+}
+
+func (p *requestProgress) setPreSize(size int64) {
+	p.setFileStep(size)
+}
+
+func (p *requestProgress) setFileStep(step int64) {
+	p.progress.FileStep = step
+	if p.progress.TotalSize > 0 {
+		p.progress.TotalStep = min(p.doneSize+step, p.progress.TotalSize)
+	}
+}
+
+func (p *requestProgress) setPause(pausing bool) {
+}
+
+func (p *requestProgress) setRetry(retry, limit int) {
+	p.progress.Retry = retry
+}
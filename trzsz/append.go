@@ -26,11 +26,11 @@ package trzsz
 
 import (
 	"context"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 )
@@ -93,7 +93,7 @@ func (t *trzszTransfer) pipelineSendHash(ctx context.Context, cancel context.Can
 	var wg sync.WaitGroup
 	wg.Go(func() {
 		step := int64(0)
-		hasher := md5.New()
+		hasher := t.newHasher()
 		buffer := make([]byte, kPrefixHashStep)
 		for step < size && ctx.Err() == nil && !stopNow.Load() {
 			buf := buffer
@@ -164,6 +164,9 @@ func (t *trzszTransfer) sendPrefixHash(file *os.File, srcFile *sourceFile, tgtFi
 	if tgtFile.Size <= 0 || file == nil {
 		return srcFile.Size, nil
 	}
+	if tgtFile.Resume {
+		return t.sendResumeOffset(file, srcFile, tgtFile, progress)
+	}
 
 	if progress != nil {
 		progress.onSize(srcFile.Size)
@@ -205,6 +208,7 @@ func (t *trzszTransfer) sendPrefixHash(file *os.File, srcFile *sourceFile, tgtFi
 }
 
 func (t *trzszTransfer) sendFileNameV3(srcFile *sourceFile, progress progressCallback) (fileReader, string, error) {
+	t.resumeHashState = nil
 	source, err := srcFile.marshalSourceFile()
 	if err != nil {
 		return nil, "", err
@@ -225,8 +229,24 @@ func (t *trzszTransfer) sendFileNameV3(srcFile *sourceFile, progress progressCal
 	if progress != nil {
 		progress.onName(srcFile.getFileName())
 	}
+	t.reportFileName(srcFile, tgtFile.Name, tgtFile.Skip)
+
+	if tgtFile.Skip {
+		t.skippedFiles = append(t.skippedFiles, filepath.Join(srcFile.RelPath...))
+		if progress != nil {
+			progress.onSkip(getTotalSize([]*sourceFile{srcFile}))
+		}
+		return nil, "", nil
+	}
+
+	if t.transferConfig.Sync && isSyncTopDir(srcFile) {
+		if err := t.sendSyncReply(srcFile, progress); err != nil {
+			return nil, "", err
+		}
+	}
 
-	if len(srcFile.SubFiles) > 0 {
+	// the receiver expects an archive even if all the sub files are unchanged
+	if srcFile.Archive {
 		file, err := t.newArchiveReader(srcFile)
 		if err != nil {
 			return nil, "", err
@@ -234,15 +254,28 @@ func (t *trzszTransfer) sendFileNameV3(srcFile *sourceFile, progress progressCal
 		return file, tgtFile.Name, nil
 	}
 
-	if srcFile.IsDir {
+	if srcFile.IsDir || srcFile.isSymlink() {
 		return nil, tgtFile.Name, nil
 	}
 
+	if srcFile.Stream {
+		return &streamFileReader{reader: t.streamInput}, tgtFile.Name, nil
+	}
+
 	file, err := os.Open(srcFile.AbsPath)
 	if err != nil {
 		return nil, "", err
 	}
 
+	if tgtFile.Delta > 0 {
+		reader, err := t.newDeltaFileReader(file, tgtFile.Delta)
+		if err != nil {
+			_ = file.Close()
+			return nil, "", err
+		}
+		return reader, tgtFile.Name, nil
+	}
+
 	size, err := t.sendPrefixHash(file, srcFile, tgtFile, progress)
 	if err != nil {
 		_ = file.Close()
@@ -252,19 +285,31 @@ func (t *trzszTransfer) sendFileNameV3(srcFile *sourceFile, progress progressCal
 	return &simpleFileReader{file, size}, tgtFile.Name, nil
 }
 
-func (t *trzszTransfer) recvPrefixHash(writer fileWriter, srcFile *sourceFile, tgtFile *targetFile,
-	progress progressCallback) error {
+// recvPrefixHash checks the prefix of the partial file, or of the existing target if it's not nil,
+// and the matched prefix of the target is copied to the partial file.
+func (t *trzszTransfer) recvPrefixHash(writer fileWriter, target *os.File, srcFile *sourceFile, tgtFile *targetFile,
+	progress progressCallback) (int64, []byte, error) {
 	if tgtFile.Size <= 0 || writer == nil || writer.getFile() == nil {
-		return nil
+		return 0, nil, nil
 	}
 	file := writer.getFile()
+	var existing io.Reader = file
+	if target != nil {
+		existing = target
+	}
+	if tgtFile.Resume {
+		if err := t.recvResumeOffset(file, srcFile, tgtFile, progress); err != nil {
+			return 0, nil, err
+		}
+		return tgtFile.Size, tgtFile.State, nil
+	}
 
 	var size int64
 	if t.transferConfig.Protocol < kProtocolVersion4 {
 		var err error
 		size, err = t.recvInteger("SIZE", false, t.getNewTimeout())
 		if err != nil {
-			return err
+			return 0, nil, err
 		}
 	} else {
 		size = srcFile.Size
@@ -274,12 +319,13 @@ func (t *trzszTransfer) recvPrefixHash(writer fileWriter, srcFile *sourceFile, t
 	}
 
 	match := true
-	hasher := md5.New()
+	hasher := t.newHasher()
 	matchStep := int64(0)
+	var matchState []byte
 	for {
 		hash, err := t.recvHash()
 		if err != nil {
-			return err
+			return 0, nil, err
 		}
 		if hash.Over {
 			break
@@ -290,21 +336,29 @@ func (t *trzszTransfer) recvPrefixHash(writer fileWriter, srcFile *sourceFile, t
 
 		step := hash.Step - matchStep
 		buffer := make([]byte, step)
-		n, err := io.ReadFull(file, buffer)
+		n, err := io.ReadFull(existing, buffer)
 		if err != nil {
-			return err
+			return 0, nil, err
 		}
 		hasher.Write(buffer[:n])
 
 		match = hash.Hash == fmt.Sprintf("%x", hasher.Sum(nil))
+		if match && target != nil {
+			if _, err := file.Write(buffer[:n]); err != nil {
+				return 0, nil, err
+			}
+		}
 		if match {
 			matchStep = hash.Step
+			if matchState, err = marshalHasher(hasher); err != nil {
+				return 0, nil, err
+			}
 			if progress != nil {
 				progress.onStep(matchStep)
 			}
 		}
 		if err := t.sendHashAck(&prefixHashAck{Step: hash.Step, Match: match}); err != nil {
-			return err
+			return 0, nil, err
 		}
 	}
 
@@ -312,12 +366,41 @@ func (t *trzszTransfer) recvPrefixHash(writer fileWriter, srcFile *sourceFile, t
 		progress.setPreSize(matchStep)
 	}
 	if _, err := file.Seek(matchStep, io.SeekStart); err != nil {
-		return err
+		return 0, nil, err
 	}
 	if err := file.Truncate(matchStep); err != nil {
-		return err
+		return 0, nil, err
 	}
-	return nil
+	return matchStep, matchState, nil
+}
+
+// openAppendTarget opens the existing target to be appended by prefix hash. It is hashed in place,
+// and only the matched prefix is copied to the empty partial file.
+func (t *trzszTransfer) openAppendTarget(destPath string, srcFile *sourceFile, writer fileWriter) (*os.File, int64) {
+	if srcFile.Stream || srcFile.Archive || srcFile.IsDir || srcFile.isSymlink() {
+		return nil, 0
+	}
+	targetPath := t.getTargetPath(writer)
+	if targetPath == "" {
+		return nil, 0
+	}
+	// a symlink is replaced instead of being followed
+	if stat, err := os.Lstat(targetPath); err != nil || !stat.Mode().IsRegular() {
+		return nil, 0
+	}
+	if err := checkPathInside(destPath, targetPath); err != nil {
+		return nil, 0
+	}
+	target, err := os.Open(targetPath)
+	if err != nil {
+		return nil, 0
+	}
+	stat, err := target.Stat()
+	if err != nil || !stat.Mode().IsRegular() || stat.Size() == 0 {
+		_ = target.Close()
+		return nil, 0
+	}
+	return target, stat.Size()
 }
 
 func (t *trzszTransfer) recvFileNameV3(path string, progress progressCallback) (fileWriter, string, error) {
@@ -329,47 +412,129 @@ func (t *trzszTransfer) recvFileNameV3(path string, progress progressCallback) (
 	if err != nil {
 		return nil, "", err
 	}
-	file, localName, err := t.createDirOrFile(path, srcFile, false)
-	if err != nil {
+	t.resumeTracker = nil
+	t.resumeHashState = nil
+	var file fileWriter
+	var localName string
+	if t.streamOutput != nil {
+		file, localName = &streamFileWriter{t.streamOutput}, srcFile.getFileName()
+	} else {
+		// a stream can be neither appended nor resumed
+		file, localName, err = t.createDirOrFile(path, srcFile, srcFile.Stream)
+	}
+	skip := err == errFileSkipped
+	if err != nil && !skip {
 		return nil, "", err
 	}
 
 	size := int64(0)
-	if file != nil && file.getFile() != nil {
+	tracking := false
+	if file != nil && file.getFile() != nil && !srcFile.Stream {
 		stat, err := file.getFile().Stat()
 		if err != nil {
 			_ = file.Close()
 			return nil, "", err
 		}
 		size = stat.Size()
+		tracking = t.transferConfig.Protocol >= kProtocolVersion7 && srcFile.ModTime != nil
 	}
 
-	tgtFile := &targetFile{Name: localName, Size: size}
-	target, err := tgtFile.marshalTargetFile()
-	if err != nil {
+	tgtFile := &targetFile{Name: localName, Size: size, Skip: skip}
+	if tracking {
+		if state := t.loadResumeState(file.getFile().Name(), srcFile, size); state != nil {
+			tgtFile.Size = state.Offset
+			tgtFile.Resume = true
+			tgtFile.State = state.State
+		}
+	}
+
+	// nothing to append or resume, but the existing file can be the basis of a delta transfer
+	var basis *os.File
+	if tgtFile.Size == 0 && !skip {
+		if basis = t.openDeltaBasis(srcFile, file); basis != nil {
+			tgtFile.Delta = getDeltaBlockSize(basis)
+			tracking = false
+		}
+	}
+
+	// nor a delta transfer, append to the existing file as the protocol 3 does
+	var appendTarget *os.File
+	if tgtFile.Size == 0 && !skip && basis == nil && file != nil && file.getFile() != nil {
+		appendTarget, tgtFile.Size = t.openAppendTarget(path, srcFile, file)
+	}
+	closeFiles := func() {
 		if file != nil {
 			_ = file.Close()
 		}
+		if basis != nil {
+			_ = basis.Close()
+		}
+		if appendTarget != nil {
+			_ = appendTarget.Close()
+		}
+	}
+
+	target, err := tgtFile.marshalTargetFile()
+	if err != nil {
+		closeFiles()
 		return nil, "", err
 	}
 
 	if err := t.sendString("SUCC", target); err != nil {
-		if file != nil {
-			_ = file.Close()
-		}
+		closeFiles()
 		return nil, "", err
 	}
 
 	if progress != nil {
 		progress.onName(srcFile.getFileName())
 	}
+	t.reportFileName(srcFile, localName, skip)
+
+	if skip {
+		t.skippedFiles = append(t.skippedFiles, filepath.Join(srcFile.RelPath...))
+		if progress != nil {
+			progress.onSkip(getTotalSize([]*sourceFile{srcFile}))
+		}
+		return nil, "", nil
+	}
 
-	if err := t.recvPrefixHash(file, srcFile, tgtFile, progress); err != nil {
+	if t.transferConfig.Sync && isSyncTopDir(srcFile) {
+		if err := t.recvSyncReply(filepath.Join(path, localName), localName, progress); err != nil {
+			closeFiles()
+			return nil, "", err
+		}
+	}
+
+	if basis != nil {
+		if err := t.sendDeltaSignatures(basis, tgtFile.Delta); err != nil {
+			closeFiles()
+			return nil, "", err
+		}
+		writer, err := t.newDeltaFileWriter(file, basis, tgtFile.Delta)
+		if err != nil {
+			closeFiles()
+			return nil, "", err
+		}
+		return writer, localName, nil
+	}
+
+	offset, state, err := t.recvPrefixHash(file, appendTarget, srcFile, tgtFile, progress)
+	if appendTarget != nil {
+		_ = appendTarget.Close()
+	}
+	if err != nil {
 		if file != nil {
 			_ = file.Close()
 		}
 		return nil, "", err
 	}
 
+	if tracking {
+		if t.resumeTracker, err = t.newResumeTracker(file.getFile().Name(), srcFile, offset, state); err != nil {
+			_ = file.Close()
+			return nil, "", err
+		}
+	}
+
 	return file, localName, nil
 }
@@ -28,6 +28,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"sync"
 )
 
 type fileReader interface {
@@ -79,12 +80,14 @@ func (f *simpleFileWriter) getFile() *os.File {
 }
 
 func (t *trzszTransfer) archiveSourceFiles(sourceFiles []*sourceFile) []*sourceFile {
-	if t.transferConfig.Overwrite || t.transferConfig.Protocol < kProtocolVersion4 || len(sourceFiles) == 0 {
+	if (t.transferConfig.getConflictPolicy() != kConflictRename && !t.transferConfig.Sync) ||
+		t.transferConfig.Protocol < kProtocolVersion4 || len(sourceFiles) == 0 {
 		return sourceFiles
 	}
 	newSrcFiles := make([]*sourceFile, sourceFiles[len(sourceFiles)-1].PathID+1)
 	for _, srcFile := range sourceFiles {
 		if newSrcFiles[srcFile.PathID] == nil {
+			srcFile.SubFiles = nil // archived again while retrying
 			newSrcFiles[srcFile.PathID] = srcFile
 		} else {
 			newSrcFiles[srcFile.PathID].SubFiles = append(newSrcFiles[srcFile.PathID].SubFiles, srcFile)
@@ -115,7 +118,7 @@ func (f *archiveFileReader) Read(p []byte) (int, error) {
 			if f.file != nil {
 				_ = f.file.Close()
 			}
-			if f.src.IsDir {
+			if f.src.IsDir || f.src.isSymlink() {
 				f.file = nil
 			} else {
 				var err error
@@ -178,22 +181,31 @@ func (t *trzszTransfer) newArchiveReader(srcFile *sourceFile) (fileReader, error
 		}
 		file.Header = encodeString(source)
 		size += int64(len(file.Header)) + 1
-		if !file.IsDir {
+		if !file.IsDir && !file.isSymlink() {
 			size += file.Size
 		}
 	}
 	return &archiveFileReader{files: srcFile.SubFiles, size: size}, nil
 }
 
+// archiveFileWriter may be closed while the data is still being written after a failure,
+// so a late write must not create files while the transfer is retrying.
 type archiveFileWriter struct {
 	transfer *trzszTransfer
 	path     string
 	buf      []byte
 	file     fileWriter
 	left     int64
+	mutex    sync.Mutex
+	closed   bool
 }
 
 func (f *archiveFileWriter) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
 	if f.left > 0 && f.file != nil {
 		m := min(f.left, int64(len(p)))
 		n, err := f.file.Write(p[:int(m)])
@@ -218,6 +230,12 @@ func (f *archiveFileWriter) Write(p []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return 0, err
+		}
+		f.file = nil
+	}
 	file, _, err := f.transfer.createDirOrFile(f.path, srcFile, true)
 	if err != nil {
 		return 0, err
@@ -228,6 +246,12 @@ func (f *archiveFileWriter) Write(p []byte) (int, error) {
 }
 
 func (f *archiveFileWriter) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
 	if f.file != nil {
 		return f.file.Close()
 	}
@@ -245,5 +269,6 @@ func (t *trzszTransfer) newArchiveWriter(destPath string, srcFile *sourceFile, f
 	if err := t.doCreateDirectory(fullPath, srcFile.Perm); err != nil {
 		return nil, err
 	}
+	t.addDirModTime(fullPath, srcFile.ModTime)
 	return &archiveFileWriter{transfer: t, path: destPath}, nil
 }
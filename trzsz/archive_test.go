@@ -112,7 +112,7 @@ func TestArchiveReadAndWrite(t *testing.T) {
 	createFile([]string{"sub_folder", "中文", "文件2"}, strings.Repeat("file content in 文件2.\n", 100))
 	createFile([]string{"sub_folder", "中文", "file3"}, strings.Repeat("file content in file3.\n", 100))
 
-	srcFiles, err := checkPathsReadable([]string{emptyDir, subFolder, emptyFile}, true)
+	srcFiles, err := checkPathsReadable([]string{emptyDir, subFolder, emptyFile}, true, false, nil)
 	require.Nil(err)
 	assert.Equal(7, len(srcFiles))
 
@@ -130,7 +130,7 @@ func TestArchiveReadAndWrite(t *testing.T) {
 		assert.Equal(archiveFiles[1].PathID, f.PathID)
 	}
 
-	srcFiles, err = checkPathsReadable([]string{testPath}, true)
+	srcFiles, err = checkPathsReadable([]string{testPath}, true, false, nil)
 	require.Nil(err)
 	assert.Equal(8, len(srcFiles))
 	archiveFiles = transfer.archiveSourceFiles(srcFiles)
@@ -139,6 +139,9 @@ func TestArchiveReadAndWrite(t *testing.T) {
 	for _, f := range archiveFiles[0].SubFiles {
 		assert.Equal(archiveFiles[0].PathID, f.PathID)
 	}
+	archiveFiles = transfer.archiveSourceFiles(srcFiles)
+	require.Equal(1, len(archiveFiles))
+	assert.Equal(7, len(archiveFiles[0].SubFiles))
 
 	f1, err := os.OpenFile(file1, os.O_APPEND|os.O_WRONLY, 0)
 	require.Nil(err)
@@ -185,6 +188,7 @@ func TestArchiveReadAndWrite(t *testing.T) {
 		}
 		_ = reader.Close()
 		_ = writer.Close()
+		require.Nil(transfer.commitPartialFiles())
 		savePath = append(savePath, filepath.Join(os.TempDir(), name))
 	}
 
@@ -196,3 +200,33 @@ func TestArchiveReadAndWrite(t *testing.T) {
 		assertDirEqual(t, testPath, path)
 	}
 }
+
+func TestArchiveUnsafeHeader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	require.Nil(os.Symlink(testPath, filepath.Join(dstPath, "up")))
+
+	transfer := newTransfer(nil, nil)
+	transfer.transferConfig.OnConflict = kConflictOverwrite
+	for _, header := range []string{
+		`{"path_id":1,"path_name":["src","..","..","evil.txt"],"size":4}`,
+		`{"path_id":1,"path_name":["src","/evil.txt"],"size":4}`,
+		`{"path_id":1,"path_name":["up","evil.txt"],"size":4}`,
+	} {
+		srcFile, err := unmarshalSourceFile(`{"path_id":1,"path_name":["src"],"is_dir":true,"archive":true}`)
+		require.Nil(err)
+		writer, _, err := transfer.createDirOrFile(dstPath, srcFile, true)
+		require.Nil(err)
+		_, err = writer.Write([]byte(encodeString(header) + "\nevil"))
+		assert.IsType(&unsafePathError{}, err, header)
+		require.Nil(writer.Close())
+	}
+	_, err = os.Stat(filepath.Join(testPath, "evil.txt"))
+	assert.True(os.IsNotExist(err))
+}
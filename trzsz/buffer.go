@@ -64,6 +64,16 @@ func (b *trzszBuffer) drainBuffer() {
 	}
 }
 
+func (b *trzszBuffer) resetBuffer() {
+	b.drainBuffer()
+	select {
+	case <-b.stopCh:
+	default:
+	}
+	b.nextBuf = nil
+	b.nextIdx = 0
+}
+
 func (b *trzszBuffer) popBuffer() []byte {
 	if b.nextBuf != nil && b.nextIdx < len(b.nextBuf) {
 		buf := b.nextBuf[b.nextIdx:]
@@ -0,0 +1,85 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"sync"
+	"time"
+)
+
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	// allow a burst of up to one second
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// reserve takes n bytes out of the token bucket, and returns how long to wait before sending them.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func getBandwidthLimit(serverLimit, clientLimit int64) int64 {
+	if serverLimit <= 0 {
+		return max(clientLimit, 0)
+	}
+	if clientLimit <= 0 {
+		return serverLimit
+	}
+	return min(serverLimit, clientLimit)
+}
+
+func (t *trzszTransfer) throttle(n int) error {
+	if t.rateLimiter == nil {
+		return nil
+	}
+	wait := t.rateLimiter.reserve(n)
+	for wait > 0 {
+		if err := t.checkStop(); err != nil {
+			return err
+		}
+		sleep := min(wait, 100*time.Millisecond)
+		time.Sleep(sleep)
+		wait -= sleep
+	}
+	return t.checkStop()
+}
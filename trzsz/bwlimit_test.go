@@ -0,0 +1,108 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBandwidthLimit(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(0), getBandwidthLimit(0, 0))
+	assert.Equal(int64(1024), getBandwidthLimit(1024, 0))
+	assert.Equal(int64(2048), getBandwidthLimit(0, 2048))
+	assert.Equal(int64(1024), getBandwidthLimit(1024, 2048))
+	assert.Equal(int64(1024), getBandwidthLimit(4096, 1024))
+	assert.Equal(int64(0), getBandwidthLimit(-1, -1))
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newRateLimiter(0))
+
+	limiter := newRateLimiter(100 * 1024)
+	assert.Equal(time.Duration(0), limiter.reserve(100*1024))
+	wait := limiter.reserve(50 * 1024)
+	assert.Greater(wait, 400*time.Millisecond)
+	assert.LessOrEqual(wait, 500*time.Millisecond)
+
+	transfer := newTransfer(nil, nil)
+	transfer.rateLimiter = newRateLimiter(100 * 1024)
+	beginTime := time.Now()
+	for range 4 {
+		assert.Nil(transfer.throttle(50 * 1024))
+	}
+	assert.GreaterOrEqual(time.Since(beginTime), 900*time.Millisecond)
+
+	transfer.stopped.Store(true)
+	beginTime = time.Now()
+	assert.ErrorIs(transfer.throttle(1024*1024), errStopped)
+	assert.Less(time.Since(beginTime), 500*time.Millisecond)
+}
+
+func TestBandwidthLimitBufferSize(t *testing.T) {
+	for _, pacing := range []pacingMode{kPacingRTT, kPacingFixed} {
+		t.Run(string(pacing), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			srcPath, err := os.MkdirTemp("", "trzsz_test_")
+			require.Nil(err)
+			defer func() { _ = os.RemoveAll(srcPath) }()
+			dstPath, err := os.MkdirTemp("", "trzsz_test_")
+			require.Nil(err)
+			defer func() { _ = os.RemoveAll(dstPath) }()
+
+			sender, receiver := newTransferPair(kProtocolVersion)
+			for _, transfer := range []*trzszTransfer{sender, receiver} {
+				transfer.transferConfig.CompressType = kCompressNo
+				transfer.transferConfig.Pacing = pacing
+			}
+			bufSize := sender.bufferSize.Load()
+
+			content := make([]byte, bufSize+1)
+			rand.New(rand.NewSource(9)).Read(content)
+			srcFile := filepath.Join(srcPath, "a.bin")
+			require.Nil(os.WriteFile(srcFile, content, 0644))
+			files, err := checkPathsReadable([]string{srcFile}, false, false, nil)
+			require.Nil(err)
+
+			// the first chunk waits for more than 2 seconds, which is not the round trip time
+			sender.rateLimiter = newRateLimiter(4096)
+			sender.rateLimiter.reserve(4096)
+			_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+			assert.Equal([]string{"a.bin"}, localNames)
+			assertFileEqual(t, srcFile, filepath.Join(dstPath, "a.bin"))
+			assert.GreaterOrEqual(sender.bufferSize.Load(), bufSize)
+		})
+	}
+}
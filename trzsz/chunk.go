@@ -0,0 +1,232 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"time"
+)
+
+const kMaxChunkRetries = 3
+
+// chunkNak is the receiver asking for retransmission of a corrupted or lost chunk.
+type chunkNak struct {
+	seq int64
+}
+
+func (n *chunkNak) Error() string {
+	return fmt.Sprintf("Chunk %d is corrupted", n.seq)
+}
+
+// chunkCorrupted is a chunk failed the CRC check, the seq is -1 if the header is corrupted too.
+type chunkCorrupted struct {
+	seq int64
+}
+
+func (c *chunkCorrupted) Error() string {
+	return fmt.Sprintf("Chunk %d CRC check failed", c.seq)
+}
+
+// recvAck is the response of the receiver for a chunk, in the order of the chunks.
+type recvAck struct {
+	length int
+	nak    bool
+	seq    int64
+}
+
+// sendChunk sends a chunk with its sequence number and CRC, so that the receiver can ask for retransmission.
+func (t *trzszTransfer) sendChunk(seq int64, data []byte) (*time.Time, error) {
+	if err := t.checkStopAndPause("DATA"); err != nil {
+		return nil, err
+	}
+	if err := t.throttle(len(data)); err != nil {
+		return nil, err
+	}
+	beginTime := timeNowFunc() // the rate limit sleep is not counted in the round trip time
+	crc := crc32.ChecksumIEEE(data)
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)+0x40))
+	if t.transferConfig.Binary {
+		fmt.Fprintf(buffer, "#DATA:%d:%08x:%d%s", seq, crc, len(data), t.transferConfig.Newline)
+		buffer.Write(data)
+	} else {
+		fmt.Fprintf(buffer, "#DATA:%d:%08x:", seq, crc)
+		buffer.Write(data)
+		buffer.WriteString(t.transferConfig.Newline)
+	}
+	t.chunkMutex.Lock()
+	defer t.chunkMutex.Unlock()
+	return &beginTime, t.writeAll(buffer.Bytes())
+}
+
+func (t *trzszTransfer) resendChunk(ack *trzszAck, nak *chunkNak, retries int) error {
+	if nak.seq != ack.seq {
+		return simpleTrzszError("Chunk %d is expected to be resent, but got %d", ack.seq, nak.seq)
+	}
+	if retries >= kMaxChunkRetries {
+		return retryableTrzszError("Chunk %d is still corrupted after %d retries", ack.seq, retries)
+	}
+	_, err := t.sendChunk(ack.seq, ack.data)
+	return err
+}
+
+// getChunkTimeout is shorter than the timeout, so that a lost chunk is asked to be resent before the sender gives up.
+func (t *trzszTransfer) getChunkTimeout() <-chan time.Time {
+	if t.transferConfig.Timeout <= 0 {
+		return nil
+	}
+	return time.NewTimer(time.Duration(t.transferConfig.Timeout) * time.Second / 2).C
+}
+
+func parseChunkHeader(header []byte) (int64, uint32, []byte, error) {
+	tokens := bytes.SplitN(header, []byte(":"), 3)
+	if len(tokens) != 3 {
+		return -1, 0, nil, simpleTrzszError("Invalid chunk header: %s", header)
+	}
+	seq, err := strconv.ParseInt(string(tokens[0]), 10, 64)
+	if err != nil || seq < 0 {
+		return -1, 0, nil, simpleTrzszError("Invalid chunk seq: %s", tokens[0])
+	}
+	crc, err := strconv.ParseUint(string(tokens[1]), 16, 32)
+	if err != nil {
+		return seq, 0, nil, simpleTrzszError("Invalid chunk crc: %s", tokens[1])
+	}
+	return seq, uint32(crc), tokens[2], nil
+}
+
+// recvChunk receives a chunk, returns *chunkCorrupted if the chunk is corrupted but can be retransmitted.
+func (t *trzszTransfer) recvChunk() (int64, []byte, *time.Time, error) {
+	buf, beginTime, _, err := t.recvCheckWithTimeout("DATA", t.getChunkTimeout)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	seq, crc, rest, err := parseChunkHeader(buf)
+	if t.transferConfig.Binary {
+		if err != nil { // the length is unknown, can't find the next chunk
+			return 0, nil, nil, err
+		}
+		size, err := strconv.ParseInt(string(rest), 10, 64)
+		if err != nil || size < 0 {
+			return 0, nil, nil, simpleTrzszError("Invalid chunk length: %s", rest)
+		}
+		rest = []byte{}
+		if size > 0 {
+			if rest, err = t.buffer.readBinary(int(size), t.getNewTimeout()); err != nil {
+				if e := t.checkStop(); e != nil {
+					return 0, nil, nil, e
+				}
+				return 0, nil, nil, err
+			}
+		}
+	} else if err != nil {
+		return 0, nil, nil, &chunkCorrupted{seq}
+	}
+	if crc32.ChecksumIEEE(rest) != crc {
+		return 0, nil, nil, &chunkCorrupted{seq}
+	}
+	return seq, rest, beginTime, nil
+}
+
+// pipelineRecvChunks receives the chunks and puts them in order. The corrupted or lost chunk is asked to be resent,
+// and the chunks after it are kept until it arrives, so the acks are in order as the sender expects.
+func (t *trzszTransfer) pipelineRecvChunks(ctx *pipelineContext, ackChan chan<- recvAck, recvDataChan chan<- []byte) {
+	next := int64(0)
+	pending := make(map[int64][]byte)
+	lost := make(map[int64]bool)
+	nakSent, damaged, finished := false, false, false
+	timeouts := 0
+
+	deliver := func(data []byte) bool {
+		select {
+		case ackChan <- recvAck{length: len(data)}:
+		case <-ctx.Done():
+			return false
+		}
+		if len(data) == 0 {
+			finished = true
+			return true
+		}
+		select {
+		case recvDataChan <- data:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil && !finished {
+		seq, data, beginTime, err := t.recvChunk()
+		var corrupted *chunkCorrupted
+		if err == errReceiveDataTimeout && timeouts < kMaxChunkRetries {
+			// the chunk may be lost without any chunk after it
+			timeouts++
+			nakSent = false
+			lost[next] = true
+		} else if errors.As(err, &corrupted) {
+			if corrupted.seq < 0 {
+				damaged = true
+			} else if corrupted.seq >= next {
+				lost[corrupted.seq] = true
+			}
+		} else if err != nil {
+			ctx.cancel(err)
+			return
+		} else {
+			t.setLastChunkTime(time.Since(*beginTime))
+			if seq == next {
+				if !deliver(bytes.Clone(data)) {
+					return
+				}
+				delete(lost, next)
+				next++
+				nakSent, timeouts = false, 0
+				for buf, ok := pending[next]; ok && !finished; buf, ok = pending[next] {
+					if !deliver(buf) {
+						return
+					}
+					delete(pending, next)
+					delete(lost, next)
+					next++
+				}
+			} else if _, ok := pending[seq]; !ok && seq > next {
+				pending[seq] = bytes.Clone(data)
+			}
+			// the chunk before next is a duplicate of a retransmitted chunk
+		}
+
+		if !finished && !nakSent && (lost[next] || damaged || len(pending) > 0) {
+			select {
+			case ackChan <- recvAck{nak: true, seq: next}:
+			case <-ctx.Done():
+				return
+			}
+			nakSent, damaged = true, false
+			delete(lost, next)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type faultyWriter struct {
+	writer  io.Writer
+	binary  bool
+	frames  int
+	corrupt func(int) bool
+	drop    func(int) bool
+}
+
+func (w *faultyWriter) Write(p []byte) (int, error) {
+	if !bytes.HasPrefix(p, []byte("#DATA:")) || len(p) < 100 {
+		return w.writer.Write(p)
+	}
+	w.frames++
+	if w.drop != nil && w.drop(w.frames) {
+		return len(p), nil
+	}
+	if w.corrupt != nil && w.corrupt(w.frames) {
+		p = bytes.Clone(p)
+		if w.binary {
+			p[len(p)-1] ^= 0x01
+		} else {
+			p[len(p)-2] ^= 0x01
+		}
+	}
+	return w.writer.Write(p)
+}
+
+func TestChunkRetransmit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+
+	content := make([]byte, 200*1024)
+	rand.New(rand.NewSource(4)).Read(content)
+	srcFile := filepath.Join(srcPath, "a.bin")
+	require.Nil(os.WriteFile(srcFile, content, 0644))
+
+	for _, binary := range []bool{false, true} {
+		dstPath, err := os.MkdirTemp("", "trzsz_test_")
+		require.Nil(err)
+		defer func() { _ = os.RemoveAll(dstPath) }()
+
+		files, err := checkPathsReadable([]string{srcFile}, false, false, nil)
+		require.Nil(err)
+		sender, receiver := newTransferPair(kProtocolVersion)
+		for _, transfer := range []*trzszTransfer{sender, receiver} {
+			transfer.transferConfig.Binary = binary
+			transfer.transferConfig.CompressType = kCompressNo
+			transfer.bufferSize.Store(10 * 1024)
+			transfer.transferConfig.Timeout = 2
+		}
+		sender.writer = &faultyWriter{writer: sender.writer, binary: binary,
+			corrupt: func(n int) bool { return n%7 == 3 },
+			drop:    func(n int) bool { return n == 5 || n == 9 },
+		}
+		_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+		assert.Equal([]string{"a.bin"}, localNames)
+		buf, err := os.ReadFile(filepath.Join(dstPath, "a.bin"))
+		require.Nil(err)
+		assert.True(bytes.Equal(content, buf))
+	}
+}
+
+func TestChunkRetryLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	srcFile := filepath.Join(srcPath, "a.bin")
+	require.Nil(os.WriteFile(srcFile, bytes.Repeat([]byte("0123456789"), 10240), 0644))
+	files, err := checkPathsReadable([]string{srcFile}, false, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		transfer.transferConfig.CompressType = kCompressNo
+		transfer.transferConfig.Timeout = 2
+	}
+	sender.writer = &faultyWriter{writer: sender.writer, corrupt: func(int) bool { return true }}
+	go func() { _, _ = receiver.recvFiles(dstPath, nil) }()
+	_, err = sender.sendFiles(files, nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "is still corrupted after 3 retries")
+}
+
+func TestParseChunkHeader(t *testing.T) {
+	assert := assert.New(t)
+	seq, crc, rest, err := parseChunkHeader([]byte("12:0000abcd:data"))
+	assert.Nil(err)
+	assert.Equal(int64(12), seq)
+	assert.Equal(uint32(0xabcd), crc)
+	assert.Equal([]byte("data"), rest)
+
+	for _, header := range []string{"", "12", "12:0000abcd", "x:0000abcd:data", "-1:0000abcd:data"} {
+		seq, _, _, err := parseChunkHeader([]byte(header))
+		assert.NotNil(err)
+		assert.Equal(int64(-1), seq)
+	}
+	seq, _, _, err = parseChunkHeader([]byte("12:zz:data"))
+	assert.NotNil(err)
+	assert.Equal(int64(12), seq)
+}
@@ -27,7 +27,11 @@ package trzsz
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -45,7 +49,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
 	"golang.org/x/term"
 )
 
@@ -89,18 +92,25 @@ func SetAffectedByWindows(affected bool) {
 
 type progressCallback interface {
 	onNum(num int64)
+	onTotal(total int64)
 	onName(name string)
 	onSize(size int64)
 	onStep(step int64)
 	onDone()
+	onSkip(size int64)
 	setPreSize(size int64)
 	setPause(pausing bool)
+	setRetry(retry, limit int)
 }
 
 type bufferSize struct {
 	Size int64
 }
 
+type bandwidthLimit struct {
+	Rate int64
+}
+
 type compressType int
 
 const (
@@ -109,30 +119,64 @@ const (
 	kCompressNo   = 2
 )
 
+type compressCodec string
+
+const (
+	kCodecZstd compressCodec = "zstd"
+	kCodecS2   compressCodec = "s2"
+)
+
+// compressOption is the type, or the codec with an optional level which is detected automatically like auto.
+type compressOption struct {
+	Type  compressType
+	Codec compressCodec
+	Level int
+}
+
+type conflictPolicy string
+
+const (
+	kConflictOverwrite conflictPolicy = "overwrite"
+	kConflictRename    conflictPolicy = "rename"
+	kConflictSkip      conflictPolicy = "skip"
+	kConflictNewer     conflictPolicy = "newer"
+	kConflictLarger    conflictPolicy = "larger"
+)
+
 type baseArgs struct {
-	Quiet     bool         `arg:"-q" help:"quiet (hide progress bar)"`
-	Overwrite bool         `arg:"-y" help:"yes, overwrite existing file(s)"`
-	Binary    bool         `arg:"-b" help:"binary transfer mode, faster for binary files"`
-	Escape    bool         `arg:"-e" help:"escape all known control characters"`
-	Directory bool         `arg:"-d" help:"transfer directories and files"`
-	Recursive bool         `arg:"-r" help:"transfer directories and files, same as -d"`
-	Fork      bool         `arg:"-f" help:"fork to transfer in background (implies -q)"`
-	Bufsize   bufferSize   `arg:"-B" placeholder:"N" default:"10M" help:"max buffer chunk size (1K<=N<=1G). (default: 10M)"`
-	Timeout   int          `arg:"-t" placeholder:"N" default:"20" help:"timeout ( N seconds ) for each buffer chunk.\nN <= 0 means never timeout. (default: 20)"`
-	Compress  compressType `arg:"-c" placeholder:"yes/no/auto" default:"auto" help:"compress type (default: auto)"`
+	Quiet      bool           `arg:"-q" help:"quiet (hide progress bar)"`
+	Overwrite  bool           `arg:"-y" help:"yes, overwrite existing file(s)"`
+	Binary     bool           `arg:"-b" help:"binary transfer mode, faster for binary files"`
+	Escape     bool           `arg:"-e" help:"escape all known control characters"`
+	Directory  bool           `arg:"-d" help:"transfer directories and files"`
+	Recursive  bool           `arg:"-r" help:"transfer directories and files, same as -d"`
+	Links      bool           `arg:"-L" help:"transfer symlinks as links instead of following them (implies -d)"`
+	Fork       bool           `arg:"-f" help:"fork to transfer in background (implies -q)"`
+	Bufsize    bufferSize     `arg:"-B" placeholder:"N" default:"10M" help:"max buffer chunk size (1K<=N<=1G). (default: 10M)"`
+	Timeout    int            `arg:"-t" placeholder:"N" default:"20" help:"timeout ( N seconds ) for each buffer chunk.\nN <= 0 means never timeout. (default: 20)"`
+	Compress   compressOption `arg:"-c" placeholder:"TYPE" default:"auto" help:"compress type: yes, no, auto, zstd[:LEVEL] or s2.\nthe level of zstd is 1 to 22, lz4 is same as s2.\n(default: auto)"`
+	BwLimit    bandwidthLimit `arg:"--bwlimit" placeholder:"RATE" help:"limit the speed to RATE bytes per second, e.g. 512K.\n0 means no limit. (default: 0)"`
+	Parallel   int            `arg:"-P" placeholder:"N" help:"transfer up to N files in parallel, only while\nthe tunnel is connected. (default: 1)"`
+	OnConflict conflictPolicy `arg:"--on-conflict" placeholder:"POLICY" help:"policy for existing file(s): overwrite, rename,\nskip, newer or larger. -y is same as overwrite. (default: rename)"`
+	Pacing     pacingMode     `arg:"--pacing" placeholder:"MODE" help:"adapt the chunk size and timeout to: rtt (the round trip\ntime) or fixed (the old heuristic). (default: rtt)"`
+	Retry      int            `arg:"--retry" placeholder:"N" help:"retry up to N times on recoverable failures, e.g. timeout,\nand resume from the partial file. (default: 0)"`
+	Sync       bool           `arg:"--sync" help:"only transfer the new or changed entries in directories\n(implies -d and -y)"`
+	Delete     bool           `arg:"--delete" help:"delete the entries which don't exist in the sent\ndirectories (implies --sync)"`
+	Include    []string       `arg:"--include,separate" placeholder:"PATTERN" help:"only transfer the files matching the pattern in\ndirectories, can be repeated"`
+	Exclude    []string       `arg:"--exclude,separate" placeholder:"PATTERN" help:"skip the entries matching the pattern in directories,\ncan be repeated. .trzszignore files are also honored\nif any pattern is given"`
+	JSON       bool           `arg:"--json" help:"print a JSON summary instead of the message at the end"`
 }
 
 var sizeRegexp = regexp.MustCompile(`(?i)^(\d+)(b|k|m|g|kb|mb|gb)?$`)
 
-func (b *bufferSize) UnmarshalText(buf []byte) error {
-	str := string(buf)
+func parseSize(str string) (int64, error) {
 	match := sizeRegexp.FindStringSubmatch(str)
 	if len(match) < 2 {
-		return fmt.Errorf("invalid size %s", str)
+		return 0, fmt.Errorf("invalid size %s", str)
 	}
 	sizeValue, err := strconv.ParseInt(match[1], 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid size %s", str)
+		return 0, fmt.Errorf("invalid size %s", str)
 	}
 	if len(match) > 2 {
 		unitSuffix := strings.ToLower(match[2])
@@ -145,9 +189,17 @@ func (b *bufferSize) UnmarshalText(buf []byte) error {
 		} else if unitSuffix == "g" || unitSuffix == "gb" {
 			sizeValue *= 1024 * 1024 * 1024
 		} else {
-			return fmt.Errorf("invalid size %s", str)
+			return 0, fmt.Errorf("invalid size %s", str)
 		}
 	}
+	return sizeValue, nil
+}
+
+func (b *bufferSize) UnmarshalText(buf []byte) error {
+	sizeValue, err := parseSize(string(buf))
+	if err != nil {
+		return err
+	}
 	if sizeValue < 1024 {
 		return fmt.Errorf("less than 1K")
 	}
@@ -158,6 +210,18 @@ func (b *bufferSize) UnmarshalText(buf []byte) error {
 	return nil
 }
 
+func (b *bandwidthLimit) UnmarshalText(buf []byte) error {
+	rate, err := parseSize(string(buf))
+	if err != nil {
+		return err
+	}
+	if rate != 0 && rate < 1024 {
+		return fmt.Errorf("less than 1K")
+	}
+	b.Rate = rate
+	return nil
+}
+
 func (c *compressType) UnmarshalText(buf []byte) error {
 	str := strings.ToLower(strings.TrimSpace(string(buf)))
 	switch str {
@@ -175,6 +239,62 @@ func (c *compressType) UnmarshalText(buf []byte) error {
 	}
 }
 
+func (p *conflictPolicy) UnmarshalText(buf []byte) error {
+	policy := conflictPolicy(strings.ToLower(strings.TrimSpace(string(buf))))
+	switch policy {
+	case kConflictOverwrite, kConflictRename, kConflictSkip, kConflictNewer, kConflictLarger:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict policy %s", policy)
+	}
+}
+
+func (c *compressOption) UnmarshalText(buf []byte) error {
+	str := strings.ToLower(strings.TrimSpace(string(buf)))
+	name, level, hasLevel := strings.Cut(str, ":")
+	if name == "lz4" {
+		name = string(kCodecS2) // lz4 is an alias of the faster codec s2
+	}
+	switch compressCodec(name) {
+	case kCodecZstd:
+		*c = compressOption{Codec: kCodecZstd}
+		if hasLevel {
+			n, err := strconv.Atoi(level)
+			if err != nil || n < 1 || n > 22 {
+				return fmt.Errorf("invalid zstd level %s", level)
+			}
+			c.Level = n
+		}
+		return nil
+	case kCodecS2:
+		if hasLevel {
+			return fmt.Errorf("invalid compress type %s", str)
+		}
+		*c = compressOption{Codec: kCodecS2}
+		return nil
+	}
+	if str == "none" {
+		str = "no"
+	}
+	var typ compressType
+	if err := typ.UnmarshalText([]byte(str)); err != nil {
+		return err
+	}
+	*c = compressOption{Type: typ}
+	return nil
+}
+
+func getConflictPolicy(overwrite bool, policy conflictPolicy) conflictPolicy {
+	if policy != "" {
+		return policy
+	}
+	if overwrite {
+		return kConflictOverwrite
+	}
+	return kConflictRename
+}
+
 func (c *compressType) UnmarshalJSON(data []byte) error {
 	var compress int
 	if err := json.Unmarshal(data, &compress); err != nil {
@@ -214,9 +334,10 @@ func decodeString(str string) ([]byte, error) {
 }
 
 type trzszError struct {
-	message string
-	errType string
-	trace   bool
+	message   string
+	errType   string
+	trace     bool
+	retryable bool
 }
 
 var (
@@ -236,7 +357,7 @@ func newTrzszError(message string, errType string, trace bool) *trzszError {
 	} else if len(errType) > 0 {
 		message = fmt.Sprintf("[TrzszError] %s: %s", errType, message)
 	}
-	err := &trzszError{message, errType, trace}
+	err := &trzszError{message: message, errType: errType, trace: trace}
 	if err.isTraceBack() {
 		err.message = fmt.Sprintf("%s\n%s", err.message, string(debug.Stack()))
 	}
@@ -289,6 +410,103 @@ func checkPathWritable(path string) error {
 	return nil
 }
 
+// checkSymlinkTarget refuses link targets which may resolve outside of destPath.
+// Only leading `..` are allowed, so the target can't climb up through another link.
+func checkSymlinkTarget(destPath, linkPath, target string) error {
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return simpleTrzszError("Link target is absolute: %s -> %s", linkPath, target)
+	}
+	named := false
+	for _, name := range strings.Split(filepath.ToSlash(target), "/") {
+		if name == ".." {
+			if named {
+				return simpleTrzszError("Link target escapes destination: %s -> %s", linkPath, target)
+			}
+		} else if name != "" && name != "." {
+			named = true
+		}
+	}
+	realDest, err := filepath.EvalSymlinks(destPath)
+	if err != nil {
+		return err
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realDest, filepath.Join(realParent, target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return simpleTrzszError("Link target escapes destination: %s -> %s", linkPath, target)
+	}
+	return nil
+}
+
+// unsafePathError is a received path which is malformed or may resolve outside of the destination.
+type unsafePathError struct {
+	path   string
+	reason string
+}
+
+func (e *unsafePathError) Error() string {
+	return fmt.Sprintf("Unsafe path %q: %s", e.path, e.reason)
+}
+
+// checkPathName refuses a received path component which is not a plain file name.
+func checkPathName(path, name string) error {
+	switch {
+	case name == "":
+		return &unsafePathError{path, "empty name"}
+	case name == "." || name == "..":
+		return &unsafePathError{path, "dot name"}
+	case strings.IndexByte(name, 0) >= 0:
+		return &unsafePathError{path, "NUL in name"}
+	case strings.IndexByte(name, '/') >= 0 || isRunningOnWindows() && strings.ContainsAny(name, `\:`):
+		return &unsafePathError{path, "separator in name"}
+	case filepath.IsAbs(name) || filepath.VolumeName(name) != "":
+		return &unsafePathError{path, "absolute name"}
+	}
+	return nil
+}
+
+func checkRelPath(relPath []string) error {
+	path := strings.Join(relPath, "/")
+	for _, name := range relPath {
+		if err := checkPathName(path, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPathInside refuses path if it resolves outside of destPath, through the symlinks already existing in it.
+func checkPathInside(destPath, path string) error {
+	realDest, err := filepath.EvalSymlinks(destPath)
+	if err != nil {
+		return err
+	}
+	existing, rest := path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	realPath, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return &unsafePathError{path, "unresolvable link"}
+	}
+	rel, err := filepath.Rel(realDest, filepath.Join(realPath, rest))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &unsafePathError{path, "escapes destination"}
+	}
+	return nil
+}
+
 type sourceFile struct {
 	PathID   int           `json:"path_id"`
 	AbsPath  string        `json:"-"`
@@ -297,8 +515,12 @@ type sourceFile struct {
 	Archive  bool          `json:"archive"`
 	Size     int64         `json:"size"`
 	Perm     *uint32       `json:"perm"`
+	ModTime  *int64        `json:"mtime"`
+	Link     string        `json:"link,omitempty"`
+	Stream   bool          `json:"stream,omitempty"`
 	Header   string        `json:"-"`
 	SubFiles []*sourceFile `json:"-"`
+	filter   *pathFilter
 }
 
 func (f *sourceFile) getFileName() string {
@@ -308,6 +530,10 @@ func (f *sourceFile) getFileName() string {
 	return f.RelPath[len(f.RelPath)-1]
 }
 
+func (f *sourceFile) isSymlink() bool {
+	return f.Link != ""
+}
+
 func (f *sourceFile) marshalSourceFile() (string, error) {
 	f.Archive = len(f.SubFiles) > 0
 	jstr, err := json.Marshal(f)
@@ -329,8 +555,12 @@ func unmarshalSourceFile(source string) (*sourceFile, error) {
 }
 
 type targetFile struct {
-	Name string `json:"name"`
-	Size int64  `json:"size"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Skip   bool   `json:"skip,omitempty"`
+	Resume bool   `json:"resume,omitempty"`
+	State  []byte `json:"state,omitempty"`
+	Delta  int64  `json:"delta,omitempty"`
 }
 
 func (f *targetFile) marshalTargetFile() (string, error) {
@@ -353,8 +583,18 @@ func unmarshalTargetFile(target string) (*targetFile, error) {
 }
 
 func checkPathReadable(pathID int, path string, info os.FileInfo, list *[]*sourceFile,
-	relPath []string, visitedDir map[string]bool) error {
+	relPath []string, visitedDir map[string]bool, links bool, filter *pathFilter) error {
 	perm := uint32(info.Mode().Perm())
+	modTime := info.ModTime().UnixNano()
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return simpleTrzszError("Readlink [%s] error: %v", path, err)
+		}
+		*list = append(*list, &sourceFile{PathID: pathID, AbsPath: path, RelPath: relPath, Link: target,
+			ModTime: &modTime})
+		return nil
+	}
 	if !info.IsDir() {
 		if !info.Mode().IsRegular() {
 			return simpleTrzszError("Not a regular file: %s", path)
@@ -362,7 +602,8 @@ func checkPathReadable(pathID int, path string, info os.FileInfo, list *[]*sourc
 		if syscallAccessRok(path) != nil {
 			return simpleTrzszError("No permission to read: %s", path)
 		}
-		*list = append(*list, &sourceFile{PathID: pathID, AbsPath: path, RelPath: relPath, Size: info.Size(), Perm: &perm})
+		*list = append(*list, &sourceFile{PathID: pathID, AbsPath: path, RelPath: relPath, Size: info.Size(),
+			Perm: &perm, ModTime: &modTime})
 		return nil
 	}
 	realPath, err := filepath.EvalSymlinks(path)
@@ -373,7 +614,8 @@ func checkPathReadable(pathID int, path string, info os.FileInfo, list *[]*sourc
 		return simpleTrzszError("Duplicate link: %s", path)
 	}
 	visitedDir[realPath] = true
-	*list = append(*list, &sourceFile{PathID: pathID, AbsPath: path, RelPath: relPath, IsDir: true, Perm: &perm})
+	dirFile := &sourceFile{PathID: pathID, AbsPath: path, RelPath: relPath, IsDir: true, Perm: &perm, ModTime: &modTime}
+	*list = append(*list, dirFile)
 	fileObj, err := os.Open(path)
 	if err != nil {
 		return simpleTrzszError("Open [%s] error: %v", path, err)
@@ -382,30 +624,45 @@ func checkPathReadable(pathID int, path string, info os.FileInfo, list *[]*sourc
 	if err != nil {
 		return simpleTrzszError("Readdir [%s] error: %v", path, err)
 	}
+	filter, err = filter.withIgnoreFile(path, relPath)
+	if err != nil {
+		return err
+	}
+	dirFile.filter = filter // to protect the filtered entries from --delete
 	for _, file := range files {
 		p := filepath.Join(path, file.Name())
-		info, err := os.Stat(p)
+		info, err := statPath(p, links)
 		if err != nil {
 			return simpleTrzszError("Stat [%s] error: %v", p, err)
 		}
 		r := make([]string, len(relPath))
 		copy(r, relPath)
 		r = append(r, file.Name())
-		if err := checkPathReadable(pathID, p, info, list, r, visitedDir); err != nil {
+		if filter.skip(r, info.IsDir()) {
+			continue
+		}
+		if err := checkPathReadable(pathID, p, info, list, r, visitedDir, links, filter); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func checkPathsReadable(paths []string, directory bool) ([]*sourceFile, error) {
+func statPath(path string, links bool) (os.FileInfo, error) {
+	if links {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
+func checkPathsReadable(paths []string, directory, links bool, filter *pathFilter) ([]*sourceFile, error) {
 	var list []*sourceFile
 	for i, p := range paths {
 		path, err := filepath.Abs(p)
 		if err != nil {
 			return nil, err
 		}
-		info, err := os.Stat(path)
+		info, err := statPath(path, links && directory)
 		if os.IsNotExist(err) {
 			return nil, simpleTrzszError("No such file: %s", path)
 		} else if err != nil {
@@ -415,7 +672,7 @@ func checkPathsReadable(paths []string, directory bool) ([]*sourceFile, error) {
 			return nil, simpleTrzszError("Is a directory: %s", path)
 		}
 		visitedDir := make(map[string]bool)
-		if err := checkPathReadable(i, path, info, &list, []string{info.Name()}, visitedDir); err != nil {
+		if err := checkPathReadable(i, path, info, &list, []string{info.Name()}, visitedDir, links && directory, filter); err != nil {
 			return nil, err
 		}
 	}
@@ -434,9 +691,10 @@ func checkDuplicateNames(sourceFiles []*sourceFile) error {
 	return nil
 }
 
+const kMaxFileNameLength = 255
+
 func getNewName(path, name string) (string, error) {
-	const maxNameLen = 255
-	if len(name) > maxNameLen {
+	if len(name) > kMaxFileNameLength {
 		return "", simpleTrzszError("File name too long: %s", name)
 	}
 
@@ -452,6 +710,17 @@ func getNewName(path, name string) (string, error) {
 	return "", simpleTrzszError("Fail to assign new file name to %s", name)
 }
 
+const kPartialFileSuffix = ".trzsz-part"
+
+func getPartialFilePath(path string) string {
+	dir, name := filepath.Split(path)
+	partName := "." + name + kPartialFileSuffix
+	if len(partName) > kMaxFileNameLength {
+		partName = fmt.Sprintf(".%x%s", md5.Sum([]byte(name)), kPartialFileSuffix)
+	}
+	return filepath.Join(dir, partName)
+}
+
 type tmuxModeType int
 
 const (
@@ -665,14 +934,33 @@ type trzszTrigger struct {
 type trzszDetector struct {
 	relay       bool
 	tmux        bool
+	secret      string
 	uniqueIDMap map[string]int
 }
 
 func newTrzszDetector(relay, tmux bool) *trzszDetector {
-	return &trzszDetector{relay, tmux, make(map[string]int)}
+	return &trzszDetector{relay: relay, tmux: tmux, uniqueIDMap: make(map[string]int)}
 }
 
-var trzszRegexp = regexp.MustCompile(`::TRZSZ:TRANSFER:([SRD]):(\d+\.\d+\.\d+)(:\d+)?(:\d+)?`)
+// kTrzszSecretEnv is the secret of the client session, forwarded to the server as `LC_*` is accepted by sshd usually.
+const kTrzszSecretEnv = "LC_TRZSZ_SECRET"
+
+func getTriggerMac(secret string, mode byte, uniqueID string, port int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%c:%s:%d", mode, uniqueID, port)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// signTrzszTrigger returns the suffix of the trigger to authenticate it, if the client sets a secret.
+func signTrzszTrigger(mode byte, uniqueID string, port int) string {
+	secret := os.Getenv(kTrzszSecretEnv)
+	if secret == "" {
+		return ""
+	}
+	return "#A" + getTriggerMac(secret, mode, uniqueID, port)
+}
+
+var trzszRegexp = regexp.MustCompile(`::TRZSZ:TRANSFER:([SRD]):(\d+\.\d+\.\d+)(:\d+)?(:\d+)?(?:#R)*(#A[0-9a-f]{32})?`)
 var uniqueIDRegexp = regexp.MustCompile(`::TRZSZ:TRANSFER:[SRD]:\d+\.\d+\.\d+:(\d{13}\d*)`)
 var tmuxControlModeRegexp = regexp.MustCompile(`((%output( %\d+ ))|(%extended-output( %\d+ )\d+ .*: )).*::TRZSZ:TRANSFER:`)
 
@@ -709,8 +997,24 @@ func (detector *trzszDetector) addRelaySuffix(output []byte, idx int) []byte {
 	return buf.Bytes()
 }
 
+func (detector *trzszDetector) isAuthenticated(mode byte, uniqueID string, port int, mac []byte) bool {
+	if len(mac) < 2 {
+		return false
+	}
+	if hmac.Equal([]byte(getTriggerMac(detector.secret, mode, uniqueID, port)), mac[2:]) {
+		return true
+	}
+	// the relay in tmux rewrites the unique id from `00` to `20`
+	if len(uniqueID) == 13 && strings.HasSuffix(uniqueID, "20") {
+		uniqueID = uniqueID[:11] + "00"
+		return hmac.Equal([]byte(getTriggerMac(detector.secret, mode, uniqueID, port)), mac[2:])
+	}
+	return false
+}
+
 func (detector *trzszDetector) isRepeatedID(uniqueID string) bool {
-	if len(uniqueID) > 6 && (isWindowsEnvironment() || len(uniqueID) != 13 || !strings.HasSuffix(uniqueID, "00")) {
+	// an authenticated trigger can't be replayed, e.g. by `cat` the log of this session
+	if len(uniqueID) > 6 && (detector.secret != "" || isWindowsEnvironment() || len(uniqueID) != 13 || !strings.HasSuffix(uniqueID, "00")) {
 		if _, ok := detector.uniqueIDMap[uniqueID]; ok {
 			return true
 		}
@@ -781,6 +1085,17 @@ func (detector *trzszDetector) detectTrzsz(output []byte, supportTmuxCC bool) ([
 	if len(match) > 3 && match[3] != nil {
 		uniqueID = string(match[3][1:])
 	}
+
+	port := 0
+	if len(match) > 4 && match[4] != nil {
+		if v, err := strconv.Atoi(string(match[4][1:])); err == nil {
+			port = v
+		}
+	}
+
+	if detector.secret != "" && (len(match) < 6 || !detector.isAuthenticated(mode, uniqueID, port, match[5])) {
+		return output, nil
+	}
 	if detector.isRepeatedID(uniqueID) {
 		return output, nil
 	}
@@ -790,13 +1105,6 @@ func (detector *trzszDetector) detectTrzsz(output []byte, supportTmuxCC bool) ([
 		winServer = true
 	}
 
-	port := 0
-	if len(match) > 4 && match[4] != nil {
-		if v, err := strconv.Atoi(string(match[4][1:])); err == nil {
-			port = v
-		}
-	}
-
 	if detector.relay {
 		output = detector.addRelaySuffix(output, idx)
 	} else {
@@ -878,7 +1186,7 @@ func (logger *traceLogger) writeTraceLog(buf []byte, typ string) []byte {
 
 const compressedBlockSize = 128 << 10
 
-func isCompressedFileContent(file *os.File, pos int64) (bool, error) {
+func isCompressedFileContent(file *os.File, pos int64, codec compressCodec, level int) (bool, error) {
 	if _, err := file.Seek(pos, io.SeekStart); err != nil {
 		return false, err
 	}
@@ -889,15 +1197,14 @@ func isCompressedFileContent(file *os.File, pos int64) (bool, error) {
 		return false, err
 	}
 
-	encoder, err := zstd.NewWriter(nil)
+	compressed, err := compressBlock(codec, level, buffer)
 	if err != nil {
 		return false, err
 	}
-	dst := make([]byte, 0, compressedBlockSize+0x20)
-	return len(encoder.EncodeAll(buffer, dst)) > compressedBlockSize*98/100, nil
+	return len(compressed) > compressedBlockSize*98/100, nil
 }
 
-func isCompressionProfitable(reader fileReader) (bool, error) {
+func isCompressionProfitable(reader fileReader, codec compressCodec, level int) (bool, error) {
 	file := reader.getFile()
 	if file == nil {
 		return true, nil
@@ -911,7 +1218,7 @@ func isCompressionProfitable(reader fileReader) (bool, error) {
 
 	compressedCount := 0
 	if size >= compressedBlockSize {
-		compressed, err := isCompressedFileContent(file, pos)
+		compressed, err := isCompressedFileContent(file, pos, codec, level)
 		if err != nil {
 			return false, err
 		}
@@ -921,7 +1228,7 @@ func isCompressionProfitable(reader fileReader) (bool, error) {
 	}
 
 	if size >= 2*compressedBlockSize {
-		compressed, err := isCompressedFileContent(file, pos+size-compressedBlockSize)
+		compressed, err := isCompressedFileContent(file, pos+size-compressedBlockSize, codec, level)
 		if err != nil {
 			return false, err
 		}
@@ -931,7 +1238,7 @@ func isCompressionProfitable(reader fileReader) (bool, error) {
 	}
 
 	if size >= 3*compressedBlockSize {
-		compressed, err := isCompressedFileContent(file, pos+(size/2)-(compressedBlockSize/2))
+		compressed, err := isCompressedFileContent(file, pos+(size/2)-(compressedBlockSize/2), codec, level)
 		if err != nil {
 			return false, err
 		}
@@ -947,7 +1254,7 @@ func isCompressionProfitable(reader fileReader) (bool, error) {
 	return compressedCount < 2, nil
 }
 
-func formatSavedFiles(fileNames []string, destPath string) string {
+func formatSavedFiles(fileNames, skippedNames []string, destPath string) string {
 	var builder strings.Builder
 	builder.WriteString("Saved ")
 	builder.WriteString(strconv.Itoa(len(fileNames)))
@@ -964,6 +1271,19 @@ func formatSavedFiles(fileNames []string, destPath string) string {
 		builder.WriteString("\r\n- ")
 		builder.WriteString(name)
 	}
+	if len(skippedNames) > 0 {
+		builder.WriteString("\r\nSkipped ")
+		builder.WriteString(strconv.Itoa(len(skippedNames)))
+		if len(skippedNames) > 1 {
+			builder.WriteString(" existing files")
+		} else {
+			builder.WriteString(" existing file")
+		}
+		for _, name := range skippedNames {
+			builder.WriteString("\r\n- ")
+			builder.WriteString(name)
+		}
+	}
 	return builder.String()
 }
 
@@ -395,10 +395,57 @@ func TestRelayDetector(t *testing.T) {
 		":1234567890120\n"+prefix+":9876543210220\r\n::TRZSZ:TRANSFER:R:", nil)
 }
 
+func TestAuthenticatedTrigger(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv(kTrzszSecretEnv, "")
+	assert.Equal("", signTrzszTrigger('R', "1234567890100", 1337))
+	t.Setenv(kTrzszSecretEnv, "secret")
+	mac := signTrzszTrigger('R', "1234567890100", 1337)
+	assert.Regexp("^#A[0-9a-f]{32}$", mac)
+	assert.NotEqual(mac, signTrzszTrigger('S', "1234567890100", 1337))
+	assert.NotEqual(mac, signTrzszTrigger('R', "1234567890200", 1337))
+	assert.NotEqual(mac, signTrzszTrigger('R', "1234567890100", 1338))
+
+	detector := newTrzszDetector(false, false)
+	detector.secret = "secret"
+	assertDetectTrzsz := func(output string, authenticated bool) {
+		t.Helper()
+		_, trigger := detector.detectTrzsz([]byte("\x1b[s::TRZSZ:TRANSFER:"+output+"\r\n"), false)
+		if authenticated {
+			assert.NotNil(trigger, output)
+		} else {
+			assert.Nil(trigger, output)
+		}
+	}
+	assertDetectTrzsz("R:1.1.6:1234567890100:1337", false)
+	assertDetectTrzsz("R:1.1.6:1234567890100:1337#A"+strings.Repeat("0", 32), false)
+	assertDetectTrzsz("S:1.1.6:1234567890100:1337"+mac, false)
+	assertDetectTrzsz("R:1.1.6:1234567890100:1338"+mac, false)
+	assertDetectTrzsz("R:1.1.6:1234567890100:1337"+mac, true)
+	assertDetectTrzsz("R:1.1.6:1234567890100:1337"+mac, false)
+
+	detector.secret = "other"
+	mac = signTrzszTrigger('S', "1234567890300", 0)
+	assertDetectTrzsz("S:1.1.6:1234567890300:0"+mac, false)
+	detector.secret = "secret"
+	assertDetectTrzsz("S:1.1.6:1234567890300:0"+mac, true)
+
+	// rewritten by the relays in tmux
+	relay := newTrzszDetector(true, true)
+	mac = signTrzszTrigger('D', "1234567890400", 2222)
+	buf, trigger := relay.detectTrzsz([]byte("\x1b[s::TRZSZ:TRANSFER:D:1.1.6:1234567890400:2222"+mac+"\r\n"), false)
+	assert.NotNil(trigger)
+	buf, _ = newTrzszDetector(true, true).detectTrzsz(buf, false)
+	assert.Contains(string(buf), ":1234567890420:2222#R#R"+mac)
+	_, trigger = detector.detectTrzsz(buf, false)
+	assert.NotNil(trigger)
+}
+
 func TestFormatSavedFileNames(t *testing.T) {
 	assert := assert.New(t)
 	type args struct {
 		files   []string
+		skipped []string
 		dstPath string
 	}
 	tests := []struct {
@@ -448,10 +495,23 @@ func TestFormatSavedFileNames(t *testing.T) {
 			want: "Saved 1 file/directory to /root\r\n" +
 				"- a.jpg",
 		},
+		{
+			name: "skipped",
+			args: args{
+				dstPath: "/root",
+				files:   []string{"a.jpg"},
+				skipped: []string{"b.jpg", "c/d.jpg"},
+			},
+			want: "Saved 1 file/directory to /root\r\n" +
+				"- a.jpg\r\n" +
+				"Skipped 2 existing files\r\n" +
+				"- b.jpg\r\n" +
+				"- c/d.jpg",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := formatSavedFiles(tt.args.files, tt.args.dstPath)
+			got := formatSavedFiles(tt.args.files, tt.args.skipped, tt.args.dstPath)
 			assert.Equal(tt.want, got)
 		})
 	}
@@ -0,0 +1,119 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The s2 codec is as fast as LZ4, and comes with the zstd package.
+
+type s2Reader struct {
+	decoder *s2.Reader
+}
+
+func (z *s2Reader) Read(p []byte) (int, error) {
+	return z.decoder.Read(p)
+}
+
+func (z *s2Reader) Close() {
+}
+
+func newS2Reader(reader io.Reader) readCloser {
+	return &s2Reader{s2.NewReader(reader)}
+}
+
+type s2Writer struct {
+	encoder *s2.Writer
+	writer  io.WriteCloser
+}
+
+func (z *s2Writer) Write(p []byte) (int, error) {
+	return z.encoder.Write(p)
+}
+
+func (z *s2Writer) Close() error {
+	if err := z.encoder.Close(); err != nil {
+		return err
+	}
+	return z.writer.Close()
+}
+
+func (z *s2Writer) Flush() error {
+	return z.encoder.Flush()
+}
+
+func newS2Writer(writer io.WriteCloser) writeCloseFlusher {
+	return &s2Writer{s2.NewWriter(writer), writer}
+}
+
+func getZstdOptions(level int) []zstd.EOption {
+	if level <= 0 {
+		return nil
+	}
+	return []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))}
+}
+
+func (t *trzszTransfer) newCompressWriter(writer io.WriteCloser) (writeCloseFlusher, error) {
+	switch t.transferConfig.CompressCodec {
+	case "", kCodecZstd:
+		return newZstdWriter(writer, getZstdOptions(t.transferConfig.CompressLevel)...)
+	case kCodecS2:
+		return newS2Writer(writer), nil
+	default:
+		return nil, simpleTrzszError("Unknown compress codec: %s", t.transferConfig.CompressCodec)
+	}
+}
+
+func (t *trzszTransfer) newCompressReader(reader io.Reader) (readCloser, error) {
+	switch t.transferConfig.CompressCodec {
+	case "", kCodecZstd:
+		return newZstdReader(reader)
+	case kCodecS2:
+		return newS2Reader(reader), nil
+	default:
+		return nil, simpleTrzszError("Unknown compress codec: %s", t.transferConfig.CompressCodec)
+	}
+}
+
+// compressBlock compresses a block of the file with the codec, to detect whether the compression is profitable.
+func compressBlock(codec compressCodec, level int, block []byte) ([]byte, error) {
+	switch codec {
+	case "", kCodecZstd:
+		encoder, err := zstd.NewWriter(nil, getZstdOptions(level)...)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = encoder.Close() }()
+		return encoder.EncodeAll(block, make([]byte, 0, len(block)+0x20)), nil
+	case kCodecS2:
+		return s2.Encode(nil, block), nil
+	default:
+		return nil, simpleTrzszError("Unknown compress codec: %s", codec)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressBlock(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	text := []byte(strings.Repeat("compressible text\n", compressedBlockSize/18+1))[:compressedBlockSize]
+	random := make([]byte, compressedBlockSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	for _, codec := range []compressCodec{"", kCodecZstd, kCodecS2} {
+		compressed, err := compressBlock(codec, 0, text)
+		require.Nil(err)
+		assert.Less(len(compressed), len(text)/10)
+		compressed, err = compressBlock(codec, 0, random)
+		require.Nil(err)
+		assert.Greater(len(compressed), len(random)*98/100)
+	}
+	high, err := compressBlock(kCodecZstd, 19, text)
+	require.Nil(err)
+	low, err := compressBlock(kCodecZstd, 1, text)
+	require.Nil(err)
+	assert.LessOrEqual(len(high), len(low))
+
+	_, err = compressBlock("xz", 0, text)
+	assert.ErrorContains(err, "Unknown compress codec: xz")
+}
+
+func TestTransferWithCodecs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+
+	random := make([]byte, 300*1024)
+	rand.New(rand.NewSource(2)).Read(random)
+	text := []byte(strings.Repeat("compressible text\n", 20000))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "random.bin"), random, 0644))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "text.txt"), text, 0644))
+
+	for _, option := range []compressOption{{Codec: kCodecZstd, Level: 19}, {Codec: kCodecS2},
+		{Type: kCompressYes, Codec: kCodecS2}} {
+		dstPath, err := os.MkdirTemp("", "trzsz_test_")
+		require.Nil(err)
+		defer func() { _ = os.RemoveAll(dstPath) }()
+
+		files, err := checkPathsReadable([]string{filepath.Join(srcPath, "random.bin"),
+			filepath.Join(srcPath, "text.txt")}, false, false, nil)
+		require.Nil(err)
+		sender, receiver := newTransferPair(kProtocolVersion)
+		for _, transfer := range []*trzszTransfer{sender, receiver} {
+			transfer.transferConfig.CompressType = option.Type
+			transfer.transferConfig.CompressCodec = option.Codec
+			transfer.transferConfig.CompressLevel = option.Level
+		}
+		_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+		assert.Equal([]string{"random.bin", "text.txt"}, localNames)
+		for name, content := range map[string][]byte{"random.bin": random, "text.txt": text} {
+			buf, err := os.ReadFile(filepath.Join(dstPath, name))
+			require.Nil(err)
+			assert.True(bytes.Equal(content, buf))
+		}
+	}
+}
+
+func TestCompressConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	args := &baseArgs{Bufsize: bufferSize{1024}, Timeout: 10,
+		Compress: compressOption{Type: kCompressYes, Codec: kCodecZstd, Level: 19}}
+	transfer := newTransfer(newTestWriter(t), nil)
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion11}, nil, noTmuxMode, 0))
+	assert.Equal(compressType(kCompressYes), transfer.transferConfig.CompressType)
+	assert.Equal(compressCodec(""), transfer.transferConfig.CompressCodec)
+	assert.Equal(0, transfer.transferConfig.CompressLevel)
+
+	transfer = newTransfer(newTestWriter(t), nil)
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion12}, nil, noTmuxMode, 0))
+	assert.Equal(compressType(kCompressYes), transfer.transferConfig.CompressType)
+	assert.Equal(kCodecZstd, transfer.transferConfig.CompressCodec)
+	assert.Equal(19, transfer.transferConfig.CompressLevel)
+}
@@ -0,0 +1,223 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type pacingMode string
+
+const (
+	kPacingRTT   pacingMode = "rtt"
+	kPacingFixed pacingMode = "fixed"
+)
+
+func (p *pacingMode) UnmarshalText(buf []byte) error {
+	mode := pacingMode(strings.ToLower(strings.TrimSpace(string(buf))))
+	switch mode {
+	case kPacingRTT, kPacingFixed:
+		*p = mode
+		return nil
+	default:
+		return fmt.Errorf("invalid pacing mode %s", mode)
+	}
+}
+
+const (
+	kMinWindow          = 2
+	kMaxWindow          = 64
+	kMinChunkSize       = 1024
+	kMinChunkTime       = 50 * time.Millisecond
+	kMaxChunkTime       = 500 * time.Millisecond
+	kMinAdaptiveTimeout = 3 * time.Second
+	kMinTimeoutSamples  = 3
+)
+
+// rttEstimator smooths the round trip time of the chunks as RFC 6298 does.
+type rttEstimator struct {
+	samples int
+	srtt    time.Duration
+	rttvar  time.Duration
+	minRTT  time.Duration
+}
+
+func (e *rttEstimator) update(rtt time.Duration) {
+	if e.samples == 0 {
+		e.srtt, e.rttvar, e.minRTT = rtt, rtt/2, rtt
+	} else {
+		e.rttvar = (3*e.rttvar + (e.srtt - rtt).Abs()) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+		e.minRTT = min(e.minRTT, rtt)
+	}
+	e.samples++
+}
+
+// timeout is twice the retransmission timeout, but not longer than the limit of `-t`.
+func (e *rttEstimator) timeout(limit time.Duration) time.Duration {
+	if e.samples < kMinTimeoutSamples {
+		return limit
+	}
+	timeout := max(2*(e.srtt+4*e.rttvar), kMinAdaptiveTimeout)
+	if limit > 0 {
+		timeout = min(timeout, limit)
+	}
+	return timeout
+}
+
+// congestionControl adapts the chunk size and the number of chunks in flight to the
+// round trip time and the delivery rate, instead of doubling and resetting the chunk size.
+type congestionControl struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	rtt      rttEstimator
+	rate     float64 // bytes per second
+	window   int
+	inflight int
+	closed   bool
+	file     int
+}
+
+func newCongestionControl() *congestionControl {
+	c := &congestionControl{window: kMinWindow}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// begin resets the chunks in flight for a new file, and stops the waiting when the ctx is done.
+func (c *congestionControl) begin(ctx context.Context) {
+	c.mutex.Lock()
+	c.file++
+	file := c.file
+	c.inflight = 0
+	c.closed = false
+	c.mutex.Unlock()
+	context.AfterFunc(ctx, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		// the previous file may be done after the next one began
+		if c.file == file {
+			c.closed = true
+			c.cond.Broadcast()
+		}
+	})
+}
+
+// acquire waits until there is room in the window for another chunk.
+func (c *congestionControl) acquire() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.inflight >= c.window && !c.closed {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return false
+	}
+	c.inflight++
+	return true
+}
+
+// release frees the room of a chunk without measuring it, e.g. the time is paused.
+func (c *congestionControl) release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.inflight = max(c.inflight-1, 0)
+	c.cond.Broadcast()
+}
+
+// onAck measures an acked chunk, adjusts the window and returns the next chunk size.
+func (c *congestionControl) onAck(length int64, rtt time.Duration, chunkSize, maxChunkSize int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	defer c.cond.Broadcast()
+
+	inflight := max(c.inflight, 1)
+	c.inflight = max(c.inflight-1, 0)
+	c.rtt.update(rtt)
+	// the chunks in flight share the round trip, and the link is not slower than measured recently
+	rate := float64(length) * float64(inflight) / max(rtt, time.Millisecond).Seconds()
+	c.rate = max(rate, c.rate*0.9)
+
+	next := chunkSize
+	if length >= chunkSize { // the last chunk of a file may be smaller
+		chunkTime := min(max(c.rtt.minRTT, kMinChunkTime), kMaxChunkTime)
+		target := c.rate * chunkTime.Seconds()
+		if c.rtt.srtt < 2*c.rtt.minRTT+kMinChunkTime {
+			target *= 2 // no queueing yet, probe for more bandwidth
+		}
+		next = min(max(int64(target), kMinChunkSize), 2*chunkSize, maxChunkSize)
+	}
+
+	// keep about twice the bandwidth-delay product in flight
+	bdp := c.rate * c.rtt.minRTT.Seconds()
+	c.window = min(max(int(2*bdp/float64(next))+kMinWindow, kMinWindow), kMaxWindow)
+	return next
+}
+
+func (c *congestionControl) timeout(limit time.Duration) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rtt.timeout(limit)
+}
+
+func (t *trzszTransfer) isRTTPacing() bool {
+	return t.transferConfig.Protocol >= kProtocolVersion15 && t.transferConfig.Pacing != kPacingFixed
+}
+
+// beginPacing prepares the congestion control for a file, or returns nil for the fixed pacing.
+func (t *trzszTransfer) beginPacing(ctx context.Context) *congestionControl {
+	if !t.isRTTPacing() {
+		return nil
+	}
+	if t.congestion == nil {
+		t.congestion = newCongestionControl()
+	}
+	t.congestion.begin(ctx)
+	return t.congestion
+}
+
+// getPipelineTimeout derives the timeout from the round trip time while pacing by RTT, but not later than the
+// deadline of `-t`. The chunk is resent when it times out before the deadline, see isAckRetransmittable.
+func (t *trzszTransfer) getPipelineTimeout(deadline time.Time) <-chan time.Time {
+	if t.congestion == nil || !t.isRTTPacing() || t.transferConfig.Timeout <= 0 {
+		return t.getNewTimeout()
+	}
+	return time.NewTimer(t.congestion.timeout(max(time.Until(deadline), time.Millisecond))).C
+}
+
+func (t *trzszTransfer) getAckDeadline() time.Time {
+	return time.Now().Add(time.Duration(t.transferConfig.Timeout) * time.Second)
+}
+
+// isAckRetransmittable returns whether the ack timed out by the round trip time only, so the chunk is resent
+// instead of giving up. A slow receiver is not fatal until the deadline of `-t`.
+func (t *trzszTransfer) isAckRetransmittable(err error, deadline time.Time) bool {
+	return err == errReceiveDataTimeout && t.congestion != nil && t.isRTTPacing() &&
+		t.transferConfig.Timeout > 0 && time.Now().Before(deadline)
+}
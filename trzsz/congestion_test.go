@@ -0,0 +1,232 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	assert := assert.New(t)
+
+	var e rttEstimator
+	assert.Equal(20*time.Second, e.timeout(20*time.Second))
+
+	e.update(100 * time.Millisecond)
+	assert.Equal(100*time.Millisecond, e.srtt)
+	assert.Equal(50*time.Millisecond, e.rttvar)
+
+	e.update(300 * time.Millisecond)
+	assert.Equal(125*time.Millisecond, e.srtt)
+	assert.Equal(87500*time.Microsecond, e.rttvar)
+	assert.Equal(100*time.Millisecond, e.minRTT)
+	assert.Equal(20*time.Second, e.timeout(20*time.Second), "not enough samples")
+
+	e.update(125 * time.Millisecond)
+	assert.Equal(kMinAdaptiveTimeout, e.timeout(20*time.Second))
+
+	for range 10 {
+		e.update(2 * time.Second)
+	}
+	assert.Equal(5*time.Second, e.timeout(5*time.Second))
+	assert.Greater(e.timeout(0), 5*time.Second)
+}
+
+func TestCongestionControl(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newCongestionControl()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.begin(ctx)
+
+	// a fast link grows the chunk size and the window
+	chunkSize := int64(kMinChunkSize)
+	for range 10 {
+		assert.True(c.acquire())
+		next := c.onAck(chunkSize, 10*time.Millisecond, chunkSize, 1024*1024)
+		assert.LessOrEqual(next, 2*chunkSize)
+		chunkSize = next
+	}
+	assert.Equal(int64(1024*1024), chunkSize)
+	assert.Greater(c.window, kMinWindow)
+
+	// a queueing link stops probing for more bandwidth
+	for range 20 {
+		assert.True(c.acquire())
+		chunkSize = c.onAck(chunkSize, 2*time.Second, chunkSize, 1024*1024)
+	}
+	assert.Less(chunkSize, int64(1024*1024))
+	assert.GreaterOrEqual(chunkSize, int64(kMinChunkSize))
+
+	// the window blocks until the ctx is done
+	for c.acquire() {
+		if c.inflight >= c.window {
+			break
+		}
+	}
+	done := make(chan bool, 1)
+	go func() { done <- c.acquire() }()
+	select {
+	case <-done:
+		assert.Fail("acquire should wait for the window")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	assert.False(<-done)
+
+	// the done ctx of the previous file doesn't stop the next one
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	c.begin(ctx2)
+	assert.True(c.acquire())
+}
+
+func TestPacingTransfer(t *testing.T) {
+	for _, pacing := range []pacingMode{kPacingRTT, kPacingFixed} {
+		t.Run(string(pacing), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			srcPath, err := os.MkdirTemp("", "trzsz_test_")
+			require.Nil(err)
+			defer func() { _ = os.RemoveAll(srcPath) }()
+			dstPath, err := os.MkdirTemp("", "trzsz_test_")
+			require.Nil(err)
+			defer func() { _ = os.RemoveAll(dstPath) }()
+
+			random := rand.New(rand.NewSource(7))
+			contents := map[string][]byte{"a.bin": make([]byte, 3*1024*1024), "b.bin": make([]byte, 100)}
+			var paths []string
+			for _, name := range []string{"a.bin", "b.bin"} {
+				random.Read(contents[name])
+				paths = append(paths, filepath.Join(srcPath, name))
+				require.Nil(os.WriteFile(paths[len(paths)-1], contents[name], 0644))
+			}
+			files, err := checkPathsReadable(paths, false, false, nil)
+			require.Nil(err)
+
+			sender, receiver := newTransferPair(kProtocolVersion)
+			for _, transfer := range []*trzszTransfer{sender, receiver} {
+				transfer.transferConfig.CompressType = kCompressNo
+				transfer.transferConfig.Pacing = pacing
+				transfer.transferConfig.MaxBufSize = 1024 * 1024
+			}
+			remoteNames, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+			assert.Equal([]string{"a.bin", "b.bin"}, remoteNames)
+			assert.Equal([]string{"a.bin", "b.bin"}, localNames)
+			for name, content := range contents {
+				buf, err := os.ReadFile(filepath.Join(dstPath, name))
+				require.Nil(err)
+				assert.True(bytes.Equal(content, buf))
+			}
+			assert.Equal(pacing == kPacingRTT, sender.congestion != nil)
+		})
+	}
+}
+
+// slowAckWriter delays the nth ack, as the receiver is stalled by a slow disk.
+type slowAckWriter struct {
+	writer  io.Writer
+	delayAt int
+	delay   time.Duration
+	acks    int
+}
+
+func (w *slowAckWriter) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("#SUCC:")) {
+		w.acks++
+		if w.acks == w.delayAt {
+			time.Sleep(w.delay)
+		}
+	}
+	return w.writer.Write(p)
+}
+
+func TestPacingSlowReceiver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	content := make([]byte, 256*1024)
+	rand.New(rand.NewSource(8)).Read(content)
+	srcFile := filepath.Join(srcPath, "a.bin")
+	require.Nil(os.WriteFile(srcFile, content, 0644))
+	files, err := checkPathsReadable([]string{srcFile}, false, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		transfer.transferConfig.CompressType = kCompressNo
+		transfer.transferConfig.Timeout = 10
+		transfer.transferConfig.MaxBufSize = 8 * 1024
+	}
+	// the ack is later than the timeout derived from the round trip time, but earlier than `-t`
+	receiver.writer = &slowAckWriter{writer: receiver.writer, delayAt: 10, delay: kMinAdaptiveTimeout + time.Second}
+	_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+	assert.Equal([]string{"a.bin"}, localNames)
+	assertFileEqual(t, srcFile, filepath.Join(dstPath, "a.bin"))
+}
+
+func TestPacingConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	transfer := newTransfer(newTestWriter(t), nil)
+	args := &baseArgs{Bufsize: bufferSize{1024}, Timeout: 10}
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion}, nil, noTmuxMode, 0))
+	assert.Equal(pacingMode(""), transfer.transferConfig.Pacing)
+	assert.True(transfer.isRTTPacing())
+
+	transfer = newTransfer(newTestWriter(t), nil)
+	args.Pacing = kPacingFixed
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion}, nil, noTmuxMode, 0))
+	assert.Equal(kPacingFixed, transfer.transferConfig.Pacing)
+	assert.False(transfer.isRTTPacing())
+
+	transfer = newTransfer(newTestWriter(t), nil)
+	args.Pacing = ""
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion14}, nil, noTmuxMode, 0))
+	assert.False(transfer.isRTTPacing())
+
+	var mode pacingMode
+	assert.Nil(mode.UnmarshalText([]byte("Fixed")))
+	assert.Equal(kPacingFixed, mode)
+	assert.NotNil(mode.UnmarshalText([]byte("bbr")))
+}
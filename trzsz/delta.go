@@ -0,0 +1,501 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sync"
+)
+
+const (
+	kDeltaMinBasisSize = 64 * 1024
+	kDeltaMinBlockSize = 2 * 1024
+	kDeltaMaxBlockSize = 128 * 1024
+	kDeltaMaxLiteral   = 256 * 1024
+	kDeltaSigsPerBatch = 1024
+)
+
+// the delta data is a sequence of the following operations
+const (
+	kDeltaLiteral = 'L' // uvarint length, followed by the literal data
+	kDeltaCopy    = 'C' // uvarint block index, uvarint block count, copied from the basis file
+	kDeltaHash    = 'H' // uvarint length, followed by the digest of the whole file, always the last one
+)
+
+// rollingChecksum is the weak checksum of rsync, which can be rolled forward by one byte cheaply.
+func rollingChecksum(buf []byte) (uint32, uint32) {
+	var a, b uint32
+	n := uint32(len(buf))
+	for i, c := range buf {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a, b
+}
+
+func rollChecksum(a, b uint32, out, in byte, blockSize int) (uint32, uint32) {
+	a = a - uint32(out) + uint32(in)
+	b = b - uint32(blockSize)*uint32(out) + a
+	return a, b
+}
+
+func getWeakChecksum(a, b uint32) uint32 {
+	return (a & 0xffff) | (b << 16)
+}
+
+func getDeltaBlockSize(basis *os.File) int64 {
+	stat, err := basis.Stat()
+	if err != nil {
+		return kDeltaMinBlockSize
+	}
+	blockSize := int64(math.Sqrt(float64(stat.Size()))) &^ 1023
+	return min(max(blockSize, kDeltaMinBlockSize), kDeltaMaxBlockSize)
+}
+
+// openDeltaBasis opens the existing file which is going to be overwritten, to be the basis of a delta transfer.
+func (t *trzszTransfer) openDeltaBasis(srcFile *sourceFile, writer fileWriter) *os.File {
+	if t.transferConfig.Protocol < kProtocolVersion10 || srcFile.Stream || srcFile.Archive || srcFile.IsDir ||
+		srcFile.isSymlink() || writer == nil || writer.getFile() == nil {
+		return nil
+	}
+	targetPath := t.getTargetPath(writer)
+	if targetPath == "" {
+		return nil
+	}
+	basis, err := os.Open(targetPath)
+	if err != nil {
+		return nil
+	}
+	stat, err := basis.Stat()
+	if err != nil || !stat.Mode().IsRegular() || stat.Size() < kDeltaMinBasisSize {
+		_ = basis.Close()
+		return nil
+	}
+	return basis
+}
+
+// getDeltaSigSize returns the size of a block signature, the weak checksum followed by the negotiated digest.
+func (t *trzszTransfer) getDeltaSigSize() int {
+	return 4 + t.newHasher().Size()
+}
+
+func (t *trzszTransfer) sendDeltaSignatures(basis *os.File, blockSize int64) error {
+	reader := bufio.NewReaderSize(basis, int(min(blockSize*16, 1024*1024)))
+	block := make([]byte, blockSize)
+	hasher := t.newHasher()
+	batch := make([]byte, 0, kDeltaSigsPerBatch*t.getDeltaSigSize())
+	for {
+		// the last short block is never matched, so it has no signature
+		if _, err := io.ReadFull(reader, block); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		a, b := rollingChecksum(block)
+		batch = binary.BigEndian.AppendUint32(batch, getWeakChecksum(a, b))
+		hasher.Reset()
+		_, _ = hasher.Write(block)
+		batch = hasher.Sum(batch)
+		if len(batch) == cap(batch) {
+			if err := t.sendBinary("SIGS", batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := t.sendBinary("SIGS", batch); err != nil {
+			return err
+		}
+	}
+	return t.sendBinary("SIGS", []byte{})
+}
+
+type deltaSignatures struct {
+	blockSize int
+	filter    []bool
+	weakMap   map[uint32][]int64
+	strongs   []string
+}
+
+func (t *trzszTransfer) recvDeltaSignatures(blockSize int64) (*deltaSignatures, error) {
+	sigs := &deltaSignatures{
+		blockSize: int(blockSize),
+		filter:    make([]bool, 1<<16),
+		weakMap:   make(map[uint32][]int64),
+	}
+	sigSize := t.getDeltaSigSize()
+	for {
+		batch, err := t.recvBinary("SIGS", false, t.getNewTimeout())
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			return sigs, nil
+		}
+		if len(batch)%sigSize != 0 {
+			return nil, simpleTrzszError("Invalid signatures length: %d", len(batch))
+		}
+		for ; len(batch) > 0; batch = batch[sigSize:] {
+			weak := binary.BigEndian.Uint32(batch)
+			idx := int64(len(sigs.strongs))
+			sigs.filter[weak&0xffff] = true
+			sigs.weakMap[weak] = append(sigs.weakMap[weak], idx)
+			sigs.strongs = append(sigs.strongs, string(batch[4:sigSize]))
+		}
+	}
+}
+
+type deltaEncoder struct {
+	sigs      *deltaSignatures
+	hasher    hash.Hash
+	strong    []byte
+	writer    *bufio.Writer
+	copyStart int64
+	copyCount int64
+}
+
+func (e *deltaEncoder) match(a, b uint32, window []byte) int64 {
+	weak := getWeakChecksum(a, b)
+	if !e.sigs.filter[weak&0xffff] {
+		return -1
+	}
+	indexes := e.sigs.weakMap[weak]
+	if len(indexes) == 0 {
+		return -1
+	}
+	e.hasher.Reset()
+	_, _ = e.hasher.Write(window)
+	e.strong = e.hasher.Sum(e.strong[:0])
+	// prefer the next block of the last copy, so that they can be merged
+	if next := e.copyStart + e.copyCount; e.copyCount > 0 && slices.Contains(indexes, next) && e.sigs.strongs[next] == string(e.strong) {
+		return next
+	}
+	for _, idx := range indexes {
+		if e.sigs.strongs[idx] == string(e.strong) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (e *deltaEncoder) writeUvarint(value int64) error {
+	_, err := e.writer.Write(binary.AppendUvarint(nil, uint64(value)))
+	return err
+}
+
+func (e *deltaEncoder) flushCopy() error {
+	if e.copyCount == 0 {
+		return nil
+	}
+	if err := e.writer.WriteByte(kDeltaCopy); err != nil {
+		return err
+	}
+	if err := e.writeUvarint(e.copyStart); err != nil {
+		return err
+	}
+	if err := e.writeUvarint(e.copyCount); err != nil {
+		return err
+	}
+	e.copyCount = 0
+	return nil
+}
+
+func (e *deltaEncoder) emitCopy(idx int64) error {
+	if e.copyCount > 0 && e.copyStart+e.copyCount == idx {
+		e.copyCount++
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copyStart, e.copyCount = idx, 1
+	return nil
+}
+
+func (e *deltaEncoder) emitLiteral(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.writer.WriteByte(kDeltaLiteral); err != nil {
+		return err
+	}
+	if err := e.writeUvarint(int64(len(data))); err != nil {
+		return err
+	}
+	_, err := e.writer.Write(data)
+	return err
+}
+
+func (e *deltaEncoder) finish(data, digest []byte) error {
+	if err := e.emitLiteral(data); err != nil {
+		return err
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.writer.WriteByte(kDeltaHash); err != nil {
+		return err
+	}
+	if err := e.writeUvarint(int64(len(digest))); err != nil {
+		return err
+	}
+	if _, err := e.writer.Write(digest); err != nil {
+		return err
+	}
+	return e.writer.Flush()
+}
+
+func (e *deltaEncoder) encode(reader io.Reader, hasher hash.Hash) error {
+	bs := e.sigs.blockSize
+	br := bufio.NewReaderSize(io.TeeReader(reader, hasher), 256*1024)
+	// data is the pending literal followed by the window of the last block size bytes
+	data := make([]byte, 0, kDeltaMaxLiteral+bs)
+	var a, b uint32
+	fresh := true
+	for {
+		if fresh {
+			for len(data) < bs {
+				c, err := br.ReadByte()
+				if err == io.EOF {
+					return e.finish(data, hasher.Sum(nil))
+				} else if err != nil {
+					return err
+				}
+				data = append(data, c)
+			}
+			a, b = rollingChecksum(data[len(data)-bs:])
+			fresh = false
+		}
+
+		if idx := e.match(a, b, data[len(data)-bs:]); idx >= 0 {
+			if err := e.emitLiteral(data[:len(data)-bs]); err != nil {
+				return err
+			}
+			if err := e.emitCopy(idx); err != nil {
+				return err
+			}
+			data = data[:0]
+			fresh = true
+			continue
+		}
+
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return e.finish(data, hasher.Sum(nil))
+		} else if err != nil {
+			return err
+		}
+		out := data[len(data)-bs]
+		data = append(data, c)
+		a, b = rollChecksum(a, b, out, c, bs)
+
+		if len(data)-bs >= kDeltaMaxLiteral {
+			if err := e.emitLiteral(data[:len(data)-bs]); err != nil {
+				return err
+			}
+			data = data[:copy(data, data[len(data)-bs:])]
+		}
+	}
+}
+
+type deltaFileReader struct {
+	*streamFileReader
+	pipe   *io.PipeReader
+	size   int64
+	digest []byte
+}
+
+func (r *deltaFileReader) Close() error {
+	return r.pipe.Close()
+}
+
+// newDeltaFileReader reads the delta data of the file against the receiver's basis file.
+func (t *trzszTransfer) newDeltaFileReader(file *os.File, blockSize int64) (*deltaFileReader, error) {
+	sigs, err := t.recvDeltaSignatures(blockSize)
+	if err != nil {
+		return nil, err
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	reader := &deltaFileReader{streamFileReader: &streamFileReader{reader: pipeReader}, pipe: pipeReader}
+	go func() {
+		defer func() { _ = file.Close() }()
+		encoder := &deltaEncoder{sigs: sigs, hasher: t.newHasher(), writer: bufio.NewWriterSize(pipeWriter, 64*1024)}
+		hasher := t.newHasher()
+		counter := &countReader{reader: file}
+		if err := encoder.encode(counter, hasher); err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return
+		}
+		reader.size = counter.count
+		reader.digest = hasher.Sum(nil)
+		_ = pipeWriter.Close()
+	}()
+	return reader, nil
+}
+
+type countReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+type deltaFileWriter struct {
+	file      fileWriter
+	basis     *os.File
+	basisSize int64
+	blockSize int64
+	hasher    hash.Hash
+	hashName  string
+	pipe      *io.PipeWriter
+	done      chan struct{}
+	once      sync.Once
+	err       error
+	size      int64
+	digest    []byte
+}
+
+func (w *deltaFileWriter) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close waits for all the delta data to be applied, it can be called again to get the result.
+func (w *deltaFileWriter) Close() error {
+	w.once.Do(func() {
+		_ = w.pipe.Close()
+		<-w.done
+		_ = w.basis.Close()
+		if err := w.file.Close(); err != nil && w.err == nil {
+			w.err = err
+		}
+	})
+	return w.err
+}
+
+func (w *deltaFileWriter) getFile() *os.File {
+	return nil
+}
+
+func (w *deltaFileWriter) apply(reader io.Reader) error {
+	br := bufio.NewReaderSize(reader, 64*1024)
+	out := io.MultiWriter(w.file, w.hasher)
+	for {
+		op, err := br.ReadByte()
+		if err == io.EOF {
+			if w.digest == nil {
+				return simpleTrzszError("Delta data is incomplete")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if w.digest != nil {
+			return simpleTrzszError("Delta data after the hash")
+		}
+		switch op {
+		case kDeltaLiteral:
+			length, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(out, br, int64(length)); err != nil {
+				return err
+			}
+			w.size += int64(length)
+		case kDeltaCopy:
+			idx, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			count, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			offset, length := int64(idx)*w.blockSize, int64(count)*w.blockSize
+			if offset+length > w.basisSize {
+				return simpleTrzszError("Delta copy [%d, %d] out of the basis size [%d]", offset, length, w.basisSize)
+			}
+			if _, err := io.Copy(out, io.NewSectionReader(w.basis, offset, length)); err != nil {
+				return err
+			}
+			w.size += length
+		case kDeltaHash:
+			length, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			digest := make([]byte, length)
+			if _, err := io.ReadFull(br, digest); err != nil {
+				return err
+			}
+			if !bytes.Equal(digest, w.hasher.Sum(nil)) {
+				return simpleTrzszError("Check delta %s failed", w.hashName)
+			}
+			w.digest = digest
+		default:
+			return simpleTrzszError("Unknown delta operation: %d", op)
+		}
+	}
+}
+
+// newDeltaFileWriter rebuilds the file from the delta data and the basis file.
+func (t *trzszTransfer) newDeltaFileWriter(file fileWriter, basis *os.File, blockSize int64) (*deltaFileWriter, error) {
+	stat, err := basis.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	writer := &deltaFileWriter{
+		file:      file,
+		basis:     basis,
+		basisSize: stat.Size(),
+		blockSize: blockSize,
+		hasher:    t.newHasher(),
+		hashName:  t.hashName(),
+		pipe:      pipeWriter,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(writer.done)
+		writer.err = writer.apply(pipeReader)
+		_ = pipeReader.CloseWithError(writer.err)
+	}()
+	return writer, nil
+}
@@ -0,0 +1,151 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollingChecksum(t *testing.T) {
+	assert := assert.New(t)
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+	blockSize := 2048
+	a, b := rollingChecksum(data[:blockSize])
+	for i := 1; i+blockSize <= len(data); i++ {
+		a, b = rollChecksum(a, b, data[i-1], data[i+blockSize-1], blockSize)
+		expectA, expectB := rollingChecksum(data[i : i+blockSize])
+		if !assert.Equal(getWeakChecksum(expectA, expectB), getWeakChecksum(a, b)) {
+			return
+		}
+	}
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return w.writer.Write(p)
+}
+
+func TestDeltaTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	random := rand.New(rand.NewSource(2))
+	basis := make([]byte, 1024*1024)
+	random.Read(basis)
+	insert := make([]byte, 1000)
+	random.Read(insert)
+	content := bytes.Clone(basis)
+	content[100] ^= 0xff
+	content = append(content[:500000], append(insert, content[500000:]...)...)
+	content = append(content, insert...)
+	srcFile := filepath.Join(srcPath, "a.bin")
+	dstFile := filepath.Join(dstPath, "a.bin")
+	require.Nil(os.WriteFile(srcFile, content, 0644))
+
+	for _, test := range []struct {
+		protocol int
+		hash     string
+	}{
+		{kProtocolVersion9, kHashMD5},
+		{kProtocolVersion, kHashMD5},
+		{kProtocolVersion, kHashSHA256},
+	} {
+		protocol := test.protocol
+		require.Nil(os.WriteFile(dstFile, basis, 0644))
+		files, err := checkPathsReadable([]string{srcFile}, false, false, nil)
+		require.Nil(err)
+		sender, receiver := newTransferPair(protocol)
+		sender.transferConfig.Hash = test.hash
+		receiver.transferConfig.Hash = test.hash
+		counter := &countingWriter{writer: sender.writer}
+		sender.writer = counter
+		receiver.transferConfig.OnConflict = kConflictOverwrite
+		receiver.report = &transferReport{}
+		_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+		assert.Equal([]string{"a.bin"}, localNames)
+		buf, err := os.ReadFile(dstFile)
+		require.Nil(err)
+		assert.True(bytes.Equal(content, buf))
+		require.Len(receiver.report.Files, 1)
+		assert.Equal(int64(len(content)), receiver.report.Files[0].Size)
+		if protocol < kProtocolVersion10 {
+			assert.Greater(counter.count, int64(len(content)))
+		} else {
+			assert.Less(counter.count, int64(len(content)/10))
+		}
+	}
+}
+
+func TestDeltaCorruptedBasis(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	basis := make([]byte, 100*1024)
+	rand.New(rand.NewSource(3)).Read(basis)
+	basisPath := filepath.Join(testPath, "basis")
+	require.Nil(os.WriteFile(basisPath, basis, 0644))
+
+	transfer := newTransfer(nil, nil)
+	for _, data := range [][]byte{
+		{kDeltaCopy, 99, 1},     // out of the basis
+		{kDeltaLiteral, 3, 'a'}, // incomplete
+		{kDeltaHash, 1, 0},      // hash mismatch
+		{'X'},                   // unknown operation
+		{kDeltaLiteral, 1, 'a'}, // without hash
+	} {
+		file, err := os.Open(basisPath)
+		require.Nil(err)
+		writer, err := transfer.newDeltaFileWriter(&streamFileWriter{io.Discard}, file, 2048)
+		require.Nil(err)
+		_, _ = writer.Write(data)
+		assert.NotNil(writer.Close())
+		assert.NotNil(writer.Close())
+	}
+}
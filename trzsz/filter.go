@@ -34,6 +34,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -54,10 +55,16 @@ type TrzszOptions struct {
 	// DetectTraceLog is for debugging.
 	// If DetectTraceLog is true, will detect the server output to determine whether to enable trace logging.
 	DetectTraceLog bool
-	// EnableZmodem enable zmodem lrzsz ( rz / sz ) feature.
+	// EnableZmodem enable zmodem ( rz / sz ) feature, see SetZmodemEngine, and xmodem / ymodem as well.
 	EnableZmodem bool
 	// EnableOSC52 enable OSC52 clipboard feature.
 	EnableOSC52 bool
+	// ManualTransfer is for transferring by Download and Upload only.
+	// If ManualTransfer is true, trz / tsz will wait for Download or Upload instead of opening the dialogs.
+	ManualTransfer bool
+	// TriggerSecret is an optional per-session secret, which should be set as LC_TRZSZ_SECRET on the server.
+	// If TriggerSecret is not empty, will ignore the trz / tsz triggers which are not authenticated by it.
+	TriggerSecret string
 }
 
 // TrzszFilter is a filter that supports trzsz ( trz / tsz ).
@@ -69,7 +76,7 @@ type TrzszFilter struct {
 	options               TrzszOptions
 	transfer              atomic.Pointer[trzszTransfer]
 	zmodem                atomic.Pointer[zmodemTransfer]
-	progress              atomic.Pointer[textProgressBar]
+	progress              atomic.Pointer[multiProgress]
 	trigger               *trzszTrigger
 	dragFiles             atomic.Pointer[[]string]
 	dragInputBuffer       *bytes.Buffer
@@ -87,8 +94,16 @@ type TrzszFilter struct {
 	transferStateCallback atomic.Pointer[func(bool)]
 	osc52Sequence         *bytes.Buffer
 	progressColorPair     atomic.Pointer[string]
+	progressStyle         atomic.Pointer[string]
+	preserveSymlinks      atomic.Pointer[bool]
+	bandwidthLimit        atomic.Pointer[int64]
+	retryCount            atomic.Pointer[int32]
+	zmodemEngine          atomic.Pointer[string]
+	includePatterns       atomic.Pointer[[]string]
+	excludePatterns       atomic.Pointer[[]string]
 	oneTimeUploadFiles    []string
 	oneTimeUploadResult   chan error
+	transferRequests      chan *transferRequest
 	hidingCursor          bool
 	closed                atomic.Bool
 }
@@ -114,6 +129,8 @@ func NewTrzszFilter(clientIn io.Reader, clientOut io.WriteCloser,
 		serverIn:  serverIn,
 		serverOut: serverOut,
 		options:   options,
+
+		transferRequests: make(chan *transferRequest),
 	}
 	if options.DetectTraceLog {
 		filter.logger = newTraceLogger()
@@ -154,7 +171,8 @@ func (filter *TrzszFilter) UploadFiles(filePaths []string) error {
 		if err != nil {
 			return err
 		}
-		if _, err := checkPathsReadable([]string{path}, info.IsDir()); err != nil {
+		if _, err := checkPathsReadable([]string{path}, info.IsDir(), filter.isPreserveSymlinks(),
+			filter.getPathFilter()); err != nil {
 			return err
 		}
 		if info.IsDir() {
@@ -181,7 +199,8 @@ func (filter *TrzszFilter) OneTimeUpload(filePaths []string) (<-chan error, erro
 		if err != nil {
 			return nil, err
 		}
-		if _, err := checkPathsReadable([]string{path}, info.IsDir()); err != nil {
+		if _, err := checkPathsReadable([]string{path}, info.IsDir(), filter.isPreserveSymlinks(),
+			filter.getPathFilter()); err != nil {
 			return nil, err
 		}
 	}
@@ -248,6 +267,73 @@ func (filter *TrzszFilter) SetProgressColorPair(colorPair string) {
 	filter.progressColorPair.Store(&colorPair)
 }
 
+// SetProgressStyle sets how to show the progress, a comma separated list of:
+// bar (the default), compact (a short line for the narrow tmux panes), log (a plain line periodically),
+// and osc (the OSC 9;4 sequences for the taskbar progress of the terminals which support it).
+func (filter *TrzszFilter) SetProgressStyle(style string) {
+	filter.progressStyle.Store(&style)
+}
+
+// SetPreserveSymlinks sets whether to transfer symlinks as links instead of following them.
+// It takes effect only if the server supports it and transfers directories.
+func (filter *TrzszFilter) SetPreserveSymlinks(preserve bool) {
+	filter.preserveSymlinks.Store(&preserve)
+}
+
+// SetBandwidthLimit sets the max transfer speed in bytes per second, 0 means no limit.
+// If both sides set a limit, the smaller one takes effect.
+func (filter *TrzszFilter) SetBandwidthLimit(rate int64) {
+	filter.bandwidthLimit.Store(&rate)
+}
+
+// SetRetryCount sets how many times to retry automatically after a recoverable failure, 0 means never retry.
+// The partial file is resumed while retrying. If both sides set a count, the larger one takes effect.
+func (filter *TrzszFilter) SetRetryCount(count int32) {
+	filter.retryCount.Store(&count)
+}
+
+// SetZmodemEngine sets how to run the local `rz` / `sz` when EnableZmodem is true:
+// native (the default) to transfer by the builtin zmodem, or lrzsz to run the `rz` / `sz` binaries.
+func (filter *TrzszFilter) SetZmodemEngine(engine string) {
+	filter.zmodemEngine.Store(&engine)
+}
+
+func (filter *TrzszFilter) isZmodemNative() bool {
+	if engine := filter.zmodemEngine.Load(); engine != nil {
+		return strings.ToLower(*engine) != "lrzsz"
+	}
+	return true
+}
+
+// SetIncludePatterns sets the patterns of the files to upload in directories, same as `tsz --include`.
+// If the server sets the patterns too, the files should match both of them.
+func (filter *TrzszFilter) SetIncludePatterns(patterns []string) {
+	filter.includePatterns.Store(&patterns)
+}
+
+// SetExcludePatterns sets the patterns of the entries to skip while uploading directories, same as `tsz --exclude`.
+func (filter *TrzszFilter) SetExcludePatterns(patterns []string) {
+	filter.excludePatterns.Store(&patterns)
+}
+
+func (filter *TrzszFilter) getPathFilter() *pathFilter {
+	var includes, excludes []string
+	if patterns := filter.includePatterns.Load(); patterns != nil {
+		includes = *patterns
+	}
+	if patterns := filter.excludePatterns.Load(); patterns != nil {
+		excludes = *patterns
+	}
+	return newPathFilter(includes, excludes)
+}
+
+func (filter *TrzszFilter) isPreserveSymlinks() bool {
+	if preserve := filter.preserveSymlinks.Load(); preserve != nil {
+		return *preserve
+	}
+	return false
+}
+
 // SetTunnelConnector sets the connector for tunnel transferring.
 func (filter *TrzszFilter) SetTunnelConnector(connector func(int) net.Conn) {
 	if connector == nil {
@@ -315,6 +401,25 @@ func (filter *TrzszFilter) readTrzszConfig() {
 			filter.SetDragFileUploadCommand(value)
 		case name == "progresscolorpair" && filter.progressColorPair.Load() == nil:
 			filter.SetProgressColorPair(value)
+		case name == "progressstyle" && filter.progressStyle.Load() == nil:
+			filter.SetProgressStyle(value)
+		case name == "preservesymlinks" && filter.preserveSymlinks.Load() == nil:
+			filter.SetPreserveSymlinks(strings.ToLower(value) == "true")
+		case name == "bandwidthlimit" && filter.bandwidthLimit.Load() == nil:
+			var limit bandwidthLimit
+			if err := limit.UnmarshalText([]byte(value)); err == nil {
+				filter.SetBandwidthLimit(limit.Rate)
+			}
+		case name == "zmodemengine" && filter.zmodemEngine.Load() == nil:
+			filter.SetZmodemEngine(value)
+		case name == "include" && filter.includePatterns.Load() == nil:
+			filter.SetIncludePatterns(splitPatterns(value))
+		case name == "exclude" && filter.excludePatterns.Load() == nil:
+			filter.SetExcludePatterns(splitPatterns(value))
+		case name == "retrycount" && filter.retryCount.Load() == nil:
+			if count, err := strconv.ParseInt(value, 10, 32); err == nil && count >= 0 {
+				filter.SetRetryCount(int32(count))
+			}
 		}
 	}
 }
@@ -417,23 +522,55 @@ func (filter *TrzszFilter) createProgressBar(quiet bool, tmuxPaneColumns int32)
 		filter.progress.Store(nil)
 		return
 	}
+	filter.progress.Store(filter.newProgressRenderers(tmuxPaneColumns, filter.trigger.tmuxPrefix))
+}
+
+func (filter *TrzszFilter) newProgressRenderers(tmuxPaneColumns int32, tmuxPrefix string) *multiProgress {
 	colorPair := ""
 	if color := filter.progressColorPair.Load(); color != nil {
 		colorPair = *color
 	}
-	filter.progress.Store(newTextProgressBar(filter.clientOut, filter.options.TerminalColumns,
-		tmuxPaneColumns, filter.trigger.tmuxPrefix, colorPair))
+	var styles []string
+	if style := filter.progressStyle.Load(); style != nil {
+		styles = parseProgressStyle(*style)
+	}
+	if len(styles) == 0 {
+		styles = []string{kProgressBar}
+	}
+	columns := filter.options.TerminalColumns
+	progress := &multiProgress{}
+	for _, style := range styles {
+		switch style {
+		case kProgressBar:
+			progress.renderers = append(progress.renderers,
+				newTextProgressBar(filter.clientOut, columns, tmuxPaneColumns, tmuxPrefix, colorPair))
+		case kProgressCompact:
+			progress.renderers = append(progress.renderers,
+				newCompactProgressBar(filter.clientOut, columns, tmuxPaneColumns, tmuxPrefix))
+		case kProgressLog:
+			progress.renderers = append(progress.renderers, newLogProgress(filter.clientOut, tmuxPrefix))
+		case kProgressOSC:
+			progress.renderers = append(progress.renderers, newOscProgress(filter.clientOut, tmuxPrefix))
+		}
+	}
+	return progress
 }
 
 func (filter *TrzszFilter) resetProgressBar() {
 	if progress := filter.progress.Load(); progress != nil {
-		progress.showCursor()
+		progress.finish()
 	}
 	filter.progress.Store(nil)
 }
 
-func (filter *TrzszFilter) downloadFiles(transfer *trzszTransfer) error {
-	path, err := filter.chooseDownloadPath()
+func (filter *TrzszFilter) downloadFiles(transfer *trzszTransfer, req *transferRequest) error {
+	var path string
+	var err error
+	if req != nil {
+		path = req.destPath
+	} else {
+		path, err = filter.chooseDownloadPath()
+	}
 	if err == errUserCanceled {
 		return transfer.sendAction(false, filter.trigger.version, filter.trigger.winServer)
 	}
@@ -451,27 +588,51 @@ func (filter *TrzszFilter) downloadFiles(transfer *trzszTransfer) error {
 	if err != nil {
 		return err
 	}
+	if req != nil && req.options.Overwrite {
+		config.Overwrite = true
+		config.OnConflict = kConflictOverwrite
+	}
+	if err := transfer.connectWorkers(); err != nil {
+		return err
+	}
 
-	filter.createProgressBar(config.Quiet, config.TmuxPaneColumns)
-	defer filter.resetProgressBar()
+	var progress progressCallback
+	if req != nil {
+		progress = req.getProgress()
+	} else {
+		filter.createProgressBar(config.Quiet, config.TmuxPaneColumns)
+		defer filter.resetProgressBar()
+		filter.progress.Load().setSpeedLimit(config.BwLimit)
+		progress = filter.progress.Load()
+	}
 
-	localNames, err := transfer.recvFiles(path, filter.progress.Load())
+	localNames, err := transfer.recvFilesWithRetry(path, progress, true)
 	if err != nil {
 		return err
 	}
 
-	return transfer.clientExit(formatSavedFiles(localNames, path))
+	return transfer.clientExit(formatSavedFiles(localNames, transfer.skippedFiles, path) +
+		formatSyncedFiles(transfer.unchangedFiles, transfer.deletedFiles))
 }
 
-func (filter *TrzszFilter) uploadFiles(transfer *trzszTransfer, directory bool) error {
-	paths, err := filter.chooseUploadPaths(directory)
+func (filter *TrzszFilter) uploadFiles(transfer *trzszTransfer, directory bool, req *transferRequest) error {
+	var paths []string
+	var err error
+	if req != nil {
+		paths = req.paths
+		directory = directory && req.options.Directory
+	} else {
+		paths, err = filter.chooseUploadPaths(directory)
+	}
 	if err == errUserCanceled {
 		return transfer.sendAction(false, filter.trigger.version, filter.trigger.winServer)
 	}
 	if err != nil {
 		return err
 	}
-	files, err := checkPathsReadable(paths, directory)
+	links := directory && filter.isPreserveSymlinks()
+	clientFilter := filter.getPathFilter()
+	files, err := checkPathsReadable(paths, directory, links, clientFilter)
 	if err != nil {
 		return err
 	}
@@ -483,21 +644,41 @@ func (filter *TrzszFilter) uploadFiles(transfer *trzszTransfer, directory bool)
 	if err != nil {
 		return err
 	}
+	if err := transfer.connectWorkers(); err != nil {
+		return err
+	}
+
+	// the server may ask to transfer symlinks as links, or to filter the directories
+	if config.Links != links || len(config.Include) > 0 || len(config.Exclude) > 0 {
+		files, err = checkPathsReadable(paths, directory, config.Links,
+			clientFilter.and(newPathFilter(config.Include, config.Exclude)))
+		if err != nil {
+			return err
+		}
+	}
 
-	if config.Overwrite {
+	if config.getConflictPolicy() != kConflictRename {
 		if err := checkDuplicateNames(files); err != nil {
 			return err
 		}
 	}
 
-	filter.createProgressBar(config.Quiet, config.TmuxPaneColumns)
-	defer filter.resetProgressBar()
+	var progress progressCallback
+	if req != nil {
+		progress = req.getProgress()
+	} else {
+		filter.createProgressBar(config.Quiet, config.TmuxPaneColumns)
+		defer filter.resetProgressBar()
+		filter.progress.Load().setSpeedLimit(config.BwLimit)
+		progress = filter.progress.Load()
+	}
 
-	remoteNames, err := transfer.sendFiles(files, filter.progress.Load())
+	remoteNames, err := transfer.sendFilesWithRetry(files, progress, true)
 	if err != nil {
 		return err
 	}
-	return transfer.clientExit(formatSavedFiles(remoteNames, ""))
+	return transfer.clientExit(formatSavedFiles(remoteNames, transfer.skippedFiles, "") +
+		formatSyncedFiles(transfer.unchangedFiles, transfer.deletedFiles))
 }
 
 func (filter *TrzszFilter) handleTrzsz() {
@@ -515,12 +696,19 @@ func (filter *TrzszFilter) handleTrzsz() {
 	if callback := filter.transferStateCallback.Load(); callback != nil {
 		go (*callback)(true)
 	}
+	// the request of Download or Upload is finished after the filter is ready for the next transfer
+	var req *transferRequest
+	var reqErr error
+	finishRequest := false
 	defer func() {
 		if filter.transfer.CompareAndSwap(transfer, nil) {
 			if callback := filter.transferStateCallback.Load(); callback != nil {
 				go (*callback)(false)
 			}
 		}
+		if finishRequest && req != nil {
+			req.finish(transfer, reqErr)
+		}
 	}()
 
 	if connector := filter.tunnelConnector.Load(); connector != nil {
@@ -532,19 +720,34 @@ func (filter *TrzszFilter) handleTrzsz() {
 		defer close(done)
 		defer func() {
 			if err := recover(); err != nil {
-				transfer.clientError(newTrzszError(fmt.Sprintf("%v", err), "panic", true))
+				reqErr = newTrzszError(fmt.Sprintf("%v", err), "panic", true)
+				transfer.clientError(reqErr)
 			}
 		}()
 		var err error
-		switch filter.trigger.mode {
-		case 'S':
-			err = filter.downloadFiles(transfer)
-		case 'R':
-			err = filter.uploadFiles(transfer, false)
-			filter.setOneTimeUploadResult(err)
-		case 'D':
-			err = filter.uploadFiles(transfer, true)
-			filter.setOneTimeUploadResult(err)
+		req, err = filter.acceptTransferRequest(transfer)
+		if req != nil {
+			if reqErr = req.checkMode(filter.trigger.mode); reqErr != nil {
+				err = reqErr
+			} else {
+				transfer.report = newTransferReport("trzsz", req.destPath)
+			}
+		}
+		if err != nil {
+			// cancel the transfer if there is no request to answer it
+			err = transfer.sendAction(false, filter.trigger.version, filter.trigger.winServer)
+		} else {
+			switch filter.trigger.mode {
+			case 'S':
+				err = filter.downloadFiles(transfer, req)
+			case 'R':
+				err = filter.uploadFiles(transfer, false, req)
+				filter.setOneTimeUploadResult(err)
+			case 'D':
+				err = filter.uploadFiles(transfer, true, req)
+				filter.setOneTimeUploadResult(err)
+			}
+			reqErr = err
 		}
 		if err != nil {
 			transfer.clientError(err)
@@ -555,7 +758,14 @@ func (filter *TrzszFilter) handleTrzsz() {
 
 	select {
 	case <-done:
+		finishRequest = true
 	case <-transfer.background():
+		go func() {
+			<-done
+			if req != nil {
+				req.finish(transfer, reqErr)
+			}
+		}()
 	}
 	transfer.tmuxAckWaitGroup.Wait()
 }
@@ -711,6 +921,7 @@ func (filter *TrzszFilter) wrapOutput() {
 	const bufSize = 32 * 1024
 	buffer := make([]byte, bufSize)
 	detector := newTrzszDetector(false, false)
+	detector.secret = filter.options.TriggerSecret
 	for {
 		n, err := filter.serverOut.Read(buffer)
 		if n > 0 {
@@ -730,6 +941,9 @@ func (filter *TrzszFilter) wrapOutput() {
 					} else {
 						showCursor(filter.clientOut)
 						filter.hidingCursor = false
+						if zmodem.progress != nil {
+							filter.progress.CompareAndSwap(zmodem.progress, nil)
+						}
 						if filter.zmodem.CompareAndSwap(zmodem, nil) {
 							if callback := filter.transferStateCallback.Load(); callback != nil {
 								go (*callback)(false)
@@ -763,10 +977,19 @@ func (filter *TrzszFilter) wrapOutput() {
 			}
 
 			if filter.options.EnableZmodem {
-				if zmodem := detectZmodem(buf); zmodem != nil {
+				zmodem := detectZmodem(buf)
+				if zmodem == nil {
+					zmodem = detectXYmodem(buf)
+				}
+				if zmodem != nil {
 					_ = writeAll(filter.clientOut, buf)
 					zmodem.redrawScreen = filter.redrawScreenFunc.Load()
 					if filter.zmodem.CompareAndSwap(nil, zmodem) {
+						if zmodem.protocol != "" || filter.isZmodemNative() {
+							zmodem.native = true
+							zmodem.progress = filter.newProgressRenderers(0, "")
+							filter.progress.Store(zmodem.progress)
+						}
 						if callback := filter.transferStateCallback.Load(); callback != nil {
 							go (*callback)(true)
 						}
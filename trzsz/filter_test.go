@@ -25,8 +25,17 @@ SOFTWARE.
 package trzsz
 
 import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDetectOSC52(t *testing.T) {
@@ -109,3 +118,209 @@ func TestDetectOSC52(t *testing.T) {
 	filter.detectOSC52([]byte("\x1b]52;c;ABC\a"))
 	writer.assertBufferEqual(0, "ABC")
 }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newTestServer returns a filter connected to a server transfer, like running trz / tsz on the server.
+func newTestServer(t *testing.T, options TrzszOptions) (*TrzszFilter, *trzszTransfer, io.Writer) {
+	t.Helper()
+	serverInReader, serverInWriter := io.Pipe()
+	serverOutReader, serverOutWriter := io.Pipe()
+	clientInReader, clientInWriter := io.Pipe()
+	filter := NewTrzszFilter(clientInReader, nopWriteCloser{io.Discard}, serverInWriter, serverOutReader, options)
+	server := newTransfer(serverOutWriter, nil)
+	wrapTransferInput(server, serverInReader, false)
+	t.Cleanup(func() {
+		filter.Close()
+		_ = clientInWriter.Close()
+		_ = serverOutWriter.Close()
+		_ = serverInReader.Close()
+	})
+	return filter, server, serverOutWriter
+}
+
+func TestTransferAPI(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "dir"), 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "a.txt"), []byte("new content"), 0644))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "dir", "b.txt"), []byte("b"), 0644))
+	require.Nil(os.WriteFile(filepath.Join(dstPath, "a.txt"), []byte("old"), 0644))
+
+	filter, server, serverOut := newTestServer(t, TrzszOptions{ManualTransfer: true})
+
+	// tsz a.txt
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			_, _ = serverOut.Write([]byte("\x1b7\x07::TRZSZ:TRANSFER:S:1.2.0:0000000000001\r\n"))
+			action, err := server.recvAction()
+			if err != nil {
+				return err
+			}
+			if err := server.sendConfig(&baseArgs{Timeout: 10}, action, nil, noTmuxMode, 0); err != nil {
+				return err
+			}
+			files, err := checkPathsReadable([]string{filepath.Join(srcPath, "a.txt")}, false, false, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := server.sendFiles(files, nil); err != nil {
+				return err
+			}
+			_, err = server.recvExit()
+			return err
+		}()
+	}()
+
+	var progresses []TransferProgress
+	results, err := filter.Download(context.Background(), dstPath, TransferOptions{
+		Overwrite: true,
+		Progress:  func(progress TransferProgress) { progresses = append(progresses, progress) },
+	})
+	require.Nil(err)
+	require.Nil(<-serverErr)
+	require.Equal(1, len(results))
+	assert.Equal("a.txt", results[0].Name)
+	assert.Equal("a.txt", results[0].SavedName)
+	assert.Equal(int64(11), results[0].Size)
+	assertFileEqual(t, filepath.Join(srcPath, "a.txt"), filepath.Join(dstPath, "a.txt"))
+	require.NotEmpty(progresses)
+	assert.Equal(TransferProgress{FileCount: 1, FileIndex: 1, FileName: "a.txt", FileSize: 11, FileStep: 11,
+		TotalSize: 11, TotalStep: 11}, progresses[len(progresses)-1])
+
+	// uploading to `tsz` is refused and cancelled
+	go func() {
+		_, _ = serverOut.Write([]byte("\x1b7\x07::TRZSZ:TRANSFER:S:1.2.0:0000000000002\r\n"))
+	}()
+	_, err = filter.Upload(context.Background(), []string{filepath.Join(srcPath, "dir")}, TransferOptions{Directory: true})
+	assert.NotNil(err)
+	action, err := server.recvAction()
+	require.Nil(err)
+	assert.False(action.Confirm)
+
+	// nothing to answer
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = filter.Download(ctx, dstPath, TransferOptions{})
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestAuthenticatedTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "a.txt")
+	require.Nil(os.WriteFile(srcPath, []byte("content"), 0644))
+
+	t.Setenv(kTrzszSecretEnv, "secret")
+	filter, server, serverOut := newTestServer(t, TrzszOptions{ManualTransfer: true, TriggerSecret: "secret"})
+
+	// e.g. `cat` a log containing the trigger
+	go func() {
+		_, _ = serverOut.Write([]byte("\x1b[s::TRZSZ:TRANSFER:S:1.2.0:0000000000100:0\r\n"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = filter.Download(ctx, testPath, TransferOptions{})
+	assert.Equal(context.DeadlineExceeded, err)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			trigger := "\x1b[s::TRZSZ:TRANSFER:S:1.2.0:0000000000200:0" + signTrzszTrigger('S', "0000000000200", 0)
+			_, _ = serverOut.Write([]byte(trigger + "\r\n"))
+			action, err := server.recvAction()
+			if err != nil {
+				return err
+			}
+			if err := server.sendConfig(&baseArgs{Timeout: 10}, action, nil, noTmuxMode, 0); err != nil {
+				return err
+			}
+			files, err := checkPathsReadable([]string{srcPath}, false, false, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := server.sendFiles(files, nil); err != nil {
+				return err
+			}
+			_, err = server.recvExit()
+			return err
+		}()
+	}()
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	results, err := filter.Download(context.Background(), dstPath, TransferOptions{})
+	require.Nil(err)
+	require.Nil(<-serverErr)
+	require.Equal(1, len(results))
+	assertFileEqual(t, srcPath, filepath.Join(dstPath, "a.txt"))
+}
+
+func TestUploadPathFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "node_modules"), 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	for _, name := range []string{"a.go", "b.go", "c.md", "debug.log", "node_modules/d.go"} {
+		require.Nil(os.WriteFile(filepath.Join(srcPath, name), []byte(name), 0644))
+	}
+
+	filter, server, serverOut := newTestServer(t, TrzszOptions{ManualTransfer: true})
+	filter.SetExcludePatterns(splitPatterns("*.log, node_modules"))
+
+	// trz -d --include '*.go'
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			_, _ = serverOut.Write([]byte("\x1b7\x07::TRZSZ:TRANSFER:D:1.2.0:0000000000001\r\n"))
+			action, err := server.recvAction()
+			if err != nil {
+				return err
+			}
+			args := &baseArgs{Timeout: 10, Directory: true, Include: []string{"*.go"}}
+			if err := server.sendConfig(args, action, nil, noTmuxMode, 0); err != nil {
+				return err
+			}
+			if _, err := server.recvFiles(dstPath, nil); err != nil {
+				return err
+			}
+			_, err = server.recvExit()
+			return err
+		}()
+	}()
+
+	_, err = filter.Upload(context.Background(), []string{srcPath}, TransferOptions{Directory: true})
+	require.Nil(err)
+	require.Nil(<-serverErr)
+	var names []string
+	require.Nil(filepath.WalkDir(filepath.Join(dstPath, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, d.Name())
+		}
+		return err
+	}))
+	assert.ElementsMatch([]string{"a.go", "b.go"}, names)
+}
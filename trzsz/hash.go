@@ -0,0 +1,96 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"hash"
+	"slices"
+	"strings"
+)
+
+const (
+	kHashMD5    = "md5"
+	kHashSHA256 = "sha256"
+)
+
+// kHashAlgorithms is ordered from the strongest to the weakest.
+var kHashAlgorithms = []string{kHashSHA256, kHashMD5}
+
+var hashConstructors = map[string]func() hash.Hash{
+	kHashMD5:    md5.New,
+	kHashSHA256: sha256.New,
+}
+
+// negotiateHash picks the strongest hash algorithm supported by both sides.
+// Older peers don't send the list, and MD5 is the only choice for them.
+func negotiateHash(peerHashes []string) string {
+	for _, name := range kHashAlgorithms {
+		if slices.Contains(peerHashes, name) {
+			return name
+		}
+	}
+	return kHashMD5
+}
+
+func (t *trzszTransfer) newHasher() hash.Hash {
+	if newHash, ok := hashConstructors[t.transferConfig.Hash]; ok {
+		return newHash()
+	}
+	return md5.New()
+}
+
+// restoreHasher creates a hasher which continues from the marshaled state.
+func (t *trzszTransfer) restoreHasher(state []byte) (hash.Hash, error) {
+	hasher := t.newHasher()
+	if len(state) == 0 {
+		return hasher, nil
+	}
+	unmarshaler, ok := hasher.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, simpleTrzszError("Restore %s state is not supported", t.hashName())
+	}
+	if err := unmarshaler.UnmarshalBinary(state); err != nil {
+		return nil, simpleTrzszError("Restore %s state failed: %v", t.hashName(), err)
+	}
+	return hasher, nil
+}
+
+func marshalHasher(hasher hash.Hash) ([]byte, error) {
+	marshaler, ok := hasher.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, simpleTrzszError("Marshal hash state is not supported")
+	}
+	return marshaler.MarshalBinary()
+}
+
+func (t *trzszTransfer) hashName() string {
+	if _, ok := hashConstructors[t.transferConfig.Hash]; ok {
+		return strings.ToUpper(t.transferConfig.Hash)
+	}
+	return "MD5"
+}
@@ -0,0 +1,53 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateHash(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(kHashMD5, negotiateHash(nil))
+	assert.Equal(kHashMD5, negotiateHash([]string{"unknown"}))
+	assert.Equal(kHashMD5, negotiateHash([]string{kHashMD5}))
+	assert.Equal(kHashSHA256, negotiateHash([]string{kHashMD5, kHashSHA256}))
+	assert.Equal(kHashSHA256, negotiateHash([]string{"unknown", kHashSHA256}))
+
+	transfer := newTransfer(nil, nil)
+	hasher := transfer.newHasher()
+	hasher.Write([]byte("trzsz"))
+	assert.Equal(16, len(hasher.Sum(nil)))
+	assert.Equal("MD5", transfer.hashName())
+
+	transfer.transferConfig.Hash = kHashSHA256
+	hasher = transfer.newHasher()
+	hasher.Write([]byte("trzsz"))
+	assert.Equal("b5c76366f85fdcb368cad5747fa87bc250281a50f75ab60fa6140b56e544a64f", hex.EncodeToString(hasher.Sum(nil)))
+	assert.Equal("SHA256", transfer.hashName())
+}
@@ -0,0 +1,241 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const kIgnoreFileName = ".trzszignore"
+
+// ignorePattern is a pattern in gitignore syntax, matched against the relative path of a file.
+type ignorePattern struct {
+	base     []string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseIgnorePattern(line string, base []string) *ignorePattern {
+	if strings.HasSuffix(line, "\r") {
+		line = line[:len(line)-1]
+	}
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	p := &ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	p.segments = strings.Split(line, "/")
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil
+		}
+	}
+	return p
+}
+
+func matchSegments(patterns, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patterns[0], names[0]); !ok {
+		return false
+	}
+	return matchSegments(patterns[1:], names[1:])
+}
+
+func (p *ignorePattern) match(relPath []string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if len(relPath) <= len(p.base) {
+		return false
+	}
+	for i, name := range p.base {
+		if relPath[i] != name {
+			return false
+		}
+	}
+	if !p.anchored {
+		return matchSegments(p.segments, relPath[len(relPath)-1:])
+	}
+	return matchSegments(p.segments, relPath[len(p.base):])
+}
+
+// pathFilter decides which entries are skipped while walking the directories to send.
+type pathFilter struct {
+	includes [][]*ignorePattern
+	excludes []*ignorePattern
+	ignores  []*ignorePattern
+}
+
+func parsePatterns(patterns []string) []*ignorePattern {
+	var result []*ignorePattern
+	for _, pattern := range patterns {
+		if p := parseIgnorePattern(pattern, nil); p != nil {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// splitPatterns splits the comma separated patterns in the config file.
+func splitPatterns(value string) []string {
+	var patterns []string
+	for pattern := range strings.SplitSeq(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func newPathFilter(includes, excludes []string) *pathFilter {
+	if len(includes) == 0 && len(excludes) == 0 {
+		return nil
+	}
+	filter := &pathFilter{excludes: parsePatterns(excludes)}
+	if len(includes) > 0 {
+		filter.includes = [][]*ignorePattern{parsePatterns(includes)}
+	}
+	return filter
+}
+
+// and returns a filter which skips the entries skipped by either of the filters.
+func (f *pathFilter) and(other *pathFilter) *pathFilter {
+	if f == nil {
+		return other
+	}
+	if other == nil {
+		return f
+	}
+	return &pathFilter{
+		includes: append(slices.Clip(f.includes), other.includes...),
+		excludes: append(slices.Clip(f.excludes), other.excludes...),
+		ignores:  append(slices.Clip(f.ignores), other.ignores...),
+	}
+}
+
+// withIgnoreFile returns a filter with the rules in the .trzszignore file of the directory, if it exists.
+// The .trzszignore files are optional, they are honored only if any --include or --exclude is given.
+func (f *pathFilter) withIgnoreFile(dirPath string, relPath []string) (*pathFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	file, err := os.Open(filepath.Join(dirPath, kIgnoreFileName))
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, simpleTrzszError("Open [%s] error: %v", filepath.Join(dirPath, kIgnoreFileName), err)
+	}
+	defer func() { _ = file.Close() }()
+	filter := *f
+	filter.ignores = slices.Clip(filter.ignores)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p := parseIgnorePattern(scanner.Text(), relPath); p != nil {
+			filter.ignores = append(filter.ignores, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, simpleTrzszError("Read [%s] error: %v", filepath.Join(dirPath, kIgnoreFileName), err)
+	}
+	return &filter, nil
+}
+
+// matchPatterns matches the path relative to the top directory to send.
+func matchPatterns(patterns []*ignorePattern, relPath []string, isDir bool) bool {
+	for _, p := range patterns {
+		if p.match(relPath[1:], isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// skip returns whether to skip the entry in the directory walk.
+// The excluded directories are not walked, and the includes only apply to files.
+func (f *pathFilter) skip(relPath []string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	ignored := false
+	for _, p := range f.ignores {
+		if p.match(relPath, isDir) {
+			ignored = !p.negate
+		}
+	}
+	if ignored {
+		return true
+	}
+	if matchPatterns(f.excludes, relPath, isDir) {
+		return true
+	}
+	if !isDir {
+		for _, includes := range f.includes {
+			if !matchPatterns(includes, relPath, isDir) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	assert := assert.New(t)
+	assertMatch := func(pattern string, path string, isDir bool, expected bool) {
+		t.Helper()
+		p := parseIgnorePattern(pattern, []string{"root"})
+		require.NotNil(t, p)
+		assert.Equal(expected, p.match(append([]string{"root"}, strings.Split(path, "/")...), isDir), pattern)
+	}
+
+	assert.Nil(parseIgnorePattern("", nil))
+	assert.Nil(parseIgnorePattern("   ", nil))
+	assert.Nil(parseIgnorePattern("# comment", nil))
+	assert.Nil(parseIgnorePattern("/", nil))
+	assert.Nil(parseIgnorePattern("[a", nil))
+	assert.True(parseIgnorePattern("!keep", nil).negate)
+	assert.False(parseIgnorePattern("\\!keep", nil).negate)
+	assert.Equal([]string{"#hash"}, parseIgnorePattern("\\#hash", nil).segments)
+
+	assertMatch("node_modules", "node_modules", true, true)
+	assertMatch("node_modules", "a/b/node_modules", true, true)
+	assertMatch("node_modules", "a/node_modules/b", false, false)
+	assertMatch("*.o", "src/main.o", false, true)
+	assertMatch("*.o", "src/main.go", false, false)
+	assertMatch("build/", "build", true, true)
+	assertMatch("build/", "build", false, false)
+	assertMatch("build/", "sub/build", true, true)
+	assertMatch("/build", "build", false, true)
+	assertMatch("/build", "sub/build", false, false)
+	assertMatch("doc/*.txt", "doc/a.txt", false, true)
+	assertMatch("doc/*.txt", "doc/sub/a.txt", false, false)
+	assertMatch("doc/*.txt", "sub/doc/a.txt", false, false)
+	assertMatch("**/foo", "foo", true, true)
+	assertMatch("**/foo", "a/b/foo", false, true)
+	assertMatch("a/**/b", "a/b", false, true)
+	assertMatch("a/**/b", "a/x/y/b", false, true)
+	assertMatch("a/**/b", "a/x/y/c", false, false)
+	assertMatch("a/**", "a/x/y", false, true)
+	assertMatch("fil?.[ch]", "file.c", false, true)
+	assertMatch("fil?.[ch]", "file.go", false, false)
+	assertMatch("trailing\\  ", "trailing ", false, true)
+	assertMatch("trailing\\  ", "trailing", false, false)
+
+	p := parseIgnorePattern("*.log", []string{"root", "sub"})
+	assert.True(p.match([]string{"root", "sub", "a.log"}, false))
+	assert.True(p.match([]string{"root", "sub", "x", "a.log"}, false))
+	assert.False(p.match([]string{"root", "a.log"}, false))
+	assert.False(p.match([]string{"root", "sub"}, false))
+}
+
+func TestPathFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(testPath, "repo", name)
+		require.Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile("main.go", "package main")
+	writeFile("README.md", "readme")
+	writeFile("debug.log", "log")
+	writeFile(".git/config", "config")
+	writeFile("node_modules/a/index.js", "js")
+	writeFile("src/app.go", "package src")
+	writeFile("src/app.log", "log")
+	writeFile("src/keep.log", "log")
+	writeFile("src/gen/code.go", "package gen")
+	writeFile(".trzszignore", "# ignore the logs\n*.log\nnode_modules/\n")
+	writeFile("src/.trzszignore", "!keep.log\n/gen\n")
+
+	listFiles := func(filter *pathFilter) []string {
+		t.Helper()
+		srcFiles, err := checkPathsReadable([]string{filepath.Join(testPath, "repo")}, true, false, filter)
+		require.Nil(err)
+		var names []string
+		for _, srcFile := range srcFiles {
+			names = append(names, strings.Join(srcFile.RelPath, "/"))
+		}
+		return names
+	}
+
+	// the .trzszignore files are not honored without any pattern
+	assert.ElementsMatch([]string{"repo", "repo/main.go", "repo/README.md", "repo/debug.log", "repo/.trzszignore",
+		"repo/.git", "repo/.git/config", "repo/node_modules", "repo/node_modules/a", "repo/node_modules/a/index.js",
+		"repo/src", "repo/src/app.go", "repo/src/app.log", "repo/src/keep.log", "repo/src/gen",
+		"repo/src/gen/code.go", "repo/src/.trzszignore"}, listFiles(nil))
+
+	assert.ElementsMatch([]string{"repo", "repo/main.go", "repo/README.md", "repo/.trzszignore",
+		"repo/src", "repo/src/app.go", "repo/src/keep.log", "repo/src/.trzszignore"},
+		listFiles(newPathFilter(nil, []string{".git"})))
+
+	assert.ElementsMatch([]string{"repo", "repo/main.go", "repo/.git", "repo/src", "repo/src/app.go"},
+		listFiles(newPathFilter([]string{"*.go"}, nil)))
+
+	assert.ElementsMatch([]string{"repo", "repo/main.go", "repo/.git", "repo/src"},
+		listFiles(newPathFilter([]string{"*.go"}, []string{"/src/*.go"})))
+
+	// the client and the server patterns are both applied
+	assert.ElementsMatch([]string{"repo", "repo/main.go", "repo/.git", "repo/src"},
+		listFiles(newPathFilter([]string{"*.go", "*.md"}, nil).and(newPathFilter([]string{"*.go"}, []string{"src/app.go"}))))
+	assert.ElementsMatch([]string{"repo", "repo/README.md", "repo/.trzszignore", "repo/src", "repo/src/keep.log",
+		"repo/src/.trzszignore"}, listFiles(newPathFilter(nil, splitPatterns(" *.go, .git ,")).and(nil)))
+	assert.Equal([]string{"*.go", "node_modules/"}, splitPatterns("*.go,, node_modules/ "))
+
+	// the top level paths are not filtered
+	srcFiles, err := checkPathsReadable([]string{filepath.Join(testPath, "repo", "debug.log")}, true, false,
+		newPathFilter(nil, []string{"*.log"}))
+	require.Nil(err)
+	assert.Equal(1, len(srcFiles))
+}
@@ -0,0 +1,374 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kMaxParallel = 16
+
+	// the cost of each file's round trips, counted as bytes while balancing the workers
+	kParallelFileCost = 64 * 1024
+)
+
+func getWorkerHelloConstant(clientHello, serverHello string, idx int) (string, string) {
+	return fmt.Sprintf("%s#%d", clientHello, idx), fmt.Sprintf("%s#%d", serverHello, idx)
+}
+
+func parseWorkerHello(hello, clientHello string) int {
+	suffix, ok := strings.CutPrefix(hello, clientHello+"#")
+	if !ok {
+		return 0
+	}
+	idx, err := strconv.Atoi(suffix)
+	if err != nil || idx <= 0 || idx >= kMaxParallel {
+		return 0
+	}
+	return idx
+}
+
+func (t *trzszTransfer) newWorker(conn net.Conn) *trzszTransfer {
+	worker := newTransfer(conn, nil)
+	worker.tunnelConn.Store(&conn)
+	worker.tunnelConnected = true
+	worker.trzszFilter = t.trzszFilter
+	wrapTransferInput(worker, conn, true)
+	return worker
+}
+
+func (t *trzszTransfer) getWorkers() []*trzszTransfer {
+	t.workerMutex.Lock()
+	defer t.workerMutex.Unlock()
+	return t.workers
+}
+
+func (t *trzszTransfer) setWorkers(workers []*trzszTransfer) {
+	for _, worker := range workers {
+		worker.transferConfig = t.transferConfig
+		worker.transferConfig.Parallel = 0
+		worker.rateLimiter = t.rateLimiter
+		if t.report != nil {
+			worker.report = &transferReport{}
+		}
+	}
+	t.workerMutex.Lock()
+	defer t.workerMutex.Unlock()
+	t.workers = workers
+}
+
+func (t *trzszTransfer) addAcceptedWorker(idx int, conn net.Conn) {
+	t.workerMutex.Lock()
+	defer t.workerMutex.Unlock()
+	if t.acceptedWorkers == nil {
+		t.acceptedWorkers = make(map[int]*trzszTransfer)
+		t.workerNotify = make(chan struct{}, 1)
+	}
+	if _, ok := t.acceptedWorkers[idx]; ok || t.acceptStopped {
+		_ = conn.Close()
+		return
+	}
+	t.acceptedWorkers[idx] = t.newWorker(conn)
+	select {
+	case t.workerNotify <- struct{}{}:
+	default:
+	}
+}
+
+func (t *trzszTransfer) takeAcceptedWorkers(num int) ([]*trzszTransfer, <-chan struct{}) {
+	t.workerMutex.Lock()
+	defer t.workerMutex.Unlock()
+	var workers []*trzszTransfer
+	for idx := 1; idx <= num; idx++ {
+		worker, ok := t.acceptedWorkers[idx]
+		if !ok {
+			return nil, t.workerNotify
+		}
+		workers = append(workers, worker)
+	}
+	return workers, nil
+}
+
+func dialWorker(connector func(int) net.Conn, port int, clientHello, serverHello string) net.Conn {
+	connChan := make(chan net.Conn, 1)
+	go func() {
+		conn := connector(port)
+		if conn == nil {
+			connChan <- nil
+			return
+		}
+		if _, err := conn.Write([]byte(clientHello)); err != nil {
+			_ = conn.Close()
+			connChan <- nil
+			return
+		}
+		buf := make([]byte, 100)
+		n, err := conn.Read(buf)
+		if err != nil || string(buf[:n]) != serverHello {
+			_ = conn.Close()
+			connChan <- nil
+			return
+		}
+		connChan <- conn
+	}()
+	select {
+	case conn := <-connChan:
+		return conn
+	case <-time.After(time.Second):
+		go func() {
+			if conn := <-connChan; conn != nil {
+				_ = conn.Close()
+			}
+		}()
+		return nil
+	}
+}
+
+// connectWorkers is called by the client after receiving the config,
+// to create the extra tunnel connections for parallel transfer.
+func (t *trzszTransfer) connectWorkers() error {
+	num := t.transferConfig.Parallel - 1
+	if num <= 0 || !t.tunnelConnected || t.tunnelConnector == nil {
+		return nil
+	}
+	clientHello, serverHello := getHelloConstant(t.tunnelUniqueID, t.tunnelPort)
+	conns := make([]net.Conn, num)
+	var wg sync.WaitGroup
+	for i := range num {
+		wg.Go(func() {
+			workerClientHello, workerServerHello := getWorkerHelloConstant(clientHello, serverHello, i+1)
+			conns[i] = dialWorker(t.tunnelConnector, t.tunnelPort, workerClientHello, workerServerHello)
+		})
+	}
+	wg.Wait()
+
+	// only the leading successful connections are used
+	var workers []*trzszTransfer
+	for _, conn := range conns {
+		if conn == nil {
+			break
+		}
+		workers = append(workers, t.newWorker(conn))
+	}
+	for _, conn := range conns[len(workers):] {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+
+	if err := t.sendInteger("PARA", int64(len(workers))); err != nil {
+		return err
+	}
+	if err := t.checkInteger(int64(len(workers)), t.getNewTimeout()); err != nil {
+		return err
+	}
+	t.setWorkers(workers)
+	return nil
+}
+
+// acceptWorkers is called by the server after sending the config,
+// to wait for the extra tunnel connections for parallel transfer.
+func (t *trzszTransfer) acceptWorkers() error {
+	defer t.stopAcceptingWorkers()
+	if t.transferConfig.Parallel <= 1 {
+		return nil
+	}
+	num, err := t.recvInteger("PARA", false, t.getNewTimeout())
+	if err != nil {
+		return err
+	}
+	if num < 0 || num >= int64(t.transferConfig.Parallel) {
+		return simpleTrzszError("Invalid parallel workers: %d", num)
+	}
+	timeout := time.After(3 * time.Second)
+	for {
+		workers, notify := t.takeAcceptedWorkers(int(num))
+		if notify == nil {
+			t.setWorkers(workers)
+			break
+		}
+		select {
+		case <-notify:
+		case <-timeout:
+			return simpleTrzszError("Wait for parallel connections timeout")
+		}
+	}
+	return t.sendInteger("SUCC", num)
+}
+
+// stopAcceptingWorkers closes the tunnel listener, and the accepted connections which are not used.
+func (t *trzszTransfer) stopAcceptingWorkers() {
+	if t.tunnelListener != nil {
+		_ = t.tunnelListener.Close()
+	}
+	t.workerMutex.Lock()
+	defer t.workerMutex.Unlock()
+	for _, worker := range t.acceptedWorkers {
+		if !slices.Contains(t.workers, worker) {
+			worker.cleanup()
+		}
+	}
+	t.acceptedWorkers = nil
+	t.acceptStopped = true
+}
+
+func (t *trzszTransfer) groupSourceFiles(sourceFiles []*sourceFile) ([]*sourceFile, [][]*sourceFile) {
+	var entries []*sourceFile
+	groups := make([][]*sourceFile, len(t.workers)+1)
+	loads := make([]int64, len(groups))
+	nameGroups := make(map[string]int)
+	rename := t.transferConfig.getConflictPolicy() == kConflictRename
+	for _, srcFile := range sourceFiles {
+		if (srcFile.IsDir && len(srcFile.SubFiles) == 0) || srcFile.isSymlink() {
+			entries = append(entries, srcFile)
+			continue
+		}
+		// the same names must be saved in order, or the new names may be the same
+		idx, ok := nameGroups[srcFile.RelPath[0]]
+		if !ok || !rename {
+			idx = slices.Index(loads, slices.Min(loads))
+			nameGroups[srcFile.RelPath[0]] = idx
+		}
+		groups[idx] = append(groups[idx], srcFile)
+		loads[idx] += srcFile.Size + kParallelFileCost
+		for _, subFile := range srcFile.SubFiles {
+			loads[idx] += subFile.Size + kParallelFileCost
+		}
+	}
+	return entries, groups
+}
+
+func appendUniqueNames(names []string, newNames []string) []string {
+	for _, name := range newNames {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// runInParallel runs fn on the main transfer and the workers, and stops all of them if any fails.
+func (t *trzszTransfer) runInParallel(fn func(transfer *trzszTransfer, idx int) ([]string, error)) ([]string, error) {
+	transfers := append([]*trzszTransfer{t}, t.workers...)
+	results := make([][]string, len(transfers))
+	errs := make([]error, len(transfers))
+	var wg sync.WaitGroup
+	for i, transfer := range transfers {
+		wg.Go(func() {
+			results[i], errs[i] = fn(transfer, i)
+			if errs[i] != nil {
+				for _, other := range transfers {
+					if other != transfer {
+						other.buffer.stopBuffer()
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	var names []string
+	for i, worker := range t.workers {
+		t.createdFiles = append(t.createdFiles, worker.createdFiles...)
+		t.skippedFiles = append(t.skippedFiles, worker.skippedFiles...)
+		t.unchangedFiles = append(t.unchangedFiles, worker.unchangedFiles...)
+		t.deletedFiles = append(t.deletedFiles, worker.deletedFiles...)
+		t.dirModTimes = append(t.dirModTimes, worker.dirModTimes...)
+		worker.createdFiles = nil
+		worker.skippedFiles = nil
+		worker.unchangedFiles = nil
+		worker.deletedFiles = nil
+		worker.dirModTimes = nil
+		if worker.report != nil {
+			t.report.Files = append(t.report.Files, worker.report.Files...)
+			worker.report.Files = nil
+		}
+		if errs[i+1] != nil && errs[0] == nil {
+			errs[0] = errs[i+1]
+		}
+	}
+	for _, err := range errs {
+		if err != nil && err != errStopped {
+			return nil, err
+		}
+	}
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	for _, result := range results {
+		names = appendUniqueNames(names, result)
+	}
+	return names, nil
+}
+
+// sendFilesInParallel sends the directories and symlinks on the main transfer first,
+// so they are created before any file in them, then sends the files on all transfers.
+// Only the files on the main transfer are shown in the progress bar.
+func (t *trzszTransfer) sendFilesInParallel(sourceFiles []*sourceFile, progress progressCallback) ([]string, error) {
+	entries, groups := t.groupSourceFiles(sourceFiles)
+	remoteNames, err := t.sendFileList(entries, nil)
+	if err != nil {
+		return nil, err
+	}
+	names, err := t.runInParallel(func(transfer *trzszTransfer, idx int) ([]string, error) {
+		if idx == 0 {
+			return transfer.sendFileList(groups[idx], progress)
+		}
+		return transfer.sendFileList(groups[idx], nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appendUniqueNames(remoteNames, names), nil
+}
+
+func (t *trzszTransfer) recvFilesInParallel(path string, progress progressCallback) ([]string, error) {
+	localNames, err := t.recvFileList(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the workers save files into the directories which may be renamed by the main transfer
+	for _, worker := range t.workers {
+		worker.fileNameMap = maps.Clone(t.fileNameMap)
+	}
+	names, err := t.runInParallel(func(transfer *trzszTransfer, idx int) ([]string, error) {
+		if idx == 0 {
+			return transfer.recvFileList(path, progress)
+		}
+		return transfer.recvFileList(path, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appendUniqueNames(localNames, names), nil
+}
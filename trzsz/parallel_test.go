@@ -0,0 +1,195 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newParallelTransferPair(parallel int) (*trzszTransfer, *trzszTransfer) {
+	sender, receiver := newTransferPair(kProtocolVersion)
+	var senderWorkers, receiverWorkers []*trzszTransfer
+	for range parallel - 1 {
+		senderWorker, receiverWorker := newTransferPair(kProtocolVersion)
+		senderWorkers = append(senderWorkers, senderWorker)
+		receiverWorkers = append(receiverWorkers, receiverWorker)
+	}
+	sender.setWorkers(senderWorkers)
+	receiver.setWorkers(receiverWorkers)
+	return sender, receiver
+}
+
+func TestParseWorkerHello(t *testing.T) {
+	assert := assert.New(t)
+	clientHello, serverHello := getHelloConstant("123", 8000)
+	workerClientHello, workerServerHello := getWorkerHelloConstant(clientHello, serverHello, 3)
+	assert.Equal(clientHello+"#3", workerClientHello)
+	assert.Equal(serverHello+"#3", workerServerHello)
+	assert.Equal(3, parseWorkerHello(workerClientHello, clientHello))
+	assert.Equal(0, parseWorkerHello(clientHello, clientHello))
+	assert.Equal(0, parseWorkerHello(clientHello+"#0", clientHello))
+	assert.Equal(0, parseWorkerHello(clientHello+"#x", clientHello))
+	assert.Equal(0, parseWorkerHello(fmt.Sprintf("%s#%d", clientHello, kMaxParallel), clientHello))
+	assert.Equal(0, parseWorkerHello(workerServerHello, clientHello))
+}
+
+func TestParallelTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "dir", "sub"), 0755))
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "empty"), 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	var paths []string
+	for i := range 6 {
+		name := fmt.Sprintf("file%d", i)
+		content := bytes.Repeat([]byte(name), (i+1)*10000)
+		require.Nil(os.WriteFile(filepath.Join(srcPath, name), content, 0644))
+		paths = append(paths, filepath.Join(srcPath, name))
+	}
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "dir", "a"), []byte("aaa"), 0644))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "dir", "sub", "b"), []byte("bbb"), 0644))
+	paths = append(paths, filepath.Join(srcPath, "dir"), filepath.Join(srcPath, "empty"))
+
+	srcFiles, err := checkPathsReadable(paths, true, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newParallelTransferPair(3)
+	remoteNames, localNames := transferFiles(t, sender, receiver, srcFiles, dstPath, nil, nil)
+	assert.ElementsMatch([]string{"file0", "file1", "file2", "file3", "file4", "file5", "dir", "empty"}, localNames)
+	assert.Equal(localNames, remoteNames)
+	assertDirEqual(t, srcPath, dstPath)
+	for _, worker := range receiver.workers {
+		assert.Empty(worker.createdFiles)
+	}
+	assert.NotEmpty(receiver.createdFiles)
+
+	// the files with the same name are renamed in order
+	srcFiles, err = checkPathsReadable(paths, true, false, nil)
+	require.Nil(err)
+	sender, receiver = newParallelTransferPair(3)
+	remoteNames, localNames = transferFiles(t, sender, receiver, srcFiles, dstPath, nil, nil)
+	assert.ElementsMatch([]string{"file0.0", "file1.0", "file2.0", "file3.0", "file4.0", "file5.0", "dir.0", "empty.0"},
+		localNames)
+	assert.Equal(localNames, remoteNames)
+	assertFileEqual(t, filepath.Join(srcPath, "file5"), filepath.Join(dstPath, "file5.0"))
+	assertDirEqual(t, filepath.Join(srcPath, "dir"), filepath.Join(dstPath, "dir.0"))
+}
+
+func TestAcceptOnTunnel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	uniqueID := "1234567890100"
+	hello := func(port int, idx int) (net.Conn, bool) {
+		t.Helper()
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return nil, false
+		}
+		clientHello, serverHello := getHelloConstant(uniqueID, port)
+		if idx > 0 {
+			clientHello, serverHello = getWorkerHelloConstant(clientHello, serverHello, idx)
+		}
+		_, err = conn.Write([]byte(clientHello))
+		require.Nil(err)
+		require.Nil(conn.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, 100)
+		n, err := conn.Read(buf)
+		if err != nil {
+			_ = conn.Close()
+			return nil, false
+		}
+		assert.Equal(serverHello, string(buf[:n]))
+		return conn, true
+	}
+	listenerClosed := func(port int) func() bool {
+		return func() bool {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				return true
+			}
+			_ = conn.Close()
+			return false
+		}
+	}
+
+	// the listener is closed once the tunnel is connected without parallel
+	listener, port := listenForTunnel()
+	require.NotNil(listener)
+	transfer := newTransfer(io.Discard, nil)
+	transfer.acceptOnTunnel(listener, uniqueID, port, 0)
+	conn, ok := hello(port, 0)
+	require.True(ok)
+	defer func() { _ = conn.Close() }()
+	assert.Eventually(listenerClosed(port), time.Second, 10*time.Millisecond)
+
+	// the workers are accepted until acceptWorkers is done
+	listener, port = listenForTunnel()
+	require.NotNil(listener)
+	transfer = newTransfer(io.Discard, nil)
+	transfer.acceptOnTunnel(listener, uniqueID, port, 3)
+	_, ok = hello(port, 1)
+	assert.False(ok, "a worker before the tunnel connection")
+	conn, ok = hello(port, 0)
+	require.True(ok)
+	defer func() { _ = conn.Close() }()
+	_, ok = hello(port, 3)
+	assert.False(ok, "a worker above the parallel")
+	worker1, ok := hello(port, 1)
+	require.True(ok)
+	defer func() { _ = worker1.Close() }()
+	worker2, ok := hello(port, 2)
+	require.True(ok)
+	defer func() { _ = worker2.Close() }()
+	assert.Eventually(func() bool {
+		transfer.workerMutex.Lock()
+		defer transfer.workerMutex.Unlock()
+		return len(transfer.acceptedWorkers) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	transfer.stopAcceptingWorkers()
+	assert.Eventually(listenerClosed(port), time.Second, 10*time.Millisecond)
+	assert.Nil(transfer.acceptedWorkers)
+	require.Nil(worker1.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err := worker1.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+}
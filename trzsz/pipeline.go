@@ -27,7 +27,6 @@ package trzsz
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -56,6 +55,8 @@ type trzszData struct {
 type trzszAck struct {
 	begin  time.Time
 	length int64
+	seq    int64
+	data   []byte // kept for retransmission
 }
 
 type readCloser interface {
@@ -109,6 +110,14 @@ type sendDataWriter struct {
 }
 
 func (b *sendDataWriter) deliver(data []byte) bool {
+	if b.transfer.transferConfig.Protocol >= kProtocolVersion13 { // framed with the seq and crc while sending
+		select {
+		case b.sendDataChan <- trzszData{data, nil, 0}:
+			return true
+		case <-b.ctx.Done():
+			return false
+		}
+	}
 	buffer := bytes.NewBuffer(make([]byte, 0, len(data)+0x20))
 	buffer.Write([]byte("#DATA:"))
 	if b.transfer.transferConfig.Binary {
@@ -329,8 +338,8 @@ func (c *zstdWriter) Flush() error {
 	return c.encoder.Flush()
 }
 
-func newZstdWriter(writer io.WriteCloser) (writeCloseFlusher, error) {
-	encoder, err := zstd.NewWriter(writer)
+func newZstdWriter(writer io.WriteCloser, opts ...zstd.EOption) (writeCloseFlusher, error) {
+	encoder, err := zstd.NewWriter(writer, opts...)
 	if err != nil {
 		return nil, simpleTrzszError("New zstd writer error: %v", err)
 	}
@@ -343,7 +352,10 @@ func (t *trzszTransfer) checkStopAndPause(typ string) error {
 			if err := t.checkStop(); err != nil {
 				return err
 			}
-			if err := t.writeAll(fmt.Appendf(nil, "#%s:=%s", typ, t.transferConfig.Newline)); err != nil {
+			t.chunkMutex.Lock()
+			err := t.writeAll(fmt.Appendf(nil, "#%s:=%s", typ, t.transferConfig.Newline))
+			t.chunkMutex.Unlock()
+			if err != nil {
 				return err
 			}
 			time.Sleep(100 * time.Millisecond)
@@ -353,6 +365,10 @@ func (t *trzszTransfer) checkStopAndPause(typ string) error {
 }
 
 func (t *trzszTransfer) recvCheckV2(expectType string) ([]byte, *time.Time, bool, error) {
+	return t.recvCheckWithTimeout(expectType, t.getNewTimeout)
+}
+
+func (t *trzszTransfer) recvCheckWithTimeout(expectType string, newTimeout func() <-chan time.Time) ([]byte, *time.Time, bool, error) {
 	pause := false
 	var pauseIdx uint32
 	for {
@@ -368,7 +384,7 @@ func (t *trzszTransfer) recvCheckV2(expectType string) ([]byte, *time.Time, bool
 		}
 
 		beginTime := timeNowFunc()
-		line, err := t.recvLine(expectType, false, t.getNewTimeout())
+		line, err := t.recvLine(expectType, false, newTimeout())
 
 		if t.transferConfig.Protocol >= kProtocolVersion3 &&
 			err == errReceiveDataTimeout && pauseIdx < t.pauseIdx.Load() { // pause after read, read again
@@ -409,7 +425,10 @@ func (t *trzszTransfer) sendDataV2(buffer []byte, length int, encoded bool) (*ti
 	if err := t.checkStopAndPause("DATA"); err != nil {
 		return nil, err
 	}
-	beginTime := timeNowFunc()
+	if err := t.throttle(length); err != nil {
+		return nil, err
+	}
+	beginTime := timeNowFunc() // the rate limit sleep is not counted in the chunk time
 	if encoded {
 		return &beginTime, t.writeAll(buffer)
 	}
@@ -439,6 +458,9 @@ func (t *trzszTransfer) isCompressFixed(size int64) (fixed bool, compress bool)
 	if t.transferConfig.CompressType == kCompressNo {
 		return true, false
 	}
+	if size < 0 { // a stream can't be detected in advance
+		return true, true
+	}
 	if size < 512 {
 		return true, false
 	}
@@ -453,7 +475,7 @@ func (t *trzszTransfer) sendCompressFlag(file fileReader) (bool, error) {
 	if fixed {
 		return compress, nil
 	}
-	compress, err := isCompressionProfitable(file)
+	compress, err := isCompressionProfitable(file, t.transferConfig.CompressCodec, t.transferConfig.CompressLevel)
 	if err != nil {
 		return false, fmt.Errorf("compression detect failed: %v", err)
 	}
@@ -481,12 +503,17 @@ func (t *trzszTransfer) recvCompressFlag(size int64) (bool, error) {
 
 func (t *trzszTransfer) pipelineCalculateMD5(ctx *pipelineContext, md5SourceChan <-chan []byte) <-chan []byte {
 	md5DigestChan := make(chan []byte, 1)
+	hashState := t.resumeHashState
 	go func() {
 		defer close(md5DigestChan)
-		hasher := md5.New()
+		hasher, err := t.restoreHasher(hashState)
+		if err != nil {
+			ctx.cancel(err)
+			return
+		}
 		for buf := range md5SourceChan {
 			if _, err := hasher.Write(buf); err != nil {
-				ctx.cancel(simpleTrzszError("MD5 write error: %v", err))
+				ctx.cancel(simpleTrzszError("Hash write error: %v", err))
 				return
 			}
 			if ctx.Err() != nil {
@@ -510,8 +537,11 @@ func (t *trzszTransfer) pipelineReadData(ctx *pipelineContext, file fileReader)
 		step := int64(0)
 		size := file.getSize()
 		bufSize := int64(32 * 1024)
-		for step < size && ctx.Err() == nil {
-			m := min(size-step, bufSize)
+		for (size < 0 || step < size) && ctx.Err() == nil {
+			m := bufSize
+			if size >= 0 {
+				m = min(size-step, bufSize)
+			}
 			buffer := make([]byte, m)
 			n, err := file.Read(buffer)
 			if n > 0 {
@@ -528,6 +558,9 @@ func (t *trzszTransfer) pipelineReadData(ctx *pipelineContext, file fileReader)
 				step += int64(n)
 			}
 			if err == io.EOF {
+				if size < 0 { // end of the stream
+					return
+				}
 				if step != size {
 					ctx.cancel(simpleTrzszError("EOF but step [%d] <> size [%d]", step, size))
 					return
@@ -550,13 +583,13 @@ func (t *trzszTransfer) pipelineEncodeData(ctx *pipelineContext, fileDataChan <-
 		var writer writeCloseFlusher
 		if t.transferConfig.Binary {
 			if compress {
-				writer, err = newZstdWriter(newEscapeWriter(t.transferConfig.EscapeTable, newSendDataWriter(t, ctx, sendDataChan)))
+				writer, err = t.newCompressWriter(newEscapeWriter(t.transferConfig.EscapeTable, newSendDataWriter(t, ctx, sendDataChan)))
 			} else {
 				writer = newEscapeWriter(t.transferConfig.EscapeTable, newSendDataWriter(t, ctx, sendDataChan))
 			}
 		} else {
 			if compress {
-				writer, err = newZstdWriter(newBase64Writer(newSendDataWriter(t, ctx, sendDataChan)))
+				writer, err = t.newCompressWriter(newBase64Writer(newSendDataWriter(t, ctx, sendDataChan)))
 			} else {
 				writer = newBase64Writer(newSendDataWriter(t, ctx, sendDataChan))
 			}
@@ -591,12 +624,22 @@ func (t *trzszTransfer) pipelineEncodeData(ctx *pipelineContext, fileDataChan <-
 	return sendDataChan
 }
 
-func (t *trzszTransfer) pipelineRecvCurrentAck() (int64, int64, bool, error) {
-	resp, _, pause, err := t.recvCheckV2("SUCC")
+func (t *trzszTransfer) pipelineRecvCurrentAck(deadline time.Time) (int64, int64, bool, error) {
+	resp, _, pause, err := t.recvCheckWithTimeout("SUCC", func() <-chan time.Time {
+		return t.getPipelineTimeout(deadline)
+	})
 	if err != nil {
 		return 0, 0, pause, err
 	}
 
+	if len(resp) > 1 && resp[0] == '!' {
+		seq, err := strconv.ParseInt(string(resp[1:]), 10, 64)
+		if err != nil {
+			return 0, 0, pause, simpleTrzszError("Parse int from %s error: %v", resp[1:], err)
+		}
+		return 0, 0, pause, &chunkNak{seq}
+	}
+
 	tokens := strings.Split(string(resp), "/")
 	if len(tokens) != 2 {
 		return 0, 0, pause, simpleTrzszError("Response number is not 2 but %d", len(tokens))
@@ -651,14 +694,33 @@ func (t *trzszTransfer) pipelineRecvFinalAck(ctx *pipelineContext, size int64, p
 }
 
 func (t *trzszTransfer) pipelineSendData(ctx *pipelineContext, sendDataChan <-chan trzszData) <-chan trzszAck {
-	ackChan := make(chan trzszAck, kAckChanBufferSize)
+	var cc *congestionControl
+	ackChanSize := kAckChanBufferSize
+	if t.isRTTPacing() {
+		cc, ackChanSize = t.congestion, kMaxWindow
+	}
+	ackChan := make(chan trzszAck, ackChanSize)
+	seq := int64(0)
 	deliver := func(buffer []byte, length int, encoded bool) error {
-		beginTime, err := t.sendDataV2(buffer, length, encoded)
+		if cc != nil && !cc.acquire() {
+			return ctx.Err()
+		}
+		var err error
+		var beginTime *time.Time
+		ack := trzszAck{length: int64(length)}
+		if t.transferConfig.Protocol >= kProtocolVersion13 {
+			ack.seq, ack.data = seq, buffer
+			seq++
+			beginTime, err = t.sendChunk(ack.seq, ack.data)
+		} else {
+			beginTime, err = t.sendDataV2(buffer, length, encoded)
+		}
 		if err != nil {
 			return err
 		}
+		ack.begin = *beginTime
 		select {
-		case ackChan <- trzszAck{*beginTime, int64(length)}:
+		case ackChan <- ack:
 			return nil
 		case <-ctx.Done():
 			return ctx.Err()
@@ -672,7 +734,11 @@ func (t *trzszTransfer) pipelineSendData(ctx *pipelineContext, sendDataChan <-ch
 			}
 			bufSize := int(t.bufferSize.Load())
 			if len(data.data) <= bufSize { // send all at once
-				if err := deliver(data.buffer, len(data.data), true); err != nil {
+				buffer, encoded := data.buffer, true
+				if buffer == nil {
+					buffer, encoded = data.data, false
+				}
+				if err := deliver(buffer, len(data.data), encoded); err != nil {
 					ctx.cancel(err)
 					return
 				}
@@ -697,7 +763,7 @@ func (t *trzszTransfer) pipelineSendData(ctx *pipelineContext, sendDataChan <-ch
 	return ackChan
 }
 
-func (t *trzszTransfer) pipelineRecvAck(ctx *pipelineContext, size int64, ackChan <-chan trzszAck, showProgress bool) <-chan int64 {
+func (t *trzszTransfer) pipelineRecvAck(ctx *pipelineContext, file fileReader, ackChan <-chan trzszAck, showProgress bool) <-chan int64 {
 	var progressChan chan int64
 	if showProgress {
 		progressChan = make(chan int64, 100)
@@ -706,9 +772,35 @@ func (t *trzszTransfer) pipelineRecvAck(ctx *pipelineContext, size int64, ackCha
 		if showProgress {
 			defer close(progressChan)
 		}
+		var cc *congestionControl
+		if t.isRTTPacing() {
+			cc = t.congestion
+		}
 		ignoreChunkTimeCount := 0
 		for ack := range ackChan {
-			length, step, pause, err := t.pipelineRecvCurrentAck()
+			resent := false
+			deadline := t.getAckDeadline()
+			length, step, pause, err := t.pipelineRecvCurrentAck(deadline)
+			for retries := 0; err != nil; {
+				if pause {
+					deadline = t.getAckDeadline() // the time of pausing doesn't count
+				}
+				if t.isAckRetransmittable(err, deadline) {
+					// the chunk may be lost, or the receiver is just slow, a duplicate is dropped by the receiver
+					if _, err = t.sendChunk(ack.seq, ack.data); err != nil {
+						break
+					}
+				} else if nak, ok := err.(*chunkNak); !ok {
+					break
+				} else if err = t.resendChunk(&ack, nak, retries); err != nil {
+					break
+				} else {
+					retries++
+					deadline = t.getAckDeadline()
+				}
+				resent = true
+				length, step, pause, err = t.pipelineRecvCurrentAck(deadline)
+			}
 			if err != nil {
 				ctx.cancel(err)
 				return
@@ -730,7 +822,16 @@ func (t *trzszTransfer) pipelineRecvAck(ctx *pipelineContext, size int64, ackCha
 				ignoreChunkTimeCount = kAckChanBufferSize + 2
 			}
 
-			if ignoreChunkTimeCount <= 0 || t.bufInitPhase.Load() {
+			if cc != nil {
+				// the time of a paused or resent chunk is not the round trip time
+				if pause || resent {
+					cc.release()
+				} else {
+					chunkTime := time.Since(ack.begin)
+					t.bufferSize.Store(cc.onAck(length, chunkTime, t.bufferSize.Load(), t.transferConfig.MaxBufSize))
+					t.setLastChunkTime(chunkTime)
+				}
+			} else if ignoreChunkTimeCount <= 0 || t.bufInitPhase.Load() {
 				chunkTime := time.Since(ack.begin)
 				bufSize := t.bufferSize.Load()
 
@@ -762,7 +863,8 @@ func (t *trzszTransfer) pipelineRecvAck(ctx *pipelineContext, size int64, ackCha
 		if ctx.Err() != nil {
 			return
 		}
-		t.pipelineRecvFinalAck(ctx, size, progressChan)
+		// all data has been sent, so the size of a stream is known now
+		t.pipelineRecvFinalAck(ctx, file.getSize(), progressChan)
 	}()
 	return progressChan
 }
@@ -792,6 +894,10 @@ func (t *trzszTransfer) sendFileDataV2(file fileReader, progress progressCallbac
 	defer ctx.cancel(nil)
 	defer close(ctx.succ)
 
+	if t.beginPacing(ctx) != nil {
+		t.bufInitPhase.Store(false) // the chunk size is adapted by the congestion control
+	}
+
 	fileDataChan, md5SourceChan := t.pipelineReadData(ctx, file)
 
 	md5DigestChan := t.pipelineCalculateMD5(ctx, md5SourceChan)
@@ -801,7 +907,7 @@ func (t *trzszTransfer) sendFileDataV2(file fileReader, progress progressCallbac
 	ackChan := t.pipelineSendData(ctx, sendDataChan)
 
 	showProgress := progress != nil
-	progressChan := t.pipelineRecvAck(ctx, file.getSize(), ackChan, showProgress)
+	progressChan := t.pipelineRecvAck(ctx, file, ackChan, showProgress)
 
 	if showProgress {
 		wg := t.pipelineShowProgress(ctx, progress, progressChan)
@@ -846,17 +952,22 @@ func (t *trzszTransfer) pipelineRecvBinaryData() ([]byte, *time.Time, error) {
 	return data, beginTime, nil
 }
 
-func (t *trzszTransfer) pipelineSendAck(ctx *pipelineContext, size int64, ackChan <-chan int) chan<- struct{} {
+func (t *trzszTransfer) pipelineSendAck(ctx *pipelineContext, size int64, ackChan <-chan recvAck) chan<- struct{} {
 	ackImmediatelyChan := make(chan struct{}, 1)
 	go func() {
 		// send an ack for each step
-		for length := range ackChan {
+		for ack := range ackChan {
 			if err := t.checkStopAndPause("SUCC"); err != nil {
 				ctx.cancel(err)
 				return
 			}
-			step := t.savedSteps.Load()
-			if err := t.writeAll(fmt.Appendf(nil, "#SUCC:%d/%d%s", length, step, t.transferConfig.Newline)); err != nil {
+			var buf []byte
+			if ack.nak {
+				buf = fmt.Appendf(nil, "#SUCC:!%d%s", ack.seq, t.transferConfig.Newline)
+			} else {
+				buf = fmt.Appendf(nil, "#SUCC:%d/%d%s", ack.length, t.savedSteps.Load(), t.transferConfig.Newline)
+			}
+			if err := t.writeAll(buf); err != nil {
 				ctx.cancel(err)
 				return
 			}
@@ -865,6 +976,26 @@ func (t *trzszTransfer) pipelineSendAck(ctx *pipelineContext, size int64, ackCha
 			}
 		}
 
+		// the final step of a stream is known after all data is saved, keep the sender waiting until then
+		for size < 0 && ctx.Err() == nil {
+			select {
+			case _, ok := <-ackImmediatelyChan:
+				if !ok {
+					return
+				}
+				size = t.savedSteps.Load()
+			case <-time.After(200 * time.Millisecond):
+				if err := t.checkStop(); err != nil {
+					ctx.cancel(err)
+					return
+				}
+				if err := t.writeAll(fmt.Appendf(nil, "#SUCC:=%s", t.transferConfig.Newline)); err != nil {
+					ctx.cancel(err)
+					return
+				}
+			}
+		}
+
 		// send ack until all data is saved to disk
 		for ctx.Err() == nil {
 			if err := t.checkStopAndPause("SUCC"); err != nil {
@@ -898,13 +1029,17 @@ func (t *trzszTransfer) pipelineSendAck(ctx *pipelineContext, size int64, ackCha
 	return ackImmediatelyChan
 }
 
-func (t *trzszTransfer) pipelineRecvData(ctx *pipelineContext) (<-chan int, <-chan []byte) {
-	ackChan := make(chan int, 100)
+func (t *trzszTransfer) pipelineRecvData(ctx *pipelineContext) (<-chan recvAck, <-chan []byte) {
+	ackChan := make(chan recvAck, 100)
 	recvDataChan := make(chan []byte, 100)
 	go func() {
 		defer close(ackChan)
 		defer close(recvDataChan)
 		t.savedSteps.Store(0)
+		if t.transferConfig.Protocol >= kProtocolVersion13 {
+			t.pipelineRecvChunks(ctx, ackChan, recvDataChan)
+			return
+		}
 		for ctx.Err() == nil {
 			var err error
 			var data []byte
@@ -920,7 +1055,7 @@ func (t *trzszTransfer) pipelineRecvData(ctx *pipelineContext) (<-chan int, <-ch
 			}
 
 			select {
-			case ackChan <- len(data):
+			case ackChan <- recvAck{length: len(data)}:
 			case <-ctx.Done():
 				return
 			}
@@ -953,13 +1088,13 @@ func (t *trzszTransfer) pipelineDecodeData(ctx *pipelineContext, recvDataChan <-
 		var reader readCloser
 		if t.transferConfig.Binary {
 			if compress {
-				reader, err = newZstdReader(newEscapeReader(t.transferConfig.EscapeTable, newRecvDataReader(ctx, recvDataChan)))
+				reader, err = t.newCompressReader(newEscapeReader(t.transferConfig.EscapeTable, newRecvDataReader(ctx, recvDataChan)))
 			} else {
 				reader = newEscapeReader(t.transferConfig.EscapeTable, newRecvDataReader(ctx, recvDataChan))
 			}
 		} else {
 			if compress {
-				reader, err = newZstdReader(newBase64Reader(newRecvDataReader(ctx, recvDataChan)))
+				reader, err = t.newCompressReader(newBase64Reader(newRecvDataReader(ctx, recvDataChan)))
 			} else {
 				reader = newBase64Reader(newRecvDataReader(ctx, recvDataChan))
 			}
@@ -1007,12 +1142,24 @@ func (t *trzszTransfer) pipelineSaveData(ctx *pipelineContext, file fileWriter,
 		if showProgress {
 			defer close(progressChan)
 		}
+		saved := false
+		tracker := t.resumeTracker
+		if tracker != nil {
+			defer func() {
+				if !saved {
+					_ = tracker.save()
+				}
+			}()
+		}
 		step := int64(0)
 		for data := range fileDataChan {
 			if err := writeAll(file, data); err != nil {
 				ctx.cancel(simpleTrzszError("Write file error: %v", err))
 				return
 			}
+			if tracker != nil {
+				tracker.update(data)
+			}
 			step += int64(len(data))
 			t.savedSteps.Store(step)
 			if showProgress {
@@ -1029,10 +1176,11 @@ func (t *trzszTransfer) pipelineSaveData(ctx *pipelineContext, file fileWriter,
 		if ctx.Err() != nil {
 			return
 		}
-		if step != size {
+		if size >= 0 && step != size {
 			ctx.cancel(simpleTrzszError("SaveFile expected step %d but was %d", size, step))
 			return
 		}
+		saved = true
 		ackImmediatelyChan <- struct{}{}
 	}()
 	return progressChan
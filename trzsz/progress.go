@@ -156,24 +156,183 @@ func (s *recentSpeed) getSpeed(step int64, now *time.Time) float64 {
 	return speed
 }
 
+// progressState tracks the progress events, and formats them for the renderers.
+type progressState struct {
+	fileCount   int
+	fileIdx     int
+	fileName    string
+	preSize     int64
+	fileSize    int64
+	fileStep    int64
+	fileDone    bool
+	startTime   *time.Time
+	recentSpeed recentSpeed
+	pausing     atomic.Bool
+	speedLimit  int64
+	retry       int
+	retryLimit  int
+	totalSize   int64
+	doneSize    int64
+	totalSpeed  recentSpeed
+}
+
+func (s *progressState) num(num int64) {
+	if s.retry > 0 { // only the remaining files are sent again
+		s.fileIdx = s.fileCount - int(num)
+	} else {
+		s.fileCount = int(num)
+	}
+}
+
+func (s *progressState) total(total int64) {
+	if s.retry > 0 { // only the remaining files are sent again
+		if s.totalSize > 0 && total >= 0 {
+			s.doneSize = max(s.totalSize-total, 0)
+		}
+		return
+	}
+	s.totalSize = total
+	s.doneSize = 0
+	now := timeNowFunc()
+	s.totalSpeed.initFirstStep(&now)
+}
+
+func (s *progressState) name(name string) {
+	s.fileName = name
+	s.fileIdx++
+	now := timeNowFunc()
+	s.startTime = &now
+	s.recentSpeed.initFirstStep(&now)
+	s.preSize = 0
+	s.fileStep = -1
+	s.fileDone = false
+}
+
+func (s *progressState) size(size int64) {
+	if size < 0 { // unknown size
+		s.fileSize = -1
+		return
+	}
+	s.fileSize = s.preSize + size
+}
+
+// step returns false if the step doesn't move forward.
+func (s *progressState) step(step int64) bool {
+	step += s.preSize
+	if step <= s.fileStep {
+		return false
+	}
+	s.fileStep = step
+	return true
+}
+
+// done returns false if there is nothing to show for an empty file.
+func (s *progressState) done() bool {
+	if s.fileSize == 0 {
+		return false
+	}
+	if s.fileSize < 0 {
+		s.fileSize = max(s.fileStep, 0)
+	}
+	s.fileStep = s.fileSize
+	s.doneSize += s.fileSize
+	s.fileDone = true
+	return true
+}
+
+// skip counts the size of the skipped files as done, so that the total percentage can reach 100%.
+func (s *progressState) skip(size int64) {
+	s.doneSize += max(size, 0)
+}
+
+func (s *progressState) showTotal() bool {
+	return s.fileCount > 1 && s.totalSize > 0
+}
+
+func (s *progressState) getTotalStep() int64 {
+	step := s.doneSize
+	if !s.fileDone {
+		step += max(s.fileStep, 0)
+	}
+	return min(step, s.totalSize)
+}
+
+// getPercentage returns the percentage of all the files if the total size is known, or of the current file.
+func (s *progressState) getPercentage() (float64, bool) {
+	if s.showTotal() {
+		return float64(s.getTotalStep()) * 100.0 / float64(s.totalSize), true
+	}
+	if s.fileSize < 0 {
+		return 0, false
+	}
+	if s.fileSize == 0 {
+		return 100, true
+	}
+	return float64(max(s.fileStep, 0)) * 100.0 / float64(s.fileSize), true
+}
+
+// getProgressFields formats the percentage, the transferred size, the speed and the ETA.
+func (s *progressState) getProgressFields(now *time.Time) (string, string, string, string) {
+	percentage := "100%"
+	if s.fileSize < 0 {
+		percentage = "--%"
+	} else if s.fileSize != 0 {
+		percentage = fmt.Sprintf("%.0f%%", math.Round(float64(s.fileStep)*100.0/float64(s.fileSize)))
+	}
+	total := convertSizeToString(float64(s.fileStep))
+	speed := s.recentSpeed.getSpeed(s.fileStep, now)
+	speedStr := "--- B/s"
+	etaStr := "--- ETA"
+	if speed > 0 {
+		speedStr = fmt.Sprintf("%s/s", convertSizeToString(speed))
+	}
+	if speed > 0 && s.fileSize >= 0 {
+		etaStr = fmt.Sprintf("%s ETA", convertTimeToString(math.Round(float64(s.fileSize-s.fileStep)/speed)))
+	}
+	if s.showTotal() {
+		total, speedStr, etaStr = s.getTotalProgress(now)
+	}
+	if s.speedLimit > 0 {
+		speedStr = fmt.Sprintf("%s (cap %s/s)", speedStr, convertSizeToString(float64(s.speedLimit)))
+	}
+	return percentage, total, speedStr, etaStr
+}
+
+// getTotalProgress shows the percentage, speed and ETA of all the files, instead of the current file.
+func (s *progressState) getTotalProgress(now *time.Time) (string, string, string) {
+	step := s.getTotalStep()
+	total := fmt.Sprintf("%.0f%% of %s", math.Floor(float64(step)*100.0/float64(s.totalSize)),
+		convertSizeToString(float64(s.totalSize)))
+	speed := s.totalSpeed.getSpeed(step, now)
+	if speed <= 0 {
+		return total, "--- B/s", "--- ETA"
+	}
+	return total, fmt.Sprintf("%s/s", convertSizeToString(speed)),
+		fmt.Sprintf("%s ETA", convertTimeToString(math.Round(float64(s.totalSize-step)/speed)))
+}
+
+func (s *progressState) getFileLabel() string {
+	label := s.fileName
+	if s.fileCount > 1 {
+		label = fmt.Sprintf("(%d/%d) %s", s.fileIdx, s.fileCount, s.fileName)
+	}
+	if s.retry > 0 {
+		label = fmt.Sprintf("[retry %d/%d] %s", s.retry, s.retryLimit, label)
+	}
+	return label
+}
+
 type textProgressBar struct {
+	progressState
 	writer          io.Writer
 	columns         atomic.Int32
 	tmuxPaneColumns atomic.Int32
-	fileCount       int
-	fileIdx         int
-	fileName        string
-	preSize         int64
-	fileSize        int64
-	fileStep        int64
-	startTime       *time.Time
 	lastUpdateTime  *time.Time
 	firstWrite      bool
-	recentSpeed     recentSpeed
-	pausing         atomic.Bool
 	tmuxPrefix      string
 	colorA          *colorful.Color
 	colorB          *colorful.Color
+	compact         bool
 }
 
 func newTextProgressBar(writer io.Writer, columns int32, tmuxPaneColumns int32,
@@ -196,6 +355,20 @@ func newTextProgressBar(writer io.Writer, columns int32, tmuxPaneColumns int32,
 	return progress
 }
 
+// newCompactProgressBar shows the progress in a short line without the bar, for the narrow tmux panes.
+func newCompactProgressBar(writer io.Writer, columns int32, tmuxPaneColumns int32, tmuxPrefix string) *textProgressBar {
+	progress := newTextProgressBar(writer, columns, tmuxPaneColumns, tmuxPrefix, "")
+	progress.compact = true
+	return progress
+}
+
+func (p *textProgressBar) setSpeedLimit(limit int64) {
+	if p == nil {
+		return
+	}
+	p.speedLimit = limit
+}
+
 func (p *textProgressBar) setTerminalColumns(columns int32) {
 	if p == nil {
 		return
@@ -211,40 +384,36 @@ func (p *textProgressBar) onNum(num int64) {
 	if p == nil {
 		return
 	}
-	p.fileCount = int(num)
+	p.num(num)
 	p.hideCursor()
 }
 
+func (p *textProgressBar) onTotal(total int64) {
+	if p == nil {
+		return
+	}
+	p.total(total)
+}
+
 func (p *textProgressBar) onName(name string) {
 	if p == nil {
 		return
 	}
-	p.fileName = name
-	p.fileIdx++
-	now := timeNowFunc()
-	p.startTime = &now
-	p.recentSpeed.initFirstStep(&now)
-	p.preSize = 0
-	p.fileStep = -1
+	p.name(name)
 }
 
 func (p *textProgressBar) onSize(size int64) {
 	if p == nil {
 		return
 	}
-	p.fileSize = p.preSize + size
+	p.size(size)
 }
 
 func (p *textProgressBar) onStep(step int64) {
 	if p == nil {
 		return
 	}
-	step += p.preSize
-	if step <= p.fileStep {
-		return
-	}
-	p.fileStep = step
-	if !p.pausing.Load() {
+	if p.step(step) && !p.pausing.Load() {
 		p.showProgress()
 	}
 }
@@ -253,14 +422,20 @@ func (p *textProgressBar) onDone() {
 	if p == nil {
 		return
 	}
-	if p.fileSize == 0 {
+	if !p.done() {
 		return
 	}
-	p.fileStep = p.fileSize
 	p.lastUpdateTime = nil
 	p.showProgress()
 }
 
+func (p *textProgressBar) onSkip(size int64) {
+	if p == nil {
+		return
+	}
+	p.skip(size)
+}
+
 func (p *textProgressBar) setPreSize(size int64) {
 	if p == nil {
 		return
@@ -278,6 +453,21 @@ func (p *textProgressBar) setPause(pausing bool) {
 	p.pausing.Store(pausing)
 }
 
+func (p *textProgressBar) setRetry(retry, limit int) {
+	if p == nil {
+		return
+	}
+	p.retry = retry
+	p.retryLimit = limit
+}
+
+func (p *textProgressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.showCursor()
+}
+
 func (p *textProgressBar) hideCursor() {
 	p.writeProgress("\x1b[?25l")
 }
@@ -287,11 +477,7 @@ func (p *textProgressBar) showCursor() {
 }
 
 func (p *textProgressBar) writeProgress(progress string) {
-	data := []byte(progress)
-	if p.tmuxPrefix != "" {
-		data = encodeTmuxOutput(p.tmuxPrefix, data)
-	}
-	_ = writeAll(p.writer, data)
+	writeTmuxProgress(p.writer, p.tmuxPrefix, progress)
 }
 
 func (p *textProgressBar) showProgress() {
@@ -301,19 +487,13 @@ func (p *textProgressBar) showProgress() {
 	}
 	p.lastUpdateTime = &now
 
-	percentage := "100%"
-	if p.fileSize != 0 {
-		percentage = fmt.Sprintf("%.0f%%", math.Round(float64(p.fileStep)*100.0/float64(p.fileSize)))
-	}
-	total := convertSizeToString(float64(p.fileStep))
-	speed := p.recentSpeed.getSpeed(p.fileStep, &now)
-	speedStr := "--- B/s"
-	etaStr := "--- ETA"
-	if speed > 0 {
-		speedStr = fmt.Sprintf("%s/s", convertSizeToString(speed))
-		etaStr = fmt.Sprintf("%s ETA", convertTimeToString(math.Round(float64(p.fileSize-p.fileStep)/speed)))
+	percentage, total, speedStr, etaStr := p.getProgressFields(&now)
+	var progressText string
+	if p.compact {
+		progressText = p.getCompactText(percentage, speedStr, etaStr)
+	} else {
+		progressText = p.getProgressText(percentage, total, speedStr, etaStr)
 	}
-	progressText := p.getProgressText(percentage, total, speedStr, etaStr)
 	progressText = fmt.Sprintf("\x1b[?7l%s\x1b[?7h", progressText) // no auto wrap
 
 	if p.firstWrite {
@@ -329,13 +509,36 @@ func (p *textProgressBar) showProgress() {
 	}
 }
 
+// getCompactText shows the percentage of all the files if the total size is known, then the ETA,
+// the speed and the file name as long as they fit, and erases the rest of the line.
+func (p *textProgressBar) getCompactText(percentage, speed, eta string) string {
+	if total, ok := p.getPercentage(); ok && p.showTotal() {
+		percentage = fmt.Sprintf("%.0f%%", math.Floor(total))
+	}
+	text := percentage
+	if p.fileCount > 1 {
+		text = fmt.Sprintf("%d/%d %s", p.fileIdx, p.fileCount, percentage)
+	}
+	columns := int(p.columns.Load())
+	if len(text)+len(speed)+len(eta)+2 <= columns {
+		text = fmt.Sprintf("%s %s %s", text, speed, eta)
+	} else if len(text)+len(eta)+1 <= columns {
+		text = fmt.Sprintf("%s %s", text, eta)
+	}
+	if left := columns - len(text) - 1; left >= 8 && p.fileName != "" {
+		name, length := p.fileName, runewidth.StringWidth(p.fileName)
+		if length > left {
+			name, _ = getEllipsisString(name, left)
+		}
+		text += " " + name
+	}
+	return text + "\x1b[K"
+}
+
 func (p *textProgressBar) getProgressText(percentage, total, speed, eta string) string {
 	const barMinLength = 24
 
-	left := p.fileName
-	if p.fileCount > 1 {
-		left = fmt.Sprintf("(%d/%d) %s", p.fileIdx, p.fileCount, p.fileName)
-	}
+	left := p.getFileLabel()
 	leftLength := runewidth.StringWidth(left)
 	right := fmt.Sprintf(" %s | %s | %s | %s", percentage, total, speed, eta)
 
@@ -405,7 +608,9 @@ func (p *textProgressBar) getProgressBar(length int) string {
 	}
 	totalSize := length - 2
 	fullSize := totalSize
-	if p.fileSize != 0 {
+	if p.fileSize < 0 {
+		fullSize = 0
+	} else if p.fileSize != 0 {
 		fullSize = int(math.Round((float64(totalSize) * float64(p.fileStep)) / float64(p.fileSize)))
 	}
 	emptySize := totalSize - fullSize
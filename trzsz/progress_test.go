@@ -129,6 +129,41 @@ func TestProgressWithSpeedAndEta(t *testing.T) {
 	writer.assertProgressText(1, 100, []string{"中文😀test.txt [", "] 1% | 1.00 B | 10.0 B/s | 00:10 ETA"})
 }
 
+func TestProgressWithSpeedLimit(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	callTimeNowCount := mockTimeNow([]int64{1646564135000, 1646564135100}, 0)
+
+	progress := newTextProgressBar(writer, 100, 0, "", "")
+	progress.setSpeedLimit(2048)
+	progress.onNum(1)
+	progress.onName("test.txt")
+	progress.onSize(100)
+	progress.onStep(1)
+
+	assert.Equal(2, *callTimeNowCount)
+	writer.assertBufferCount(2)
+	writer.assertProgressText(1, 100, []string{"test.txt [", "] 1% | 1.00 B | 10.0 B/s (cap 2.00 KB/s) | 00:10 ETA"})
+}
+
+func TestProgressWithUnknownSize(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	callTimeNowCount := mockTimeNow([]int64{1646564135000, 1646564135100, 1646564135200}, 0)
+
+	progress := newTextProgressBar(writer, 100, 0, "", "")
+	progress.onNum(1)
+	progress.onName("stdin")
+	progress.onSize(-1)
+	progress.onStep(10)
+	progress.onDone()
+
+	assert.Equal(3, *callTimeNowCount)
+	writer.assertBufferCount(3)
+	writer.assertProgressText(1, 100, []string{"stdin [", "] --% | 10.0 B | 100 B/s | --- ETA"})
+	writer.assertProgressText(2, 100, []string{"stdin [", "] 100% | 10.0 B |"})
+}
+
 func TestProgressNewestSpeed(t *testing.T) {
 	assert := assert.New(t)
 	writer := newTestWriter(t)
@@ -363,6 +398,46 @@ func TestProgressWithMultiFiles(t *testing.T) {
 	writer.assertProgressText(4, 80, []string{"(2/2) 英文😀test.txt [", "] 100% | 1000 B/s | 00:00 ETA"})
 }
 
+func TestProgressWithTotalSize(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	callTimeNowCount := mockTimeNow([]int64{1646564135000, 1646564135000, 1646564136000,
+		1646564137000, 1646564137000, 1646564139000, 1646564139000}, 0)
+
+	progress := newTextProgressBar(writer, 100, 0, "", "")
+	progress.onNum(2)
+	progress.onTotal(3000)
+	progress.onName("a.txt")
+	progress.onSize(1000)
+	progress.onStep(100)
+	progress.onDone()
+	progress.onName("b.txt")
+	progress.onSize(2000)
+	progress.onStep(300)
+	progress.onDone()
+
+	assert.Equal(7, *callTimeNowCount)
+	writer.assertBufferCount(5)
+	writer.assertProgressText(1, 100, []string{"(1/2) a.txt [", "] 10% | 3% of 2.93 KB | 100 B/s | 00:29 ETA"})
+	writer.assertProgressText(2, 100, []string{"(1/2) a.txt [", "] 100% | 33% of 2.93 KB | 500 B/s | 00:04 ETA"})
+	writer.assertProgressText(3, 100, []string{"(2/2) b.txt [", "] 15% | 43% of 2.93 KB | 325 B/s | 00:05 ETA"})
+	writer.assertProgressText(4, 100, []string{"(2/2) b.txt [", "] 100% | 100% of 2.93 KB | 750 B/s | 00:00 ETA"})
+}
+
+func TestProgressTotalSizeWhileRetrying(t *testing.T) {
+	assert := assert.New(t)
+
+	progress := newTextProgressBar(newTestWriter(t), 100, 0, "", "")
+	progress.onNum(3)
+	progress.onTotal(3000)
+	progress.setRetry(1, 2)
+	progress.onNum(2)
+	progress.onTotal(1800)
+	assert.Equal(1, progress.fileIdx)
+	assert.Equal(int64(3000), progress.totalSize)
+	assert.Equal(int64(1200), progress.doneSize)
+}
+
 func TestProgressInTmuxPane(t *testing.T) {
 	assert := assert.New(t)
 	writer := newTestWriter(t)
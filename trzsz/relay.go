@@ -447,6 +447,8 @@ func (r *TrzszRelay) handshake() {
 	if !action.TunnelConnected {
 		action.SupportBinary = false
 	}
+	// the relay forwards only one tunnel connection
+	action.SupportParallel = false
 	if action.Protocol > kProtocolVersion {
 		action.Protocol = kProtocolVersion
 	}
@@ -0,0 +1,379 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// progressRenderer shows the progress events in its own way.
+type progressRenderer interface {
+	progressCallback
+	setSpeedLimit(limit int64)
+	setTerminalColumns(columns int32)
+	finish()
+}
+
+const (
+	kProgressBar     = "bar"
+	kProgressCompact = "compact"
+	kProgressLog     = "log"
+	kProgressOSC     = "osc"
+)
+
+// parseProgressStyle parses the comma separated renderers, e.g. `bar,osc`. The unknown ones are ignored.
+func parseProgressStyle(style string) []string {
+	var renderers []string
+	for name := range strings.SplitSeq(style, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case kProgressBar, kProgressCompact, kProgressLog, kProgressOSC:
+			if !slices.Contains(renderers, name) {
+				renderers = append(renderers, name)
+			}
+		}
+	}
+	return renderers
+}
+
+// multiProgress drives all the renderers by the same events.
+type multiProgress struct {
+	renderers []progressRenderer
+}
+
+func (p *multiProgress) setSpeedLimit(limit int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.setSpeedLimit(limit)
+	}
+}
+
+func (p *multiProgress) setTerminalColumns(columns int32) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.setTerminalColumns(columns)
+	}
+}
+
+func (p *multiProgress) onNum(num int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onNum(num)
+	}
+}
+
+func (p *multiProgress) onTotal(total int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onTotal(total)
+	}
+}
+
+func (p *multiProgress) onName(name string) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onName(name)
+	}
+}
+
+func (p *multiProgress) onSize(size int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onSize(size)
+	}
+}
+
+func (p *multiProgress) onStep(step int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onStep(step)
+	}
+}
+
+func (p *multiProgress) onDone() {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onDone()
+	}
+}
+
+func (p *multiProgress) onSkip(size int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.onSkip(size)
+	}
+}
+
+func (p *multiProgress) setPreSize(size int64) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.setPreSize(size)
+	}
+}
+
+func (p *multiProgress) setPause(pausing bool) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.setPause(pausing)
+	}
+}
+
+func (p *multiProgress) setRetry(retry, limit int) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.setRetry(retry, limit)
+	}
+}
+
+func (p *multiProgress) finish() {
+	if p == nil {
+		return
+	}
+	for _, r := range p.renderers {
+		r.finish()
+	}
+}
+
+const kProgressLogInterval = 5 * time.Second
+
+// logProgress writes a plain line periodically and when a file is done, without any cursor movement,
+// so the output is readable even if it is not a terminal.
+type logProgress struct {
+	progressState
+	writer     io.Writer
+	tmuxPrefix string
+	lastLog    *time.Time
+}
+
+func newLogProgress(writer io.Writer, tmuxPrefix string) *logProgress {
+	return &logProgress{writer: writer, tmuxPrefix: tmuxPrefix}
+}
+
+func (p *logProgress) setSpeedLimit(limit int64) {
+	p.speedLimit = limit
+}
+
+func (p *logProgress) setTerminalColumns(columns int32) {
+}
+
+func (p *logProgress) onNum(num int64) {
+	p.num(num)
+}
+
+func (p *logProgress) onTotal(total int64) {
+	p.total(total)
+}
+
+func (p *logProgress) onName(name string) {
+	p.name(name)
+	p.lastLog = p.startTime
+}
+
+func (p *logProgress) onSize(size int64) {
+	p.size(size)
+}
+
+func (p *logProgress) onStep(step int64) {
+	if !p.step(step) || p.pausing.Load() {
+		return
+	}
+	now := timeNowFunc()
+	if p.lastLog != nil && now.Sub(*p.lastLog) < kProgressLogInterval {
+		return
+	}
+	p.writeLog(&now)
+}
+
+func (p *logProgress) onDone() {
+	if !p.done() {
+		return
+	}
+	now := timeNowFunc()
+	p.writeLog(&now)
+}
+
+func (p *logProgress) onSkip(size int64) {
+	p.skip(size)
+}
+
+func (p *logProgress) setPreSize(size int64) {
+	p.preSize = size
+}
+
+func (p *logProgress) setPause(pausing bool) {
+	p.pausing.Store(pausing)
+}
+
+func (p *logProgress) setRetry(retry, limit int) {
+	p.retry = retry
+	p.retryLimit = limit
+}
+
+func (p *logProgress) finish() {
+}
+
+func (p *logProgress) writeLog(now *time.Time) {
+	p.lastLog = now
+	percentage, total, speed, eta := p.getProgressFields(now)
+	line := fmt.Sprintf("%s: %s | %s | %s | %s\r\n", p.getFileLabel(), percentage, total, speed, eta)
+	writeTmuxProgress(p.writer, p.tmuxPrefix, line)
+}
+
+// oscProgress emits the OSC 9;4 sequences, which show the progress on the taskbar or the tab of
+// the terminals that support it, e.g. Windows Terminal, ConEmu, Ghostty and WezTerm.
+type oscProgress struct {
+	progressState
+	writer     io.Writer
+	tmuxPrefix string
+	lastState  int
+	lastValue  int
+}
+
+const (
+	kOscProgressRemove        = 0
+	kOscProgressNormal        = 1
+	kOscProgressIndeterminate = 3
+	kOscProgressPaused        = 4
+)
+
+func newOscProgress(writer io.Writer, tmuxPrefix string) *oscProgress {
+	return &oscProgress{writer: writer, tmuxPrefix: tmuxPrefix, lastState: -1, lastValue: -1}
+}
+
+func (p *oscProgress) setSpeedLimit(limit int64) {
+}
+
+func (p *oscProgress) setTerminalColumns(columns int32) {
+}
+
+func (p *oscProgress) onNum(num int64) {
+	p.num(num)
+}
+
+func (p *oscProgress) onTotal(total int64) {
+	p.total(total)
+}
+
+func (p *oscProgress) onName(name string) {
+	p.name(name)
+}
+
+func (p *oscProgress) onSize(size int64) {
+	p.size(size)
+	p.showProgress()
+}
+
+func (p *oscProgress) onStep(step int64) {
+	if p.step(step) && !p.pausing.Load() {
+		p.showProgress()
+	}
+}
+
+func (p *oscProgress) onDone() {
+	if p.done() {
+		p.showProgress()
+	}
+}
+
+func (p *oscProgress) onSkip(size int64) {
+	p.skip(size)
+	p.showProgress()
+}
+
+func (p *oscProgress) setPreSize(size int64) {
+	p.preSize = size
+}
+
+func (p *oscProgress) setPause(pausing bool) {
+	p.pausing.Store(pausing)
+	if pausing {
+		p.writeState(kOscProgressPaused, max(p.lastValue, 0))
+	} else {
+		p.showProgress()
+	}
+}
+
+func (p *oscProgress) setRetry(retry, limit int) {
+	p.retry = retry
+	p.retryLimit = limit
+}
+
+func (p *oscProgress) finish() {
+	p.writeState(kOscProgressRemove, 0)
+}
+
+func (p *oscProgress) showProgress() {
+	percentage, ok := p.getPercentage()
+	if !ok {
+		p.writeState(kOscProgressIndeterminate, 0)
+		return
+	}
+	p.writeState(kOscProgressNormal, min(int(math.Floor(percentage)), 100))
+}
+
+func (p *oscProgress) writeState(state, value int) {
+	if state == p.lastState && value == p.lastValue {
+		return
+	}
+	p.lastState, p.lastValue = state, value
+	writeTmuxProgress(p.writer, p.tmuxPrefix, fmt.Sprintf("\x1b]9;4;%d;%d\x07", state, value))
+}
+
+func writeTmuxProgress(writer io.Writer, tmuxPrefix, progress string) {
+	data := []byte(progress)
+	if tmuxPrefix != "" {
+		data = encodeTmuxOutput(tmuxPrefix, data)
+	}
+	_ = writeAll(writer, data)
+}
@@ -0,0 +1,153 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProgressStyle(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(parseProgressStyle(""))
+	assert.Nil(parseProgressStyle("fancy"))
+	assert.Equal([]string{kProgressBar}, parseProgressStyle("bar"))
+	assert.Equal([]string{kProgressCompact, kProgressOSC}, parseProgressStyle(" Compact , osc,OSC, fancy"))
+	assert.Equal([]string{kProgressLog}, parseProgressStyle("log"))
+}
+
+func TestCompactProgress(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	callTimeNowCount := mockTimeNow([]int64{1646564135000, 1646564136000, 1646564137000, 1646564138000}, 0)
+
+	progress := newCompactProgressBar(writer, 40, 0, "")
+	progress.onNum(2)
+	progress.onName("a.txt")
+	progress.onSize(1000)
+	progress.onStep(100)
+	progress.setTerminalColumns(20)
+	progress.onStep(200)
+	progress.onStep(300)
+
+	assert.Equal(4, *callTimeNowCount)
+	writer.assertBufferCount(4)
+	assert.Equal("\x1b[?7l1/2 10% 100 B/s 00:09 ETA a.txt\x1b[K\x1b[?7h", writer.buffer[1])
+	assert.Equal("\r\x1b[?7l1/2 20% 00:08 ETA\x1b[K\x1b[?7h", writer.buffer[2])
+	assert.Equal("\r\x1b[?7l1/2 30% 00:07 ETA\x1b[K\x1b[?7h", writer.buffer[3])
+}
+
+func TestLogProgress(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	callTimeNowCount := mockTimeNow([]int64{1646564135000, 1646564136000, 1646564141000, 1646564142000}, 0)
+
+	progress := newLogProgress(writer, "")
+	progress.onNum(1)
+	progress.onName("a.txt")
+	progress.onSize(1000)
+	progress.onStep(100)
+	progress.onStep(600)
+	progress.onDone()
+	progress.finish()
+
+	assert.Equal(4, *callTimeNowCount)
+	assert.Equal([]string{
+		"a.txt: 60% | 600 B | 100 B/s | 00:04 ETA\r\n",
+		"a.txt: 100% | 1000 B | 143 B/s | 00:00 ETA\r\n",
+	}, writer.buffer)
+}
+
+func TestOscProgress(t *testing.T) {
+	assert := assert.New(t)
+	writer := newTestWriter(t)
+	mockTimeNow(nil, 1646564135000)
+
+	progress := newOscProgress(writer, "")
+	progress.onNum(2)
+	progress.onName("a.txt")
+	progress.onSize(1000)
+	progress.onStep(100)
+	progress.onStep(105)
+	progress.setPause(true)
+	progress.onStep(200)
+	progress.setPause(false)
+	progress.onDone()
+	progress.onName("b.txt")
+	progress.onSize(-1)
+	progress.onStep(100)
+	progress.onDone()
+	progress.finish()
+
+	assert.Equal([]string{
+		"\x1b]9;4;1;0\x07",
+		"\x1b]9;4;1;10\x07",
+		"\x1b]9;4;4;10\x07",
+		"\x1b]9;4;1;20\x07",
+		"\x1b]9;4;1;100\x07",
+		"\x1b]9;4;3;0\x07",
+		"\x1b]9;4;1;100\x07",
+		"\x1b]9;4;0;0\x07",
+	}, writer.buffer)
+
+	// the percentage of all the files if the total size is known
+	writer.clearBuffer()
+	progress = newOscProgress(writer, "")
+	progress.onNum(2)
+	progress.onTotal(4000)
+	progress.onName("a.txt")
+	progress.onSize(1000)
+	progress.onDone()
+	progress.onName("b.txt")
+	progress.onSize(3000)
+	progress.onStep(1000)
+	assert.Equal([]string{"\x1b]9;4;1;0\x07", "\x1b]9;4;1;25\x07", "\x1b]9;4;1;50\x07"}, writer.buffer)
+}
+
+func TestMultiProgress(t *testing.T) {
+	assert := assert.New(t)
+	mockTimeNow(nil, 1646564135000)
+
+	var progress *multiProgress
+	progress.onNum(1)
+	progress.finish()
+
+	writer := newTestWriter(t)
+	progress = &multiProgress{[]progressRenderer{newTextProgressBar(writer, 100, 0, "", ""), newOscProgress(writer, "")}}
+	progress.onNum(1)
+	progress.onName("a.txt")
+	progress.onSize(100)
+	progress.onStep(100)
+	progress.finish()
+
+	writer.assertBufferCount(6)
+	assert.Equal("\x1b[?25l", writer.buffer[0])
+	assert.Equal("\x1b]9;4;1;0\x07", writer.buffer[1])
+	writer.assertProgressText(2, 100, []string{"a.txt [", "] 100% | 100 B |"})
+	assert.Equal("\x1b]9;4;1;100\x07", writer.buffer[3])
+	assert.Equal("\x1b[?25h", writer.buffer[4])
+	assert.Equal("\x1b]9;4;0;0\x07", writer.buffer[5])
+}
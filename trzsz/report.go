@@ -0,0 +1,165 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// fileReport is the result of a file in the --json output, the field names should be kept stable.
+type fileReport struct {
+	Name         string `json:"name"`
+	SavedName    string `json:"saved_name"`
+	Size         int64  `json:"size"`
+	Hash         string `json:"hash,omitempty"`
+	Directory    bool   `json:"directory,omitempty"`
+	Symlink      bool   `json:"symlink,omitempty"`
+	Skipped      bool   `json:"skipped,omitempty"`
+	Resumed      bool   `json:"resumed,omitempty"`
+	ResumeOffset int64  `json:"resume_offset,omitempty"`
+	DurationMs   int64  `json:"duration_ms"`
+	beginTime    time.Time
+}
+
+// transferReport is the summary of trz or tsz in the --json output, the field names should be kept stable.
+type transferReport struct {
+	Command        string        `json:"command"`
+	Version        string        `json:"version"`
+	Success        bool          `json:"success"`
+	Cancelled      bool          `json:"cancelled,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Message        string        `json:"message"`
+	Path           string        `json:"path,omitempty"`
+	HashAlgorithm  string        `json:"hash_algorithm"`
+	SavedNames     []string      `json:"saved_names"`
+	SkippedNames   []string      `json:"skipped_names"`
+	UnchangedNames []string      `json:"unchanged_names,omitempty"`
+	DeletedNames   []string      `json:"deleted_names,omitempty"`
+	Files          []*fileReport `json:"files"`
+	TotalSize      int64         `json:"total_size"`
+	DurationMs     int64         `json:"duration_ms"`
+	beginTime      time.Time
+}
+
+func newTransferReport(command, path string) *transferReport {
+	return &transferReport{
+		Command:      command,
+		Version:      kTrzszVersion,
+		Path:         path,
+		SavedNames:   []string{},
+		SkippedNames: []string{},
+		Files:        []*fileReport{},
+		beginTime:    time.Now(),
+	}
+}
+
+// reportFileName records a file after its name is exchanged with the peer.
+func (t *trzszTransfer) reportFileName(srcFile *sourceFile, savedName string, skipped bool) {
+	if t.report == nil {
+		return
+	}
+	t.report.Files = append(t.report.Files, &fileReport{
+		Name:      filepath.Join(srcFile.RelPath...),
+		SavedName: savedName,
+		Size:      srcFile.Size,
+		Directory: srcFile.IsDir,
+		Symlink:   srcFile.isSymlink(),
+		Skipped:   skipped,
+		beginTime: time.Now(),
+	})
+}
+
+// reportFileData records the data of the last file after its hash is verified.
+// The size is the number of bytes actually transferred, less than the file size if resumed.
+func (t *trzszTransfer) reportFileData(size int64, digest []byte) {
+	if t.report == nil || len(t.report.Files) == 0 {
+		return
+	}
+	file := t.report.Files[len(t.report.Files)-1]
+	if size > file.Size {
+		file.Size = size // the archive of directory
+	}
+	if size < file.Size {
+		file.Resumed = true
+		file.ResumeOffset = file.Size - size
+	}
+	file.Hash = hex.EncodeToString(digest)
+	file.DurationMs = time.Since(file.beginTime).Milliseconds()
+}
+
+func (t *trzszTransfer) reportCancelled() {
+	if t.report != nil {
+		t.report.Cancelled = true
+	}
+}
+
+func (t *trzszTransfer) reportError(err error) {
+	if t.report != nil {
+		t.report.Error = err.Error()
+	}
+}
+
+func (t *trzszTransfer) reportSavedNames(names []string) {
+	if t.report != nil && names != nil {
+		t.report.SavedNames = names
+	}
+}
+
+// formatReport returns the JSON summary to print instead of the message, or the message if --json is not set.
+func (t *trzszTransfer) formatReport(msg string) string {
+	if t.report == nil {
+		return msg
+	}
+	report := t.report
+	report.Success = report.Error == "" && !report.Cancelled
+	report.Message = msg
+	report.HashAlgorithm = t.hashName()
+	if t.skippedFiles != nil {
+		report.SkippedNames = t.skippedFiles
+	}
+	report.UnchangedNames = t.unchangedFiles
+	report.DeletedNames = t.deletedFiles
+	report.TotalSize = 0
+	for _, file := range report.Files {
+		if !file.Skipped {
+			report.TotalSize += file.Size
+		}
+	}
+	report.DurationMs = time.Since(report.beginTime).Milliseconds()
+	buf, err := json.Marshal(report)
+	if err != nil {
+		return msg
+	}
+	return string(buf)
+}
+
+// writeReport writes the JSON summary in a single line, without any escape sequence.
+func (t *trzszTransfer) writeReport(writer io.Writer, msg string) {
+	_ = writeAll(writer, []byte(t.formatReport(msg)+"\n"))
+}
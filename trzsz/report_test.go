@@ -0,0 +1,145 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "dir"), 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "a.txt"), []byte("hello"), 0644))
+	require.Nil(os.WriteFile(filepath.Join(dstPath, "a.txt"), []byte("existing"), 0644))
+
+	srcFiles, err := checkPathsReadable([]string{filepath.Join(srcPath, "a.txt"), filepath.Join(srcPath, "dir")},
+		true, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	sender.transferConfig.Directory = true
+	receiver.transferConfig.Directory = true
+	sender.report = newTransferReport("tsz", "")
+	receiver.report = newTransferReport("trz", dstPath)
+	remoteNames, localNames := transferFiles(t, sender, receiver, srcFiles, dstPath, nil, nil)
+	sender.reportSavedNames(remoteNames)
+	receiver.reportSavedNames(localNames)
+
+	digest := md5.Sum([]byte("hello"))
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		var report transferReport
+		require.Nil(json.Unmarshal([]byte(transfer.formatReport("Saved 2 files")), &report))
+		assert.True(report.Success)
+		assert.Equal("Saved 2 files", report.Message)
+		assert.Equal(kTrzszVersion, report.Version)
+		assert.Equal("MD5", report.HashAlgorithm)
+		assert.Equal([]string{"a.txt.0", "dir"}, report.SavedNames)
+		assert.Equal(int64(5), report.TotalSize)
+		require.Equal(2, len(report.Files))
+		assert.Equal("a.txt", report.Files[0].Name)
+		assert.Equal("a.txt.0", report.Files[0].SavedName)
+		assert.Equal(int64(5), report.Files[0].Size)
+		assert.Equal(hex.EncodeToString(digest[:]), report.Files[0].Hash)
+		assert.False(report.Files[0].Resumed)
+		assert.Equal("dir", report.Files[1].Name)
+		assert.True(report.Files[1].Directory)
+	}
+	assert.Equal("trz", receiver.report.Command)
+	assert.Equal(dstPath, receiver.report.Path)
+
+	// the message is kept without --json
+	sender.report = nil
+	assert.Equal("Saved 2 files", sender.formatReport("Saved 2 files"))
+
+	receiver.reportError(simpleTrzszError("Stopped"))
+	var report map[string]any
+	require.Nil(json.Unmarshal([]byte(receiver.formatReport("Stopped")), &report))
+	assert.Equal(false, report["success"])
+	assert.Equal("Stopped", report["error"])
+}
+
+func TestServerExitReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	captureStdout := func(exit func()) string {
+		t.Helper()
+		reader, writer, err := os.Pipe()
+		require.Nil(err)
+		stdout := os.Stdout
+		os.Stdout = writer
+		exit()
+		os.Stdout = stdout
+		require.Nil(writer.Close())
+		output, err := io.ReadAll(reader)
+		require.Nil(err)
+		return string(output)
+	}
+	// the report line is exactly the JSON and a newline, without any escape sequence
+	assertReportLine := func(line string) {
+		t.Helper()
+		var report transferReport
+		require.Nil(json.Unmarshal([]byte(line), &report))
+		buf, err := json.Marshal(&report)
+		require.Nil(err)
+		assert.Equal(string(buf)+"\n", line)
+	}
+
+	// the JSON is written raw after resetting the terminal
+	_, receiver := newTransferPair(kProtocolVersion)
+	receiver.report = newTransferReport("trz", "/tmp")
+	output := captureStdout(func() { receiver.serverExit("Saved 1 file") })
+	reset := "\x1b[u\x1b[0J\x1b[?25h"
+	if isRunningOnWindows() {
+		reset = "\x1b[H\x1b[2J\x1b[?1049l\x1b[?25h"
+	}
+	require.True(strings.HasPrefix(output, reset))
+	assertReportLine(strings.TrimPrefix(output, reset))
+	assert.Contains(output, `"message":"Saved 1 file"`)
+
+	// no highlight if the terminal was reset already
+	_, receiver = newTransferPair(kProtocolVersion)
+	receiver.report = newTransferReport("trz", "/tmp")
+	receiver.termReseted.Store(true)
+	assertReportLine(captureStdout(func() { receiver.serverExit("Stopped") }))
+}
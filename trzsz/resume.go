@@ -0,0 +1,158 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const kResumeFileSuffix = ".trzsz-resume"
+
+const kResumeSaveInterval = time.Second
+
+// resumeState is saved beside the partial file, so that an interrupted
+// transfer can continue from the saved offset in a later session.
+type resumeState struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Hash    string `json:"hash"`
+	Offset  int64  `json:"offset"`
+	State   []byte `json:"state"`
+}
+
+type resumeTracker struct {
+	path     string
+	state    resumeState
+	hasher   hash.Hash
+	saveTime time.Time
+}
+
+func getResumeFilePath(partPath string) string {
+	return strings.TrimSuffix(partPath, kPartialFileSuffix) + kResumeFileSuffix
+}
+
+func (r *resumeTracker) update(data []byte) {
+	r.hasher.Write(data)
+	r.state.Offset += int64(len(data))
+	if time.Since(r.saveTime) >= kResumeSaveInterval {
+		_ = r.save()
+	}
+}
+
+func (r *resumeTracker) save() error {
+	state, err := marshalHasher(r.hasher)
+	if err != nil {
+		return err
+	}
+	r.state.State = state
+	r.saveTime = time.Now()
+	jstr, err := json.Marshal(&r.state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, jstr, 0600)
+}
+
+func (t *trzszTransfer) loadResumeState(partPath string, srcFile *sourceFile, partSize int64) *resumeState {
+	if srcFile.ModTime == nil || partSize <= 0 {
+		return nil
+	}
+	buf, err := os.ReadFile(getResumeFilePath(partPath))
+	if err != nil {
+		return nil
+	}
+	var state resumeState
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil
+	}
+	if state.Size != srcFile.Size || state.ModTime != *srcFile.ModTime || state.Hash != t.hashName() ||
+		state.Offset <= 0 || state.Offset > partSize || state.Offset > srcFile.Size {
+		return nil
+	}
+	if _, err := t.restoreHasher(state.State); err != nil {
+		return nil
+	}
+	return &state
+}
+
+func (t *trzszTransfer) newResumeTracker(partPath string, srcFile *sourceFile, offset int64,
+	state []byte) (*resumeTracker, error) {
+	hasher, err := t.restoreHasher(state)
+	if err != nil {
+		return nil, err
+	}
+	tracker := &resumeTracker{
+		path:   getResumeFilePath(partPath),
+		hasher: hasher,
+		state: resumeState{
+			Size:    srcFile.Size,
+			ModTime: *srcFile.ModTime,
+			Hash:    t.hashName(),
+			Offset:  offset,
+		},
+	}
+	if err := tracker.save(); err != nil {
+		return nil, err
+	}
+	t.addCreatedFiles(tracker.path)
+	return tracker, nil
+}
+
+func (t *trzszTransfer) sendResumeOffset(file *os.File, srcFile *sourceFile, tgtFile *targetFile,
+	progress progressCallback) (int64, error) {
+	if tgtFile.Size > srcFile.Size {
+		return 0, simpleTrzszError("Resume offset [%d] > [%d]", tgtFile.Size, srcFile.Size)
+	}
+	if _, err := file.Seek(tgtFile.Size, io.SeekStart); err != nil {
+		return 0, err
+	}
+	t.resumeHashState = tgtFile.State
+	if progress != nil {
+		progress.onSize(srcFile.Size)
+		progress.setPreSize(tgtFile.Size)
+	}
+	return srcFile.Size - tgtFile.Size, nil
+}
+
+func (t *trzszTransfer) recvResumeOffset(file *os.File, srcFile *sourceFile, tgtFile *targetFile,
+	progress progressCallback) error {
+	if _, err := file.Seek(tgtFile.Size, io.SeekStart); err != nil {
+		return err
+	}
+	if err := file.Truncate(tgtFile.Size); err != nil {
+		return err
+	}
+	t.resumeHashState = tgtFile.State
+	if progress != nil {
+		progress.onSize(srcFile.Size)
+		progress.setPreSize(tgtFile.Size)
+	}
+	return nil
+}
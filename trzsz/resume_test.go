@@ -0,0 +1,189 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type preSizeProgress struct {
+	preSize int64
+}
+
+func (p *preSizeProgress) onNum(num int64)           {}
+func (p *preSizeProgress) onTotal(total int64)       {}
+func (p *preSizeProgress) onName(name string)        {}
+func (p *preSizeProgress) onSize(size int64)         {}
+func (p *preSizeProgress) onStep(step int64)         {}
+func (p *preSizeProgress) onDone()                   {}
+func (p *preSizeProgress) onSkip(size int64)         {}
+func (p *preSizeProgress) setPause(pausing bool)     {}
+func (p *preSizeProgress) setRetry(retry, limit int) {}
+func (p *preSizeProgress) setPreSize(size int64) {
+	p.preSize = size
+}
+
+func TestResumeFromSidecar(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "file.bin"), content, 0644))
+	srcFiles, err := checkPathsReadable([]string{filepath.Join(srcPath, "file.bin")}, false, false, nil)
+	require.Nil(err)
+
+	// an earlier session saved 300000 bytes, followed by some unacknowledged junk
+	partPath := getPartialFilePath(filepath.Join(dstPath, "file.bin"))
+	offset := int64(300000)
+	require.Nil(os.WriteFile(partPath, append(bytes.Clone(content[:offset]), "junk"...), 0644))
+	transfer := newTransfer(nil, nil)
+	tracker, err := transfer.newResumeTracker(partPath, srcFiles[0], 0, nil)
+	require.Nil(err)
+	tracker.update(content[:offset])
+	require.Nil(tracker.save())
+
+	buf, err := os.ReadFile(getResumeFilePath(partPath))
+	require.Nil(err)
+	var state resumeState
+	require.Nil(json.Unmarshal(buf, &state))
+	assert.Equal(offset, state.Offset)
+	assert.Equal(int64(len(content)), state.Size)
+	assert.Equal("MD5", state.Hash)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	sender.transferConfig.Overwrite = true
+	receiver.transferConfig.Overwrite = true
+	receiver.report = newTransferReport("trz", dstPath)
+	var sendProgress, recvProgress preSizeProgress
+	_, localNames := transferFiles(t, sender, receiver, srcFiles, dstPath, &sendProgress, &recvProgress)
+	require.Equal(1, len(receiver.report.Files))
+	assert.True(receiver.report.Files[0].Resumed)
+	assert.Equal(offset, receiver.report.Files[0].ResumeOffset)
+	assert.Equal(int64(len(content)), receiver.report.Files[0].Size)
+	assert.Equal([]string{"file.bin"}, localNames)
+	assert.Equal(offset, sendProgress.preSize)
+	assert.Equal(offset, recvProgress.preSize)
+
+	assertFileEqual(t, filepath.Join(srcPath, "file.bin"), filepath.Join(dstPath, "file.bin"))
+	_, err = os.Stat(partPath)
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(getResumeFilePath(partPath))
+	assert.True(os.IsNotExist(err))
+
+	// the sidecar is ignored if the source file has changed
+	require.Nil(os.WriteFile(partPath, content[:offset], 0644))
+	tracker, err = transfer.newResumeTracker(partPath, srcFiles[0], 0, nil)
+	require.Nil(err)
+	tracker.update(content[:offset])
+	require.Nil(tracker.save())
+	srcFiles[0].Size--
+	assert.Nil(receiver.loadResumeState(partPath, srcFiles[0], offset))
+	srcFiles[0].Size++
+	assert.NotNil(receiver.loadResumeState(partPath, srcFiles[0], offset))
+	assert.Nil(receiver.loadResumeState(partPath, srcFiles[0], offset-1))
+}
+
+func TestAppendExistingFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src", "file.log")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(filepath.Dir(srcPath), 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	// no delta transfer for the old protocol or the small file, the existing file is appended
+	for _, c := range []struct {
+		protocol int
+		size     int
+	}{
+		{kProtocolVersion9, kDeltaMinBasisSize * 4},
+		{kProtocolVersion9, kDeltaMinBasisSize / 4},
+		{kProtocolVersion, kDeltaMinBasisSize / 4},
+	} {
+		content := bytes.Repeat([]byte("a line of the log\n"), c.size/16)
+		offset := int64(len(content) / 2)
+		require.Nil(os.WriteFile(srcPath, content, 0644))
+		require.Nil(os.WriteFile(filepath.Join(dstPath, "file.log"), content[:offset], 0644))
+		srcFiles, err := checkPathsReadable([]string{srcPath}, false, false, nil)
+		require.Nil(err)
+
+		sender, receiver := newTransferPair(c.protocol)
+		receiver.transferConfig.OnConflict = kConflictOverwrite
+		var sendProgress, recvProgress preSizeProgress
+		_, localNames := transferFiles(t, sender, receiver, srcFiles, dstPath, &sendProgress, &recvProgress)
+		assert.Equal([]string{"file.log"}, localNames)
+		assert.Equal(offset, sendProgress.preSize)
+		assert.Equal(offset, recvProgress.preSize)
+		assertFileEqual(t, srcPath, filepath.Join(dstPath, "file.log"))
+		_, err = os.Stat(getPartialFilePath(filepath.Join(dstPath, "file.log")))
+		assert.True(os.IsNotExist(err))
+	}
+
+	// the symlink target is not followed, it is replaced by the new file
+	if runtime.GOOS != "windows" {
+		content := bytes.Repeat([]byte("a line of the log\n"), kDeltaMinBasisSize/64)
+		require.Nil(os.WriteFile(srcPath, content, 0644))
+		outsidePath := filepath.Join(testPath, "outside.log")
+		require.Nil(os.WriteFile(outsidePath, content[:len(content)/2], 0644))
+		targetPath := filepath.Join(dstPath, "file.log")
+		require.Nil(os.Remove(targetPath))
+		require.Nil(os.Symlink(outsidePath, targetPath))
+		srcFiles, err := checkPathsReadable([]string{srcPath}, false, false, nil)
+		require.Nil(err)
+
+		sender, receiver := newTransferPair(kProtocolVersion)
+		receiver.transferConfig.OnConflict = kConflictOverwrite
+		var sendProgress, recvProgress preSizeProgress
+		transferFiles(t, sender, receiver, srcFiles, dstPath, &sendProgress, &recvProgress)
+		assert.Equal(int64(0), recvProgress.preSize)
+		assertFileEqual(t, srcPath, targetPath)
+		stat, err := os.Lstat(targetPath)
+		require.Nil(err)
+		assert.True(stat.Mode().IsRegular())
+		outside, err := os.ReadFile(outsidePath)
+		require.Nil(err)
+		assert.Equal(content[:len(content)/2], outside)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const kMaxRetryBackoff = 8 * time.Second
+
+func retryableTrzszError(format string, a ...any) *trzszError {
+	err := simpleTrzszError(format, a...)
+	err.retryable = true
+	return err
+}
+
+func isRetryableError(err error) bool {
+	if err == errReceiveDataTimeout {
+		return true
+	}
+	if e, ok := err.(*trzszError); ok {
+		return e.retryable || e.errType == "RETRY"
+	}
+	return false
+}
+
+func getRetryBackoff(attempt int) time.Duration {
+	return min(time.Second<<(attempt-1), kMaxRetryBackoff)
+}
+
+// sendFilesWithRetry sends the files again after a recoverable failure,
+// the sent files are skipped and the partial file is resumed by the receiver.
+func (t *trzszTransfer) sendFilesWithRetry(sourceFiles []*sourceFile, progress progressCallback,
+	client bool) ([]string, error) {
+	for attempt := 1; ; attempt++ {
+		remoteNames, err := t.sendFiles(sourceFiles, progress)
+		if err == nil && attempt > 1 {
+			return t.doneNames, nil // including the names sent before retrying
+		}
+		if err == nil {
+			return remoteNames, nil
+		}
+		if err := t.prepareRetry(err, attempt, client, progress); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// recvFilesWithRetry receives the files again after a recoverable failure.
+func (t *trzszTransfer) recvFilesWithRetry(path string, progress progressCallback, client bool) ([]string, error) {
+	for attempt := 1; ; attempt++ {
+		localNames, err := t.recvFiles(path, progress)
+		if err == nil && attempt > 1 {
+			return t.doneNames, nil // including the names saved before retrying
+		}
+		if err == nil {
+			return localNames, nil
+		}
+		if err := t.prepareRetry(err, attempt, client, progress); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *trzszTransfer) prepareRetry(err error, attempt int, client bool, progress progressCallback) error {
+	if attempt > t.transferConfig.Retry || !isRetryableError(err) || len(t.workers) > 0 ||
+		t.streamInput != nil || t.streamOutput != nil || t.stopped.Load() {
+		return err
+	}
+	if e, ok := err.(*trzszError); !ok || e.errType != "RETRY" {
+		// let the peer stop transferring and retry too
+		_ = t.sendInteger("RETRY", int64(attempt))
+	}
+
+	// wake up the stale readers, and drop the data of the failed transfer
+	t.buffer.stopBuffer()
+	backoff := getRetryBackoff(attempt)
+	if client {
+		t.cleanInput(max(backoff, t.cleanTimeout))
+	} else {
+		t.cleanInput(100 * time.Millisecond)
+	}
+	t.buffer.resetBuffer()
+	t.stopped.Store(false)
+
+	// the client asks to retry after the server is ready
+	if client {
+		if err := t.sendInteger("AGAIN", int64(attempt)); err != nil {
+			return err
+		}
+	}
+	var timeout <-chan time.Time
+	if t.transferConfig.Timeout > 0 {
+		timeout = time.After(backoff + time.Duration(t.transferConfig.Timeout)*time.Second)
+	}
+	if err := t.waitRetryLine(attempt, timeout); err != nil {
+		return err
+	}
+	if !client {
+		if err := t.sendInteger("AGAIN", int64(attempt)); err != nil {
+			return err
+		}
+	}
+
+	t.partialFiles = nil // the partial file is resumed instead of committed
+	if t.report != nil && len(t.report.Files) > t.doneFiles {
+		t.report.Files = t.report.Files[:t.doneFiles]
+	}
+	if progress != nil {
+		progress.setRetry(attempt, t.transferConfig.Retry)
+	}
+	return nil
+}
+
+// waitRetryLine skips the lines of the failed transfer until the expected line of retrying.
+func (t *trzszTransfer) waitRetryLine(attempt int, timeout <-chan time.Time) error {
+	expect := fmt.Appendf(nil, "#AGAIN:%d", attempt)
+	for {
+		line, err := t.recvLine("AGAIN", true, timeout)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(bytes.TrimRight(line, "!\r"), expect) {
+			return nil
+		}
+		if bytes.HasPrefix(line, []byte("#AGAIN:")) {
+			return simpleTrzszError("Retry attempt %s <> %s", line[7:], strconv.Itoa(attempt))
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stallWriter drops all the data from the nth chunk of the file until retrying, only once.
+type stallWriter struct {
+	writer    io.Writer
+	stallFile string
+	stallAt   int
+	frames    int
+	dropping  bool
+	stalled   bool
+	mutex     sync.Mutex
+}
+
+func (w *stallWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if bytes.HasPrefix(p, []byte("#AGAIN:")) {
+		w.dropping = false
+	} else if bytes.HasPrefix(p, []byte(w.stallFile)) && !w.stalled {
+		w.frames = 0
+	} else if bytes.HasPrefix(p, []byte("#DATA:")) && len(p) >= 100 && w.frames >= 0 {
+		w.frames++
+		if w.frames == w.stallAt {
+			w.dropping = true
+			w.stalled = true
+			w.frames = -1
+		}
+	}
+	if w.dropping {
+		return len(p), nil
+	}
+	return w.writer.Write(p)
+}
+
+func TestRetryTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	random := rand.New(rand.NewSource(5))
+	contents := map[string][]byte{"a.bin": make([]byte, 20*1024), "b.bin": make([]byte, 200*1024)}
+	for name, content := range contents {
+		random.Read(content)
+		require.Nil(os.WriteFile(filepath.Join(srcPath, name), content, 0644))
+	}
+	files, err := checkPathsReadable([]string{filepath.Join(srcPath, "a.bin"), filepath.Join(srcPath, "b.bin")},
+		false, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		transfer.transferConfig.CompressType = kCompressNo
+		transfer.transferConfig.Timeout = 1
+		transfer.transferConfig.Retry = 2
+		transfer.bufferSize.Store(10 * 1024)
+		transfer.report = &transferReport{}
+	}
+	sender.writer = &stallWriter{writer: sender.writer, stallFile: fmt.Sprintf("#SIZE:%d", 200*1024), stallAt: 3, frames: -1}
+
+	type result struct {
+		names []string
+		err   error
+	}
+	recvChan := make(chan result, 1)
+	go func() {
+		names, err := receiver.recvFilesWithRetry(dstPath, nil, true)
+		recvChan <- result{names, err}
+	}()
+	remoteNames, err := sender.sendFilesWithRetry(files, nil, false)
+	require.Nil(err)
+	res := <-recvChan
+	require.Nil(res.err)
+
+	assert.Equal([]string{"a.bin", "b.bin"}, remoteNames)
+	assert.Equal([]string{"a.bin", "b.bin"}, res.names)
+	for name, content := range contents {
+		buf, err := os.ReadFile(filepath.Join(dstPath, name))
+		require.Nil(err)
+		assert.True(bytes.Equal(content, buf))
+	}
+	require.Len(receiver.report.Files, 2)
+	assert.False(receiver.report.Files[0].Resumed)
+	assert.True(receiver.report.Files[1].Resumed)
+}
+
+func TestRetryDirectory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	random := rand.New(rand.NewSource(6))
+	contents := map[string][]byte{"a.bin": make([]byte, 20*1024), "b.bin": make([]byte, 200*1024)}
+	require.Nil(os.Mkdir(filepath.Join(srcPath, "dir"), 0755))
+	for name, content := range contents {
+		random.Read(content)
+		require.Nil(os.WriteFile(filepath.Join(srcPath, "dir", name), content, 0644))
+	}
+	files, err := checkPathsReadable([]string{filepath.Join(srcPath, "dir")}, true, false, nil)
+	require.Nil(err)
+
+	sender, receiver := newTransferPair(kProtocolVersion)
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		transfer.transferConfig.Directory = true
+		transfer.transferConfig.CompressType = kCompressNo
+		transfer.transferConfig.Timeout = 1
+		transfer.transferConfig.Retry = 2
+		transfer.bufferSize.Store(10 * 1024)
+	}
+	sender.writer = &stallWriter{writer: sender.writer, stallFile: "#SIZE:", stallAt: 10, frames: -1}
+
+	type result struct {
+		names []string
+		err   error
+	}
+	recvChan := make(chan result, 1)
+	go func() {
+		names, err := receiver.recvFilesWithRetry(dstPath, nil, true)
+		recvChan <- result{names, err}
+	}()
+	remoteNames, err := sender.sendFilesWithRetry(files, nil, false)
+	require.Nil(err)
+	res := <-recvChan
+	require.Nil(res.err)
+
+	assert.Equal([]string{"dir"}, remoteNames)
+	assert.Equal([]string{"dir"}, res.names)
+	assert.NoDirExists(filepath.Join(dstPath, "dir.0"))
+	for name, content := range contents {
+		buf, err := os.ReadFile(filepath.Join(dstPath, "dir", name))
+		require.Nil(err)
+		assert.True(bytes.Equal(content, buf))
+	}
+	assert.Len(files[0].SubFiles, 2)
+}
+
+func TestRetryNotConfigured(t *testing.T) {
+	transfer := newTransfer(nil, nil)
+	assert.Equal(t, errReceiveDataTimeout, transfer.prepareRetry(errReceiveDataTimeout, 1, true, nil))
+	transfer.transferConfig.Retry = 1
+	err := simpleTrzszError("Write file error")
+	assert.Equal(t, err, transfer.prepareRetry(err, 1, true, nil))
+}
+
+func TestRetryConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	args := &baseArgs{Bufsize: bufferSize{1024}, Timeout: 10, Retry: 2}
+	transfer := newTransfer(newTestWriter(t), nil)
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion13}, nil, noTmuxMode, 0))
+	assert.Equal(0, transfer.transferConfig.Retry)
+
+	transfer = newTransfer(newTestWriter(t), nil)
+	assert.Nil(transfer.sendConfig(args, &transferAction{Protocol: kProtocolVersion, Retry: 3}, nil, noTmuxMode, 0))
+	assert.Equal(3, transfer.transferConfig.Retry)
+}
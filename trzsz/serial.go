@@ -0,0 +1,142 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+const (
+	kParityNone = "none"
+	kParityOdd  = "odd"
+	kParityEven = "even"
+)
+
+const (
+	kFlowNone    = "none"
+	kFlowRtsCts  = "rtscts"
+	kFlowXonXoff = "xonxoff"
+)
+
+// press `Ctrl-]` to exit, as telnet does
+const kSerialExitKey byte = 0x1d
+
+type serialConfig struct {
+	baud   int
+	parity string
+	flow   string
+}
+
+// serialInput reads the user input, and exits on the exit key.
+type serialInput struct {
+	reader io.Reader
+	exit   func()
+}
+
+func (s *serialInput) Read(buf []byte) (int, error) {
+	n, err := s.reader.Read(buf)
+	if idx := bytes.IndexByte(buf[:n], kSerialExitKey); idx >= 0 {
+		s.exit()
+		return idx, nil
+	}
+	return n, err
+}
+
+// serialOutput reads the output of the serial port, and exits if the port is closed, e.g. unplugged.
+type serialOutput struct {
+	reader io.Reader
+	exit   func()
+}
+
+func (s *serialOutput) Read(buf []byte) (int, error) {
+	n, err := s.reader.Read(buf)
+	if err != nil {
+		s.exit()
+	}
+	return n, err
+}
+
+func runSerial(args *trzszArgs) int {
+	port, err := openSerialPort(args.Serial, &serialConfig{baud: args.Baud, parity: args.Parity, flow: args.Flow})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open serial port failed: %v\r\n", err)
+		return -1
+	}
+	defer func() { _ = port.Close() }()
+
+	// set stdin in raw mode
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stdin make raw failed: %v\r\n", err)
+			return -2
+		}
+		defer func() { _ = term.Restore(fd, state) }()
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	exit := func() { once.Do(func() { close(done) }) }
+
+	var columns int32
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		columns = int32(width)
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "Connected to %s at %d bps, press Ctrl-] to exit.\r\n", args.Serial, args.Baud)
+	filter := NewTrzszFilter(&serialInput{os.Stdin, exit}, os.Stdout, port, &serialOutput{port, exit}, TrzszOptions{
+		TerminalColumns: columns,
+		DetectDragFile:  args.DragFile,
+		DetectTraceLog:  args.TraceLog,
+		EnableZmodem:    args.Zmodem,
+		EnableOSC52:     args.OSC52,
+	})
+	filter.readTrzszConfig()
+	if filter.progressStyle.Load() == nil && !term.IsTerminal(int(os.Stdout.Fd())) {
+		filter.SetProgressStyle(kProgressLog)
+	}
+	watchTerminalResize(filter.SetTerminalColumns, done)
+
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigterm)
+
+	select {
+	case <-done:
+	case <-sigterm:
+	}
+	filter.Close()
+	// the stdout is closed by the filter if the serial port is closed
+	fmt.Fprintf(os.Stderr, "\r\nDisconnected from %s.\r\n", args.Serial)
+	return 0
+}
@@ -0,0 +1,183 @@
+//go:build linux
+
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestSerialPort(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// the pseudo-terminal pair stands in for the device
+	device, tty, err := pty.Open()
+	require.Nil(err)
+	defer func() { _ = device.Close() }()
+	defer func() { _ = tty.Close() }()
+
+	_, err = openSerialPort(tty.Name(), &serialConfig{baud: 12345})
+	assert.NotNil(err)
+	_, err = openSerialPort(filepath.Join(t.TempDir(), "ttyUSB0"), &serialConfig{baud: 115200})
+	assert.NotNil(err)
+
+	port, err := openSerialPort(tty.Name(), &serialConfig{baud: 9600, parity: kParityEven, flow: kFlowRtsCts})
+	require.Nil(err)
+	termios, err := unix.IoctlGetTermios(int(port.Fd()), unix.TCGETS)
+	require.Nil(err)
+	assert.Zero(termios.Lflag & (unix.ECHO | unix.ICANON | unix.ISIG))
+	assert.Zero(termios.Iflag & (unix.ICRNL | unix.IXON))
+	assert.Zero(termios.Oflag & unix.OPOST)
+	assert.Equal(uint32(unix.CS8|unix.CRTSCTS), termios.Cflag&(unix.CSIZE|unix.CRTSCTS))
+	assert.Equal(uint32(unix.B9600), termios.Cflag&unix.CBAUD)
+
+	// the pseudo-terminal ignores the parity
+	termios = &unix.Termios{Cflag: unix.CSTOPB | unix.CRTSCTS, Iflag: unix.ICRNL | unix.IXON}
+	require.Nil(makeSerialTermios(termios, &serialConfig{baud: 115200, parity: kParityOdd, flow: kFlowXonXoff}))
+	assert.Equal(uint32(unix.CS8|unix.PARENB|unix.PARODD), termios.Cflag&(unix.CSIZE|unix.PARENB|unix.PARODD|
+		unix.CSTOPB|unix.CRTSCTS))
+	assert.Equal(uint32(unix.IXON|unix.IXOFF|unix.INPCK), termios.Iflag)
+	assert.Equal(uint32(unix.B115200), termios.Cflag&unix.CBAUD)
+	require.Nil(makeSerialTermios(termios, &serialConfig{baud: 115200, parity: kParityEven}))
+	assert.Equal(uint32(unix.CS8|unix.PARENB), termios.Cflag&(unix.CSIZE|unix.PARENB|unix.PARODD))
+	assert.Equal(uint32(unix.INPCK), termios.Iflag)
+	require.Nil(makeSerialTermios(termios, &serialConfig{baud: 115200, parity: kParityNone}))
+	assert.Equal(uint32(unix.CS8), termios.Cflag&(unix.CSIZE|unix.PARENB|unix.PARODD))
+	assert.Zero(termios.Iflag)
+
+	// the bytes are passed through as is
+	data := []byte("\r\n\x03\x11\x13\x1d\x7f\xff")
+	_, err = device.Write(data)
+	require.Nil(err)
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(port, buf)
+	require.Nil(err)
+	assert.Equal(data, buf)
+	_, err = port.Write(data)
+	require.Nil(err)
+	_, err = io.ReadFull(device, buf)
+	require.Nil(err)
+	assert.Equal(data, buf)
+
+	// closing the port stops reading
+	exited := make(chan struct{})
+	output := &serialOutput{port, func() { close(exited) }}
+	go func() { _, _ = output.Read(buf) }()
+	time.Sleep(100 * time.Millisecond)
+	require.Nil(port.Close())
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		assert.Fail("read from the closed port")
+	}
+
+	// exit on `Ctrl-]`
+	exit := false
+	input := &serialInput{&fakeReader{data: []byte("ls\r\x1dexit")}, func() { exit = true }}
+	n, err := input.Read(buf)
+	assert.Nil(err)
+	assert.Equal("ls\r", string(buf[:n]))
+	assert.True(exit)
+}
+
+type fakeReader struct {
+	data []byte
+}
+
+func (r *fakeReader) Read(buf []byte) (int, error) {
+	return copy(buf, r.data), nil
+}
+
+func TestSerialTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	require.Nil(os.WriteFile(filepath.Join(testPath, "a.txt"), []byte("serial\r\ncontent\x00"), 0644))
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	device, tty, err := pty.Open()
+	require.Nil(err)
+	defer func() { _ = device.Close() }()
+	defer func() { _ = tty.Close() }()
+	port, err := openSerialPort(tty.Name(), &serialConfig{baud: 115200})
+	require.Nil(err)
+	defer func() { _ = port.Close() }()
+
+	clientInReader, clientInWriter := io.Pipe()
+	defer func() { _ = clientInWriter.Close() }()
+	filter := NewTrzszFilter(clientInReader, nopWriteCloser{io.Discard}, port, port, TrzszOptions{ManualTransfer: true})
+	defer filter.Close()
+
+	// `tsz a.txt` on the serial console of the board
+	server := newTransfer(device, nil)
+	wrapTransferInput(server, device, false)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			_, _ = device.Write([]byte("\x1b7\x07::TRZSZ:TRANSFER:S:1.2.0:0000000000001\r\n"))
+			action, err := server.recvAction()
+			if err != nil {
+				return err
+			}
+			if err := server.sendConfig(&baseArgs{Timeout: 10}, action, nil, noTmuxMode, 0); err != nil {
+				return err
+			}
+			files, err := checkPathsReadable([]string{filepath.Join(testPath, "a.txt")}, false, false, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := server.sendFiles(files, nil); err != nil {
+				return err
+			}
+			_, err = server.recvExit()
+			return err
+		}()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results, err := filter.Download(ctx, dstPath, TransferOptions{})
+	require.Nil(err)
+	require.Nil(<-serverErr)
+	require.Equal(1, len(results))
+	assert.Equal("a.txt", results[0].SavedName)
+	assertFileEqual(t, filepath.Join(testPath, "a.txt"), filepath.Join(dstPath, "a.txt"))
+}
@@ -0,0 +1,116 @@
+//go:build linux || darwin
+
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+func openSerialPort(name string, config *serialConfig) (*os.File, error) {
+	// nonblocking to not wait for the carrier, and to be closed while reading
+	port, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := port.SyscallConn()
+	if err != nil {
+		_ = port.Close()
+		return nil, err
+	}
+	var setupErr error
+	if err := conn.Control(func(fd uintptr) { setupErr = setupSerialPort(int(fd), config) }); err != nil {
+		setupErr = err
+	}
+	if setupErr != nil {
+		_ = port.Close()
+		return nil, fmt.Errorf("setup %s failed: %v", name, setupErr)
+	}
+	return port, nil
+}
+
+func setupSerialPort(fd int, config *serialConfig) error {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return err
+	}
+	if err := makeSerialTermios(termios, config); err != nil {
+		return err
+	}
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, termios)
+}
+
+func makeSerialTermios(termios *unix.Termios, config *serialConfig) error {
+	// raw mode, as cfmakeraw does
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR |
+		unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY | unix.INPCK
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CRTSCTS
+	termios.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	switch config.parity {
+	case kParityOdd:
+		termios.Cflag |= unix.PARENB | unix.PARODD
+		termios.Iflag |= unix.INPCK
+	case kParityEven:
+		termios.Cflag |= unix.PARENB
+		termios.Iflag |= unix.INPCK
+	}
+	switch config.flow {
+	case kFlowRtsCts:
+		termios.Cflag |= unix.CRTSCTS
+	case kFlowXonXoff:
+		termios.Iflag |= unix.IXON | unix.IXOFF
+	}
+	return setTermiosSpeed(termios, config.baud)
+}
+
+func watchTerminalResize(setTerminalColumns func(int32), done <-chan struct{}) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+					setTerminalColumns(int32(width))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
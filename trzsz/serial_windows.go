@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// the flags of DCB
+const (
+	kDcbBinary      = 0x00000001
+	kDcbParity      = 0x00000002
+	kDcbOutxCtsFlow = 0x00000004
+	kDcbOutX        = 0x00000100
+	kDcbInX         = 0x00000200
+)
+
+const kMaxDword = 0xffffffff
+
+func openSerialPort(name string, config *serialConfig) (*os.File, error) {
+	path := name
+	if !strings.HasPrefix(path, `\\.\`) {
+		path = `\\.\` + path // required for COM10 and above
+	}
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(pathPtr, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupSerialPort(handle, config); err != nil {
+		_ = windows.CloseHandle(handle)
+		return nil, fmt.Errorf("setup %s failed: %v", name, err)
+	}
+	return os.NewFile(uintptr(handle), name), nil
+}
+
+func setupSerialPort(handle windows.Handle, config *serialConfig) error {
+	var dcb windows.DCB
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	if err := windows.GetCommState(handle, &dcb); err != nil {
+		return err
+	}
+	dcb.BaudRate = uint32(config.baud)
+	dcb.ByteSize = 8
+	dcb.StopBits = windows.ONESTOPBIT
+	dcb.Flags = kDcbBinary | windows.DTR_CONTROL_ENABLE | windows.RTS_CONTROL_ENABLE
+	switch config.parity {
+	case kParityOdd:
+		dcb.Parity = windows.ODDPARITY
+		dcb.Flags |= kDcbParity
+	case kParityEven:
+		dcb.Parity = windows.EVENPARITY
+		dcb.Flags |= kDcbParity
+	default:
+		dcb.Parity = windows.NOPARITY
+	}
+	switch config.flow {
+	case kFlowRtsCts:
+		dcb.Flags = dcb.Flags&^windows.RTS_CONTROL_ENABLE | kDcbOutxCtsFlow | windows.RTS_CONTROL_HANDSHAKE
+	case kFlowXonXoff:
+		dcb.Flags |= kDcbOutX | kDcbInX
+	}
+	if err := windows.SetCommState(handle, &dcb); err != nil {
+		return err
+	}
+	// the read returns as soon as any byte arrives
+	return windows.SetCommTimeouts(handle, &windows.CommTimeouts{
+		ReadIntervalTimeout:        kMaxDword,
+		ReadTotalTimeoutMultiplier: kMaxDword,
+		ReadTotalTimeoutConstant:   kMaxDword - 1,
+	})
+}
+
+func watchTerminalResize(setTerminalColumns func(int32), done <-chan struct{}) {
+	go func() {
+		lastWidth, _, _ := getConsoleSize()
+		for {
+			select {
+			case <-time.After(time.Second):
+			case <-done:
+				return
+			}
+			width, _, err := getConsoleSize()
+			if err != nil || width == lastWidth {
+				continue
+			}
+			lastWidth = width
+			setTerminalColumns(int32(width))
+		}
+	}()
+}
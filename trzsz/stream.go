@@ -0,0 +1,114 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+const kStdioFileName = "-"
+
+type streamFileReader struct {
+	reader io.Reader
+	step   atomic.Int64
+	eof    atomic.Bool
+}
+
+func (f *streamFileReader) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	f.step.Add(int64(n))
+	if err == io.EOF {
+		f.eof.Store(true)
+	}
+	return n, err
+}
+
+func (f *streamFileReader) Close() error {
+	return nil
+}
+
+func (f *streamFileReader) getFile() *os.File {
+	return nil
+}
+
+// getSize returns -1 until the end of the stream.
+func (f *streamFileReader) getSize() int64 {
+	if f.eof.Load() {
+		return f.step.Load()
+	}
+	return -1
+}
+
+type streamFileWriter struct {
+	writer io.Writer
+}
+
+func (f *streamFileWriter) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
+}
+
+func (f *streamFileWriter) Close() error {
+	return nil
+}
+
+func (f *streamFileWriter) getFile() *os.File {
+	return nil
+}
+
+func newStreamSourceFile(name string) *sourceFile {
+	return &sourceFile{RelPath: []string{name}, Size: -1, Stream: true}
+}
+
+// redirectStdin keeps the piped stdin for the stream, and reads the terminal input from the console instead.
+func redirectStdin() (*os.File, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, simpleTrzszError("Stdin is a terminal, please pipe the data to be sent")
+	}
+	console, err := openConsoleInput()
+	if err != nil {
+		return nil, simpleTrzszError("Open console input failed: %v", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = console
+	return stdin, nil
+}
+
+// redirectStdout keeps the redirected stdout for the stream, and writes the terminal output to the console instead.
+func redirectStdout() (*os.File, error) {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, simpleTrzszError("Stdout is a terminal, please redirect it to a file or pipe")
+	}
+	console, err := openConsoleOutput()
+	if err != nil {
+		return nil, simpleTrzszError("Open console output failed: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = console
+	return stdout, nil
+}
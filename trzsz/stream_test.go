@@ -0,0 +1,99 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamFromStdin(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	content := []byte(strings.Repeat("streaming data without a known size\n", 20000))
+	for _, data := range [][]byte{content, []byte("short"), {}} {
+		sender, receiver := newTransferPair(kProtocolVersion)
+		receiver.transferConfig.OnConflict = kConflictOverwrite
+		sender.streamInput = bytes.NewReader(data)
+		receiver.report = &transferReport{}
+		remoteNames, localNames := transferFiles(t, sender, receiver,
+			[]*sourceFile{newStreamSourceFile("out.log")}, testPath, nil, nil)
+		assert.Equal([]string{"out.log"}, remoteNames)
+		assert.Equal([]string{"out.log"}, localNames)
+		buf, err := os.ReadFile(filepath.Join(testPath, "out.log"))
+		require.Nil(err)
+		assert.Equal(data, buf)
+		require.Len(receiver.report.Files, 1)
+		assert.Equal(int64(len(data)), receiver.report.Files[0].Size)
+		assert.False(receiver.report.Files[0].Resumed)
+	}
+}
+
+func TestStreamToStdout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	content := []byte(strings.Repeat("received to stdout\n", 10000))
+	require.Nil(os.WriteFile(filepath.Join(testPath, "a.txt"), content, 0644))
+	require.Nil(os.WriteFile(filepath.Join(testPath, "b.txt"), content, 0644))
+
+	for _, protocol := range []int{kProtocolVersion2, kProtocolVersion} {
+		files, err := checkPathsReadable([]string{filepath.Join(testPath, "a.txt")}, false, false, nil)
+		require.Nil(err)
+		var stdout bytes.Buffer
+		sender, receiver := newTransferPair(protocol)
+		receiver.streamOutput = &stdout
+		_, localNames := transferFiles(t, sender, receiver, files, testPath, nil, nil)
+		assert.Equal([]string{"a.txt"}, localNames)
+		assert.Equal(content, stdout.Bytes())
+		_, err = os.Stat(filepath.Join(testPath, "a.0.txt"))
+		assert.True(os.IsNotExist(err))
+	}
+
+	files, err := checkPathsReadable([]string{filepath.Join(testPath, "a.txt"), filepath.Join(testPath, "b.txt")},
+		false, false, nil)
+	require.Nil(err)
+	sender, receiver := newTransferPair(kProtocolVersion)
+	receiver.streamOutput = &bytes.Buffer{}
+	go func() { _, _ = sender.sendFiles(files, nil) }()
+	_, err = receiver.recvFiles(testPath, nil)
+	assert.ErrorContains(err, "Only one file can be written to stdout")
+	sender.stopTransferringFiles(false)
+}
@@ -0,0 +1,321 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// syncEntry is an existing entry in the directory on the receiver side.
+type syncEntry struct {
+	Path    []string `json:"path"` // relative to the top directory
+	IsDir   bool     `json:"is_dir,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	ModTime int64    `json:"mtime,omitempty"`
+	Hash    string   `json:"hash,omitempty"`
+	Link    string   `json:"link,omitempty"`
+}
+
+// syncReply tells the receiver which entries of its manifest are unchanged, and which should be deleted.
+type syncReply struct {
+	Unchanged []int `json:"unchanged"`
+	Delete    []int `json:"delete"`
+}
+
+func isSyncTopDir(srcFile *sourceFile) bool {
+	return srcFile.IsDir && len(srcFile.RelPath) == 1
+}
+
+func (t *trzszTransfer) hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	hasher := t.newHasher()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (t *trzszTransfer) buildSyncManifest(dirPath string) ([]*syncEntry, error) {
+	var manifest []*syncEntry
+	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dirPath {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, kPartialFileSuffix) || strings.HasSuffix(name, kResumeFileSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		entry := &syncEntry{Path: strings.Split(rel, string(filepath.Separator))}
+		switch {
+		case d.IsDir():
+			entry.IsDir = true
+		case d.Type()&fs.ModeSymlink != 0:
+			if entry.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime().UnixNano()
+			if entry.Hash, err = t.hashFile(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		manifest = append(manifest, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, simpleTrzszError("Build the manifest of [%s] failed: %v", dirPath, err)
+	}
+	return manifest, nil
+}
+
+func (t *trzszTransfer) isSyncUnchanged(srcFile *sourceFile, entry *syncEntry) bool {
+	if srcFile.IsDir || entry.IsDir {
+		return false
+	}
+	if srcFile.isSymlink() || entry.Link != "" {
+		return srcFile.Link == entry.Link
+	}
+	if srcFile.Size != entry.Size {
+		return false
+	}
+	if srcFile.ModTime != nil && *srcFile.ModTime == entry.ModTime {
+		return true
+	}
+	hash, err := t.hashFile(srcFile.AbsPath)
+	return err == nil && hash == entry.Hash
+}
+
+// isSyncProtected returns whether the entry is excluded by the filters of the nearest directory on the sender side,
+// so it is not deleted even if it doesn't exist on the sender side.
+func isSyncProtected(dirs map[string]*sourceFile, top string, entry *syncEntry) bool {
+	relPath := append([]string{top}, entry.Path...)
+	for i := len(relPath) - 1; i > 0; i-- {
+		dir, ok := dirs[filepath.Join(relPath[:i]...)]
+		if !ok {
+			continue
+		}
+		for j := i + 1; j <= len(relPath); j++ {
+			if dir.filter.skip(relPath[:j], j < len(relPath) || entry.IsDir) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func (t *trzszTransfer) diffSyncManifest(srcFile *sourceFile, manifest []*syncEntry) *syncReply {
+	top := srcFile.RelPath[0]
+	files := make(map[string]*sourceFile)
+	dirs := map[string]*sourceFile{top: srcFile}
+	for _, subFile := range srcFile.SubFiles {
+		files[filepath.Join(subFile.RelPath[1:]...)] = subFile
+		if subFile.IsDir {
+			dirs[filepath.Join(subFile.RelPath...)] = subFile
+		}
+	}
+
+	reply := &syncReply{Unchanged: []int{}, Delete: []int{}}
+	unchanged := make(map[*sourceFile]bool)
+	for idx, entry := range manifest {
+		if subFile, ok := files[filepath.Join(entry.Path...)]; ok && t.isSyncUnchanged(subFile, entry) {
+			unchanged[subFile] = true
+			reply.Unchanged = append(reply.Unchanged, idx)
+		}
+	}
+
+	if t.transferConfig.Delete {
+		// the children are after their parent in the manifest, so check in reverse order
+		keep := make(map[string]bool)
+		for idx := len(manifest) - 1; idx >= 0; idx-- {
+			entry := manifest[idx]
+			key := filepath.Join(entry.Path...)
+			subFile, ok := files[key]
+			if (ok && subFile.IsDir == entry.IsDir) || keep[key] || isSyncProtected(dirs, top, entry) {
+				keep[filepath.Dir(key)] = true
+				continue
+			}
+			reply.Delete = append(reply.Delete, idx)
+		}
+	}
+
+	var subFiles []*sourceFile
+	for _, subFile := range srcFile.SubFiles {
+		if unchanged[subFile] {
+			t.unchangedFiles = append(t.unchangedFiles, filepath.Join(subFile.RelPath...))
+		} else {
+			subFiles = append(subFiles, subFile)
+		}
+	}
+	srcFile.SubFiles = subFiles
+	for _, idx := range reply.Delete {
+		t.deletedFiles = append(t.deletedFiles, filepath.Join(append([]string{top}, manifest[idx].Path...)...))
+	}
+	return reply
+}
+
+// sendSyncReply receives the manifest of the receiver, and leaves only the new or changed entries to be sent.
+func (t *trzszTransfer) sendSyncReply(srcFile *sourceFile, progress progressCallback) error {
+	buf, err := t.recvBinary("MANI", false, t.getNewTimeout())
+	if err != nil {
+		return err
+	}
+	var manifest []*syncEntry
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return err
+	}
+	totalSize := getTotalSize(srcFile.SubFiles)
+	reply := t.diffSyncManifest(srcFile, manifest)
+	jstr, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	if err := t.sendString("SYNC", string(jstr)); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress.onSkip(totalSize - getTotalSize(srcFile.SubFiles))
+	}
+	return nil
+}
+
+// recvSyncReply sends the manifest of the existing directory, and deletes the entries as the sender replies.
+func (t *trzszTransfer) recvSyncReply(dirPath, localName string, progress progressCallback) error {
+	manifest, err := t.buildSyncManifest(dirPath)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		manifest = []*syncEntry{}
+	}
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := t.sendBinary("MANI", buf); err != nil {
+		return err
+	}
+
+	line, err := t.recvString("SYNC", false, t.getNewTimeout())
+	if err != nil {
+		return err
+	}
+	var reply syncReply
+	if err := json.Unmarshal([]byte(line), &reply); err != nil {
+		return err
+	}
+	getEntry := func(idx int) (*syncEntry, error) {
+		if idx < 0 || idx >= len(manifest) {
+			return nil, simpleTrzszError("Invalid manifest index: %d", idx)
+		}
+		return manifest[idx], nil
+	}
+	var unchangedSize int64
+	for _, idx := range reply.Unchanged {
+		entry, err := getEntry(idx)
+		if err != nil {
+			return err
+		}
+		t.unchangedFiles = append(t.unchangedFiles, filepath.Join(append([]string{localName}, entry.Path...)...))
+		if !entry.IsDir && entry.Link == "" {
+			unchangedSize += entry.Size
+		}
+	}
+	if progress != nil {
+		progress.onSkip(unchangedSize)
+	}
+	if len(reply.Delete) > 0 && !t.transferConfig.Delete {
+		return simpleTrzszError("Unexpected deletion without --delete")
+	}
+	for _, idx := range reply.Delete {
+		entry, err := getEntry(idx)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(append([]string{dirPath}, entry.Path...)...)
+		if entry.IsDir {
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return simpleTrzszError("Delete [%s] failed: %v", path, err)
+		}
+		t.deletedFiles = append(t.deletedFiles, filepath.Join(append([]string{localName}, entry.Path...)...))
+	}
+	return nil
+}
+
+func formatSyncedFiles(unchangedNames, deletedNames []string) string {
+	var builder strings.Builder
+	if len(unchangedNames) > 0 {
+		builder.WriteString("\r\nUnchanged ")
+		builder.WriteString(strconv.Itoa(len(unchangedNames)))
+		if len(unchangedNames) > 1 {
+			builder.WriteString(" existing files")
+		} else {
+			builder.WriteString(" existing file")
+		}
+	}
+	if len(deletedNames) > 0 {
+		builder.WriteString("\r\nDeleted ")
+		builder.WriteString(strconv.Itoa(len(deletedNames)))
+		if len(deletedNames) > 1 {
+			builder.WriteString(" files/directories")
+		} else {
+			builder.WriteString(" file/directory")
+		}
+		for _, name := range deletedNames {
+			builder.WriteString("\r\n- ")
+			builder.WriteString(name)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,156 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncDirectory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	writeFile := func(base string, content string, paths ...string) {
+		t.Helper()
+		path := filepath.Join(append([]string{base, "cfg"}, paths...)...)
+		require.Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(os.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile(srcPath, "same content", "a.conf")
+	writeFile(srcPath, "same content and mtime", "b.conf")
+	writeFile(srcPath, "changed content", "sub", "c.conf")
+	writeFile(srcPath, "new file", "sub", "d.conf")
+	writeFile(srcPath, "*.log\n", kIgnoreFileName)
+
+	writeFile(dstPath, "same content", "a.conf")
+	writeFile(dstPath, "same content and mtime", "b.conf")
+	writeFile(dstPath, "old content", "sub", "c.conf")
+	writeFile(dstPath, "not in the source", "old.conf")
+	writeFile(dstPath, "not in the source", "old", "x.conf")
+	writeFile(dstPath, "excluded by the source", "keep.log")
+	writeFile(dstPath, "excluded by the source", "old", "keep", "y.log")
+	writeFile(dstPath, "*.log\n", kIgnoreFileName)
+	modTime := time.Now().Add(-time.Hour)
+	require.Nil(os.Chtimes(filepath.Join(dstPath, "cfg", "a.conf"), modTime, modTime))
+	require.Nil(os.Chtimes(filepath.Join(srcPath, "cfg", "b.conf"), modTime, modTime))
+	require.Nil(os.Chtimes(filepath.Join(dstPath, "cfg", "b.conf"), modTime, modTime))
+
+	syncFiles := func(delete bool) (*trzszTransfer, *trzszTransfer) {
+		t.Helper()
+		// the .trzszignore files are honored with any pattern
+		files, err := checkPathsReadable([]string{filepath.Join(srcPath, "cfg")}, true, false,
+			newPathFilter(nil, []string{"*.bak"}))
+		require.Nil(err)
+		sender, receiver := newTransferPair(kProtocolVersion)
+		for _, transfer := range []*trzszTransfer{sender, receiver} {
+			transfer.transferConfig.Directory = true
+			transfer.transferConfig.OnConflict = kConflictOverwrite
+			transfer.transferConfig.Sync = true
+			transfer.transferConfig.Delete = delete
+		}
+		_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+		assert.Equal([]string{"cfg"}, localNames)
+		return sender, receiver
+	}
+
+	sender, receiver := syncFiles(false)
+	unchanged := []string{filepath.Join("cfg", kIgnoreFileName), filepath.Join("cfg", "a.conf"),
+		filepath.Join("cfg", "b.conf")}
+	assert.ElementsMatch(unchanged, sender.unchangedFiles)
+	assert.ElementsMatch(unchanged, receiver.unchangedFiles)
+	assert.Empty(receiver.deletedFiles)
+	assertFileEqual(t, filepath.Join(srcPath, "cfg", "sub", "c.conf"), filepath.Join(dstPath, "cfg", "sub", "c.conf"))
+	assertFileEqual(t, filepath.Join(srcPath, "cfg", "sub", "d.conf"), filepath.Join(dstPath, "cfg", "sub", "d.conf"))
+	assert.FileExists(filepath.Join(dstPath, "cfg", "old.conf"))
+
+	sender, receiver = syncFiles(true)
+	assert.Len(receiver.unchangedFiles, 5)
+	deleted := []string{filepath.Join("cfg", "old.conf"), filepath.Join("cfg", "old", "x.conf")}
+	assert.ElementsMatch(deleted, sender.deletedFiles)
+	assert.ElementsMatch(deleted, receiver.deletedFiles)
+	assert.NoFileExists(filepath.Join(dstPath, "cfg", "old.conf"))
+	assert.NoFileExists(filepath.Join(dstPath, "cfg", "old", "x.conf"))
+	assert.FileExists(filepath.Join(dstPath, "cfg", "keep.log"))
+	assert.FileExists(filepath.Join(dstPath, "cfg", "old", "keep", "y.log"))
+
+	require.Nil(os.Remove(filepath.Join(dstPath, "cfg", "old", "keep", "y.log")))
+	_, receiver = syncFiles(true)
+	assert.ElementsMatch([]string{filepath.Join("cfg", "old", "keep"), filepath.Join("cfg", "old")},
+		receiver.deletedFiles)
+	assert.NoDirExists(filepath.Join(dstPath, "cfg", "old"))
+}
+
+func TestSyncUnchangedDirectory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(srcPath) }()
+	dstPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(dstPath) }()
+
+	for _, base := range []string{srcPath, dstPath} {
+		require.Nil(os.MkdirAll(filepath.Join(base, "cfg"), 0755))
+		require.Nil(os.WriteFile(filepath.Join(base, "cfg", "a.conf"), []byte("same content"), 0644))
+	}
+
+	files, err := checkPathsReadable([]string{filepath.Join(srcPath, "cfg")}, true, false, nil)
+	require.Nil(err)
+	sender, receiver := newTransferPair(kProtocolVersion)
+	for _, transfer := range []*trzszTransfer{sender, receiver} {
+		transfer.transferConfig.Directory = true
+		transfer.transferConfig.OnConflict = kConflictOverwrite
+		transfer.transferConfig.Sync = true
+	}
+	_, localNames := transferFiles(t, sender, receiver, files, dstPath, nil, nil)
+	assert.Equal([]string{"cfg"}, localNames)
+	unchanged := []string{filepath.Join("cfg", "a.conf")}
+	assert.Equal(unchanged, sender.unchangedFiles)
+	assert.Equal(unchanged, receiver.unchangedFiles)
+	assertFileEqual(t, filepath.Join(srcPath, "cfg", "a.conf"), filepath.Join(dstPath, "cfg", "a.conf"))
+}
+
+func TestFormatSyncedFiles(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", formatSyncedFiles(nil, nil))
+	assert.Equal("\r\nUnchanged 1 existing file", formatSyncedFiles([]string{"a"}, nil))
+	assert.Equal("\r\nUnchanged 2 existing files\r\nDeleted 2 files/directories\r\n- c\r\n- d",
+		formatSyncedFiles([]string{"a", "b"}, []string{"c", "d"}))
+}
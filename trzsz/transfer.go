@@ -26,8 +26,8 @@ package trzsz
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -46,41 +46,72 @@ import (
 )
 
 const (
-	kProtocolVersion2 = 2
-	kProtocolVersion3 = 3
-	kProtocolVersion4 = 4
-	kProtocolVersion  = kProtocolVersion4
+	kProtocolVersion2  = 2
+	kProtocolVersion3  = 3
+	kProtocolVersion4  = 4
+	kProtocolVersion5  = 5
+	kProtocolVersion6  = 6
+	kProtocolVersion7  = 7
+	kProtocolVersion8  = 8
+	kProtocolVersion9  = 9
+	kProtocolVersion10 = 10
+	kProtocolVersion11 = 11
+	kProtocolVersion12 = 12
+	kProtocolVersion13 = 13
+	kProtocolVersion14 = 14
+	kProtocolVersion15 = 15
+	kProtocolVersion16 = 16
+	kProtocolVersion   = kProtocolVersion16
 
 	kLastChunkTimeCount = 10
 )
 
 type transferAction struct {
-	Lang             string `json:"lang"`
-	Version          string `json:"version"`
-	Confirm          bool   `json:"confirm"`
-	Newline          string `json:"newline"`
-	Protocol         int    `json:"protocol"`
-	SupportBinary    bool   `json:"binary"`
-	SupportDirectory bool   `json:"support_dir"`
-	TunnelConnected  bool   `json:"tunnel"`
-	SupportFork      bool   `json:"fork"`
-	TmuxIntegration  bool   `json:"tmuxcc"`
+	Lang             string   `json:"lang"`
+	Version          string   `json:"version"`
+	Confirm          bool     `json:"confirm"`
+	Newline          string   `json:"newline"`
+	Protocol         int      `json:"protocol"`
+	SupportBinary    bool     `json:"binary"`
+	SupportDirectory bool     `json:"support_dir"`
+	SupportLinks     bool     `json:"support_links"`
+	Links            bool     `json:"links"`
+	Hashes           []string `json:"hashes"`
+	TunnelConnected  bool     `json:"tunnel"`
+	SupportFork      bool     `json:"fork"`
+	SupportParallel  bool     `json:"parallel"`
+	BwLimit          int64    `json:"bwlimit"`
+	TmuxIntegration  bool     `json:"tmuxcc"`
+	Retry            int      `json:"retry"`
 }
 
 type transferConfig struct {
-	Quiet           bool         `json:"quiet"`
-	Binary          bool         `json:"binary"`
-	Directory       bool         `json:"directory"`
-	Overwrite       bool         `json:"overwrite"`
-	Timeout         int          `json:"timeout"`
-	Newline         string       `json:"newline"`
-	Protocol        int          `json:"protocol"`
-	MaxBufSize      int64        `json:"bufsize"`
-	EscapeTable     *escapeTable `json:"escape_chars"`
-	TmuxPaneColumns int32        `json:"tmux_pane_width"`
-	TmuxOutputJunk  bool         `json:"tmux_output_junk"`
-	CompressType    compressType `json:"compress"`
-	Fork            bool         `json:"fork"`
+	Quiet           bool           `json:"quiet"`
+	Binary          bool           `json:"binary"`
+	Directory       bool           `json:"directory"`
+	Links           bool           `json:"links"`
+	Hash            string         `json:"hash"`
+	OnConflict      conflictPolicy `json:"on_conflict"`
+	Parallel        int            `json:"parallel"`
+	Include         []string       `json:"include"`
+	Exclude         []string       `json:"exclude"`
+	BwLimit         int64          `json:"bwlimit"`
+	Overwrite       bool           `json:"overwrite"`
+	Sync            bool           `json:"sync"`
+	Delete          bool           `json:"delete"`
+	Timeout         int            `json:"timeout"`
+	Retry           int            `json:"retry"`
+	Pacing          pacingMode     `json:"pacing"`
+	Newline         string         `json:"newline"`
+	Protocol        int            `json:"protocol"`
+	MaxBufSize      int64          `json:"bufsize"`
+	EscapeTable     *escapeTable   `json:"escape_chars"`
+	TmuxPaneColumns int32          `json:"tmux_pane_width"`
+	TmuxOutputJunk  bool           `json:"tmux_output_junk"`
+	CompressType    compressType   `json:"compress"`
+	CompressCodec   compressCodec  `json:"compress_codec"`
+	CompressLevel   int            `json:"compress_level"`
+	Fork            bool           `json:"fork"`
 }
 
 type trzszTransfer struct {
@@ -104,12 +135,36 @@ type trzszTransfer struct {
 	bufInitPhase     atomic.Bool
 	bufferSize       atomic.Int64
 	savedSteps       atomic.Int64
+	rateLimiter      *rateLimiter
+	congestion       *congestionControl
+	chunkMutex       sync.Mutex
 	transferConfig   transferConfig
 	trzszFilter      *TrzszFilter
 	createdFiles     []string
+	partialFiles     []partialFile
+	skippedFiles     []string
+	doneFiles        int
+	doneNames        []string
+	unchangedFiles   []string
+	deletedFiles     []string
+	resumeTracker    *resumeTracker
+	resumeHashState  []byte
+	dirModTimes      []fileModTime
 	tunnelConnected  bool
 	tunnelConn       atomic.Pointer[net.Conn]
+	tunnelListener   net.Listener
 	tunnelInitWG     sync.WaitGroup
+	tunnelConnector  func(int) net.Conn
+	tunnelUniqueID   string
+	tunnelPort       int
+	workers          []*trzszTransfer
+	workerMutex      sync.Mutex
+	acceptedWorkers  map[int]*trzszTransfer
+	acceptStopped    bool
+	workerNotify     chan struct{}
+	report           *transferReport
+	streamInput      io.Reader
+	streamOutput     io.Writer
 	bgChan           chan struct{}
 	termReseted      atomic.Bool
 	tmuxPaneID       []byte
@@ -151,7 +206,9 @@ func getHelloConstant(uniqueID string, port int) (string, string) {
 	return clientHello, serverHello
 }
 
-func (t *trzszTransfer) acceptOnTunnel(listener net.Listener, uniqueID string, port int) {
+func (t *trzszTransfer) acceptOnTunnel(listener net.Listener, uniqueID string, port int, parallel int) {
+	t.tunnelListener = listener
+	maxWorkers := min(parallel, kMaxParallel) - 1
 	go func() {
 		defer func() { _ = listener.Close() }()
 		clientHello, serverHello := getHelloConstant(uniqueID, port)
@@ -160,14 +217,24 @@ func (t *trzszTransfer) acceptOnTunnel(listener net.Listener, uniqueID string, p
 			if err != nil {
 				return
 			}
-			if t.tunnelConn.Load() != nil {
-				_ = conn.Close()
-				return
-			}
 			go func(conn net.Conn) {
 				buf := make([]byte, 100)
 				n, err := conn.Read(buf)
-				if err != nil || string(buf[:n]) != clientHello {
+				if err != nil {
+					_ = conn.Close()
+					return
+				}
+				// the parallel workers connect after the main tunnel connection
+				if idx := parseWorkerHello(string(buf[:n]), clientHello); idx > 0 && idx <= maxWorkers && t.tunnelConn.Load() != nil {
+					_, workerServerHello := getWorkerHelloConstant(clientHello, serverHello, idx)
+					if _, err := conn.Write([]byte(workerServerHello)); err != nil {
+						_ = conn.Close()
+						return
+					}
+					t.addAcceptedWorker(idx, conn)
+					return
+				}
+				if string(buf[:n]) != clientHello || t.tunnelConn.Load() != nil {
 					_ = conn.Close()
 					return
 				}
@@ -175,8 +242,13 @@ func (t *trzszTransfer) acceptOnTunnel(listener net.Listener, uniqueID string, p
 					_ = conn.Close()
 					return
 				}
-				if t.tunnelConn.CompareAndSwap(nil, &conn) {
-					wrapTransferInput(t, conn, true)
+				if !t.tunnelConn.CompareAndSwap(nil, &conn) {
+					_ = conn.Close()
+					return
+				}
+				wrapTransferInput(t, conn, true)
+				// keep listening only for the parallel workers, until acceptWorkers is done
+				if maxWorkers <= 0 {
 					_ = listener.Close()
 				}
 			}(conn)
@@ -185,6 +257,9 @@ func (t *trzszTransfer) acceptOnTunnel(listener net.Listener, uniqueID string, p
 }
 
 func (t *trzszTransfer) connectToTunnel(connector func(int) net.Conn, uniqueID string, port int) {
+	t.tunnelConnector = connector
+	t.tunnelUniqueID = uniqueID
+	t.tunnelPort = port
 	t.tunnelInitWG.Go(func() {
 		timeout := false
 		connChan := make(chan net.Conn, 1)
@@ -234,6 +309,9 @@ func (t *trzszTransfer) cleanup() {
 	if conn := t.tunnelConn.Load(); conn != nil {
 		_ = (*conn).Close()
 	}
+	for _, worker := range t.getWorkers() {
+		worker.cleanup()
+	}
 }
 
 func (t *trzszTransfer) background() <-chan struct{} {
@@ -280,6 +358,9 @@ func (t *trzszTransfer) stopTransferringFiles(stopAndDelete bool) {
 	}
 	t.stopAndDelete.Store(stopAndDelete)
 	t.buffer.stopBuffer()
+	for _, worker := range t.getWorkers() {
+		worker.stopTransferringFiles(stopAndDelete)
+	}
 
 	if !t.tunnelConnected {
 		maxChunkTime := time.Duration(0)
@@ -521,6 +602,9 @@ func (t *trzszTransfer) sendData(data []byte) error {
 	if err := t.checkStop(); err != nil {
 		return err
 	}
+	if err := t.throttle(len(data)); err != nil {
+		return err
+	}
 	if !t.transferConfig.Binary {
 		return t.sendBinary("DATA", data)
 	}
@@ -578,12 +662,26 @@ func (t *trzszTransfer) sendAction(confirm bool, serverVersion *trzszVersion, re
 		Protocol:         protocol,
 		SupportBinary:    true,
 		SupportDirectory: true,
+		SupportLinks:     true,
+		Hashes:           kHashAlgorithms,
+	}
+	if t.trzszFilter != nil {
+		if links := t.trzszFilter.preserveSymlinks.Load(); links != nil {
+			action.Links = *links
+		}
+		if limit := t.trzszFilter.bandwidthLimit.Load(); limit != nil {
+			action.BwLimit = *limit
+		}
+		if count := t.trzszFilter.retryCount.Load(); count != nil {
+			action.Retry = int(*count)
+		}
 	}
 
 	t.tunnelInitWG.Wait()
 	if t.tunnelConnected {
 		action.TunnelConnected = true
 		action.SupportFork = true
+		action.SupportParallel = t.tunnelConnector != nil
 	}
 
 	if len(t.tmuxPaneID) > 0 {
@@ -657,12 +755,30 @@ func (t *trzszTransfer) sendConfig(args *baseArgs, action *transferAction, escap
 	}
 	if args.Directory {
 		cfgMap["directory"] = true
+		if args.Links || action.Links {
+			cfgMap["links"] = true
+		}
+		if len(args.Include) > 0 {
+			cfgMap["include"] = args.Include
+		}
+		if len(args.Exclude) > 0 {
+			cfgMap["exclude"] = args.Exclude
+		}
+		if args.Sync {
+			cfgMap["sync"] = true
+			if args.Delete {
+				cfgMap["delete"] = true
+			}
+		}
 	}
 	cfgMap["bufsize"] = args.Bufsize.Size
 	cfgMap["timeout"] = args.Timeout
 	if args.Overwrite {
 		cfgMap["overwrite"] = true
 	}
+	if args.OnConflict != "" {
+		cfgMap["on_conflict"] = args.OnConflict
+	}
 	if tmuxMode == tmuxNormalMode {
 		cfgMap["tmux_output_junk"] = true
 	}
@@ -676,8 +792,31 @@ func (t *trzszTransfer) sendConfig(args *baseArgs, action *transferAction, escap
 	if action.Protocol > 0 {
 		cfgMap["protocol"] = min(action.Protocol, kProtocolVersion)
 	}
-	if args.Compress != kCompressAuto {
-		cfgMap["compress"] = args.Compress
+	if args.Compress.Type != kCompressAuto {
+		cfgMap["compress"] = args.Compress.Type
+	}
+	// the old clients use the default zstd
+	if args.Compress.Codec != "" && action.Protocol >= kProtocolVersion12 {
+		cfgMap["compress_codec"] = args.Compress.Codec
+		if args.Compress.Level > 0 {
+			cfgMap["compress_level"] = args.Compress.Level
+		}
+	}
+	if hash := negotiateHash(action.Hashes); hash != kHashMD5 {
+		cfgMap["hash"] = hash
+	}
+	if action.TunnelConnected && action.SupportParallel && args.Parallel > 1 {
+		cfgMap["parallel"] = min(args.Parallel, kMaxParallel)
+	}
+	if limit := getBandwidthLimit(args.BwLimit.Rate, action.BwLimit); limit > 0 {
+		cfgMap["bwlimit"] = limit
+	}
+	if args.Pacing == kPacingFixed {
+		cfgMap["pacing"] = args.Pacing
+	}
+	// the old clients don't retry, just transfer once
+	if retry := max(args.Retry, action.Retry); retry > 0 && action.Protocol >= kProtocolVersion14 {
+		cfgMap["retry"] = retry
 	}
 	cfgStr, err := json.Marshal(cfgMap)
 	if err != nil {
@@ -686,6 +825,7 @@ func (t *trzszTransfer) sendConfig(args *baseArgs, action *transferAction, escap
 	if err := json.Unmarshal([]byte(cfgStr), &t.transferConfig); err != nil {
 		return err
 	}
+	t.rateLimiter = newRateLimiter(t.transferConfig.BwLimit)
 	return t.sendString("CFG", string(cfgStr))
 }
 
@@ -697,6 +837,7 @@ func (t *trzszTransfer) recvConfig() (*transferConfig, error) {
 	if err := json.Unmarshal([]byte(cfgStr), &t.transferConfig); err != nil {
 		return nil, err
 	}
+	t.rateLimiter = newRateLimiter(t.transferConfig.BwLimit)
 	if t.transferConfig.Fork {
 		t.bgChan <- struct{}{}
 	}
@@ -714,7 +855,13 @@ func (t *trzszTransfer) recvExit() (string, error) {
 
 func (t *trzszTransfer) serverExit(msg string) {
 	t.cleanInput(500 * time.Millisecond)
-	t.resetTerm(msg, false)
+	if t.report == nil {
+		t.resetTerm(msg, false)
+		return
+	}
+	// the JSON summary is written raw after resetting the terminal, so that it can be parsed by the scripts
+	t.resetTerm("", true)
+	t.writeReport(os.Stdout, msg)
 }
 
 func (t *trzszTransfer) resetTerm(msg string, ignorable bool) {
@@ -734,8 +881,10 @@ func (t *trzszTransfer) resetTerm(msg string, ignorable bool) {
 	} else {
 		_, _ = os.Stdout.WriteString("\x1b[u\x1b[0J")
 	}
-	_, _ = os.Stdout.WriteString(msg)
-	_, _ = os.Stdout.WriteString("\r\n")
+	if msg != "" {
+		_, _ = os.Stdout.WriteString(msg)
+		_, _ = os.Stdout.WriteString("\r\n")
+	}
 	showCursor(os.Stdout)
 	if t.transferConfig.TmuxOutputJunk {
 		tmuxRefreshClient()
@@ -745,7 +894,7 @@ func (t *trzszTransfer) resetTerm(msg string, ignorable bool) {
 func (t *trzszTransfer) deleteCreatedFiles() []string {
 	var deletedFiles []string
 	for _, path := range t.createdFiles {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
 			continue
 		}
 		if err := os.RemoveAll(path); err == nil {
@@ -765,6 +914,8 @@ func (t *trzszTransfer) clientError(err error) {
 		if e.isRemoteExit() || e.isRemoteFail() {
 			return
 		}
+	} else if _, ok := err.(*unsafePathError); ok {
+		trace = false
 	}
 
 	if t.stopAndDelete.Load() {
@@ -784,6 +935,7 @@ func (t *trzszTransfer) clientError(err error) {
 
 func (t *trzszTransfer) serverError(err error) {
 	t.cleanInput(t.cleanTimeout)
+	t.reportError(err)
 
 	trace := true
 	if e, ok := err.(*trzszError); ok {
@@ -823,6 +975,34 @@ func (t *trzszTransfer) sendFileNum(num int64, progress progressCallback) error
 	return nil
 }
 
+// getTotalSize sums the sizes of the files and the archived files, or returns -1 if there is a stream.
+func getTotalSize(sourceFiles []*sourceFile) int64 {
+	var total int64
+	for _, srcFile := range sourceFiles {
+		if srcFile.Stream {
+			return -1
+		}
+		if !srcFile.IsDir && !srcFile.isSymlink() {
+			total += srcFile.Size
+		}
+		total += max(getTotalSize(srcFile.SubFiles), 0)
+	}
+	return total
+}
+
+func (t *trzszTransfer) sendTotalSize(total int64, progress progressCallback) error {
+	if err := t.sendInteger("TOTAL", total); err != nil {
+		return err
+	}
+	if err := t.checkInteger(total, t.getNewTimeout()); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress.onTotal(total)
+	}
+	return nil
+}
+
 func (t *trzszTransfer) sendFileName(srcFile *sourceFile, progress progressCallback) (fileReader, string, error) {
 	var fileName string
 	if t.transferConfig.Directory {
@@ -846,8 +1026,9 @@ func (t *trzszTransfer) sendFileName(srcFile *sourceFile, progress progressCallb
 	if progress != nil {
 		progress.onName(srcFile.getFileName())
 	}
+	t.reportFileName(srcFile, remoteName, false)
 
-	if srcFile.IsDir {
+	if srcFile.IsDir || srcFile.isSymlink() {
 		return nil, remoteName, nil
 	}
 
@@ -879,7 +1060,7 @@ func (t *trzszTransfer) sendFileData(file fileReader, progress progressCallback)
 	}
 	bufSize := int64(1024)
 	buffer := make([]byte, bufSize)
-	hasher := md5.New()
+	hasher := t.newHasher()
 	size := file.getSize()
 	for step < size {
 		beginTime := time.Now()
@@ -937,12 +1118,25 @@ func (t *trzszTransfer) sendFileMD5(digest []byte, progress progressCallback) er
 }
 
 func (t *trzszTransfer) sendFiles(sourceFiles []*sourceFile, progress progressCallback) ([]string, error) {
-	sourceFiles = t.archiveSourceFiles(sourceFiles)
+	sourceFiles = t.archiveSourceFiles(sourceFiles)[t.doneFiles:] // the sent files are skipped while retrying
+	if len(t.workers) > 0 {
+		return t.sendFilesInParallel(sourceFiles, progress)
+	}
+	return t.sendFileList(sourceFiles, progress)
+}
+
+func (t *trzszTransfer) sendFileList(sourceFiles []*sourceFile, progress progressCallback) ([]string, error) {
 	if err := t.sendFileNum(int64(len(sourceFiles)), progress); err != nil {
 		return nil, err
 	}
+	if t.transferConfig.Protocol >= kProtocolVersion16 {
+		if err := t.sendTotalSize(getTotalSize(sourceFiles), progress); err != nil {
+			return nil, err
+		}
+	}
 
 	var remoteNames []string
+	defer func() { t.doneNames = appendUniqueNames(t.doneNames, remoteNames) }()
 	for _, srcFile := range sourceFiles {
 		var err error
 		var file fileReader
@@ -956,11 +1150,12 @@ func (t *trzszTransfer) sendFiles(sourceFiles []*sourceFile, progress progressCa
 			return nil, err
 		}
 
-		if !slices.Contains(remoteNames, remoteName) {
+		if remoteName != "" && !slices.Contains(remoteNames, remoteName) {
 			remoteNames = append(remoteNames, remoteName)
 		}
 
 		if file == nil {
+			t.doneFiles++
 			continue
 		}
 
@@ -983,6 +1178,12 @@ func (t *trzszTransfer) sendFiles(sourceFiles []*sourceFile, progress progressCa
 		if err := t.sendFileMD5(digest, progress); err != nil {
 			return nil, err
 		}
+		if delta, ok := file.(*deltaFileReader); ok {
+			t.reportFileData(delta.size, delta.digest)
+		} else {
+			t.reportFileData(file.getSize(), digest)
+		}
+		t.doneFiles++
 	}
 
 	return remoteNames, nil
@@ -1002,11 +1203,98 @@ func (t *trzszTransfer) recvFileNum(progress progressCallback) (int64, error) {
 	return num, nil
 }
 
+func (t *trzszTransfer) recvTotalSize(progress progressCallback) error {
+	total, err := t.recvInteger("TOTAL", false, t.getNewTimeout())
+	if err != nil {
+		return err
+	}
+	if err := t.sendInteger("SUCC", total); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress.onTotal(total)
+	}
+	return nil
+}
+
 func (t *trzszTransfer) addCreatedFiles(path string) {
 	t.createdFiles = append(t.createdFiles, path)
 }
 
-func (t *trzszTransfer) doCreateFile(path string, truncate bool, perm *uint32) (fileWriter, error) {
+type partialFile struct {
+	partPath string
+	fullPath string
+	modTime  *int64
+}
+
+type fileModTime struct {
+	path    string
+	modTime int64
+}
+
+func (t *trzszTransfer) setFileModTime(path string, modTime *int64) error {
+	if modTime == nil || t.transferConfig.Protocol < kProtocolVersion5 {
+		return nil
+	}
+	if err := os.Chtimes(path, time.Time{}, time.Unix(0, *modTime)); err != nil {
+		return simpleTrzszError("Set modification time of [%s] failed: %v", path, err)
+	}
+	return nil
+}
+
+// getTargetPath returns the path which the partial file of the writer is renamed to at last.
+func (t *trzszTransfer) getTargetPath(writer fileWriter) string {
+	if writer == nil || writer.getFile() == nil {
+		return ""
+	}
+	partPath := writer.getFile().Name()
+	idx := slices.IndexFunc(t.partialFiles, func(f partialFile) bool { return f.partPath == partPath })
+	if idx < 0 {
+		return ""
+	}
+	return t.partialFiles[idx].fullPath
+}
+
+func (t *trzszTransfer) commitPartialFiles() error {
+	for _, f := range t.partialFiles {
+		if err := os.Rename(f.partPath, f.fullPath); err != nil {
+			return simpleTrzszError("Rename [%s] to [%s] failed: %v", f.partPath, f.fullPath, err)
+		}
+		if idx := slices.Index(t.createdFiles, f.partPath); idx >= 0 {
+			t.createdFiles[idx] = f.fullPath
+		}
+		_ = os.Remove(getResumeFilePath(f.partPath))
+		if err := t.setFileModTime(f.fullPath, f.modTime); err != nil {
+			return err
+		}
+	}
+	t.partialFiles = nil
+	return nil
+}
+
+func (t *trzszTransfer) addDirModTime(path string, modTime *int64) {
+	if modTime == nil || t.transferConfig.Protocol < kProtocolVersion5 {
+		return
+	}
+	t.dirModTimes = append(t.dirModTimes, fileModTime{path, *modTime})
+}
+
+func (t *trzszTransfer) commitDirModTimes() error {
+	// children are created after their parents, so apply in reverse order
+	for i := len(t.dirModTimes) - 1; i >= 0; i-- {
+		if err := t.setFileModTime(t.dirModTimes[i].path, &t.dirModTimes[i].modTime); err != nil {
+			return err
+		}
+	}
+	t.dirModTimes = nil
+	return nil
+}
+
+func (t *trzszTransfer) doCreateFile(path string, truncate bool, perm *uint32, modTime *int64) (fileWriter, error) {
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		return nil, simpleTrzszError("Is a directory: %s", path)
+	}
+	partPath := getPartialFilePath(path)
 	flag := os.O_RDWR | os.O_CREATE
 	if truncate {
 		flag |= os.O_TRUNC
@@ -1015,7 +1303,7 @@ func (t *trzszTransfer) doCreateFile(path string, truncate bool, perm *uint32) (
 	if perm != nil {
 		fileMode = fs.FileMode(*perm) | 0600
 	}
-	file, err := os.OpenFile(path, flag, fileMode)
+	file, err := os.OpenFile(partPath, flag, fileMode)
 	if err != nil {
 		if e, ok := err.(*fs.PathError); ok {
 			if errno, ok := e.Unwrap().(syscall.Errno); ok {
@@ -1028,7 +1316,8 @@ func (t *trzszTransfer) doCreateFile(path string, truncate bool, perm *uint32) (
 		}
 		return nil, simpleTrzszError("Create file [%s] failed: %v", path, err)
 	}
-	t.addCreatedFiles(path)
+	t.addCreatedFiles(partPath)
+	t.partialFiles = append(t.partialFiles, partialFile{partPath, path, modTime})
 	return &simpleFileWriter{file}, nil
 }
 
@@ -1054,9 +1343,62 @@ func (t *trzszTransfer) doCreateDirectory(path string, perm *uint32) error {
 	return nil
 }
 
+func (t *trzszTransfer) doCreateSymlink(destPath, path, target string) error {
+	if !t.transferConfig.Links {
+		return simpleTrzszError("Unexpected symlink: %s -> %s", path, target)
+	}
+	if err := checkSymlinkTarget(destPath, path, target); err != nil {
+		return err
+	}
+	if stat, err := os.Lstat(path); err == nil {
+		if stat.IsDir() {
+			return simpleTrzszError("Is a directory: %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return simpleTrzszError("Create symlink [%s] failed: %v", path, err)
+	}
+	t.addCreatedFiles(path)
+	return nil
+}
+
+var errFileSkipped = errors.New("Skipped")
+
+func (c *transferConfig) getConflictPolicy() conflictPolicy {
+	return getConflictPolicy(c.Overwrite, c.OnConflict)
+}
+
+func (t *trzszTransfer) checkConflict(path string, srcFile *sourceFile) error {
+	policy := t.transferConfig.getConflictPolicy()
+	if policy == kConflictOverwrite || policy == kConflictRename {
+		return nil
+	}
+	stat, err := os.Lstat(path)
+	if err != nil || stat.IsDir() {
+		return nil
+	}
+	switch policy {
+	case kConflictNewer:
+		if srcFile.ModTime != nil && time.Unix(0, *srcFile.ModTime).After(stat.ModTime()) {
+			return nil
+		}
+	case kConflictLarger:
+		if srcFile.Size > stat.Size() {
+			return nil
+		}
+	}
+	return errFileSkipped
+}
+
 func (t *trzszTransfer) createFile(path, fileName string, truncate bool, perm *uint32) (fileWriter, string, error) {
+	if err := checkPathName(fileName, fileName); err != nil {
+		return nil, "", err
+	}
 	var localName string
-	if t.transferConfig.Overwrite {
+	if t.transferConfig.getConflictPolicy() != kConflictRename {
 		localName = fileName
 	} else {
 		var err error
@@ -1065,7 +1407,11 @@ func (t *trzszTransfer) createFile(path, fileName string, truncate bool, perm *u
 			return nil, "", err
 		}
 	}
-	file, err := t.doCreateFile(filepath.Join(path, localName), truncate, perm)
+	fullPath := filepath.Join(path, localName)
+	if err := checkPathInside(path, getPartialFilePath(fullPath)); err != nil {
+		return nil, "", err
+	}
+	file, err := t.doCreateFile(fullPath, truncate, perm, nil)
 	if err != nil {
 		return nil, "", err
 	}
@@ -1073,8 +1419,11 @@ func (t *trzszTransfer) createFile(path, fileName string, truncate bool, perm *u
 }
 
 func (t *trzszTransfer) createDirOrFile(path string, srcFile *sourceFile, truncate bool) (fileWriter, string, error) {
+	if err := checkRelPath(srcFile.RelPath); err != nil {
+		return nil, "", err
+	}
 	var localName string
-	if t.transferConfig.Overwrite {
+	if t.transferConfig.getConflictPolicy() != kConflictRename {
 		localName = srcFile.RelPath[0]
 	} else {
 		if v, ok := t.fileNameMap[srcFile.PathID]; ok {
@@ -1089,15 +1438,22 @@ func (t *trzszTransfer) createDirOrFile(path string, srcFile *sourceFile, trunca
 		}
 	}
 
-	var fullPath string
+	fullPath := filepath.Join(append([]string{path, localName}, srcFile.RelPath[1:]...)...)
+	// check the path to be written, a symlink itself is replaced but its parent must be inside
+	checkPath := fullPath
+	if srcFile.isSymlink() {
+		checkPath = filepath.Dir(fullPath)
+	} else if !srcFile.IsDir {
+		checkPath = getPartialFilePath(fullPath)
+	}
+	if err := checkPathInside(path, checkPath); err != nil {
+		return nil, "", err
+	}
+
 	if len(srcFile.RelPath) > 1 {
-		p := filepath.Join(append([]string{path, localName}, srcFile.RelPath[1:len(srcFile.RelPath)-1]...)...)
-		if err := t.doCreateDirectory(p, srcFile.Perm); err != nil {
+		if err := t.doCreateDirectory(filepath.Dir(fullPath), srcFile.Perm); err != nil {
 			return nil, "", err
 		}
-		fullPath = filepath.Join(p, srcFile.getFileName())
-	} else {
-		fullPath = filepath.Join(path, localName)
 	}
 
 	if srcFile.Archive {
@@ -1112,10 +1468,22 @@ func (t *trzszTransfer) createDirOrFile(path string, srcFile *sourceFile, trunca
 		if err := t.doCreateDirectory(fullPath, srcFile.Perm); err != nil {
 			return nil, "", err
 		}
+		t.addDirModTime(fullPath, srcFile.ModTime)
 		return nil, localName, nil
 	}
 
-	file, err := t.doCreateFile(fullPath, truncate, srcFile.Perm)
+	if err := t.checkConflict(fullPath, srcFile); err != nil {
+		return nil, localName, err
+	}
+
+	if srcFile.isSymlink() {
+		if err := t.doCreateSymlink(path, fullPath, srcFile.Link); err != nil {
+			return nil, "", err
+		}
+		return nil, localName, nil
+	}
+
+	file, err := t.doCreateFile(fullPath, truncate, srcFile.Perm, srcFile.ModTime)
 	if err != nil {
 		return nil, "", err
 	}
@@ -1130,8 +1498,11 @@ func (t *trzszTransfer) recvFileName(path string, progress progressCallback) (fi
 
 	var file fileWriter
 	var localName string
-	if t.transferConfig.Directory {
-		var srcFile *sourceFile
+	var srcFile *sourceFile
+	if t.streamOutput != nil {
+		srcFile = &sourceFile{RelPath: []string{fileName}}
+		file, localName = &streamFileWriter{t.streamOutput}, fileName
+	} else if t.transferConfig.Directory {
 		srcFile, err = unmarshalSourceFile(fileName)
 		if err != nil {
 			return nil, "", err
@@ -1139,6 +1510,7 @@ func (t *trzszTransfer) recvFileName(path string, progress progressCallback) (fi
 		fileName = srcFile.getFileName()
 		file, localName, err = t.createDirOrFile(path, srcFile, true)
 	} else {
+		srcFile = &sourceFile{RelPath: []string{fileName}}
 		file, localName, err = t.createFile(path, fileName, true, nil)
 	}
 	if err != nil {
@@ -1151,6 +1523,7 @@ func (t *trzszTransfer) recvFileName(path string, progress progressCallback) (fi
 	if progress != nil {
 		progress.onName(fileName)
 	}
+	t.reportFileName(srcFile, localName, false)
 
 	return file, localName, nil
 }
@@ -1175,7 +1548,7 @@ func (t *trzszTransfer) recvFileData(file fileWriter, size int64, progress progr
 	if progress != nil {
 		progress.onStep(step)
 	}
-	hasher := md5.New()
+	hasher := t.newHasher()
 	for step < size {
 		beginTime := time.Now()
 		data, err := t.recvData()
@@ -1207,7 +1580,7 @@ func (t *trzszTransfer) recvFileMD5(digest []byte, progress progressCallback) er
 		return err
 	}
 	if !bytes.Equal(digest, expectDigest) {
-		return simpleTrzszError("Check MD5 failed")
+		return simpleTrzszError("Check %s failed", t.hashName())
 	}
 	if err := t.sendBinary("SUCC", digest); err != nil {
 		return err
@@ -1219,12 +1592,40 @@ func (t *trzszTransfer) recvFileMD5(digest []byte, progress progressCallback) er
 }
 
 func (t *trzszTransfer) recvFiles(path string, progress progressCallback) ([]string, error) {
+	var localNames []string
+	var err error
+	if len(t.workers) > 0 {
+		localNames, err = t.recvFilesInParallel(path, progress)
+	} else {
+		localNames, err = t.recvFileList(path, progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.commitDirModTimes(); err != nil {
+		return nil, err
+	}
+
+	return localNames, nil
+}
+
+func (t *trzszTransfer) recvFileList(path string, progress progressCallback) ([]string, error) {
 	num, err := t.recvFileNum(progress)
 	if err != nil {
 		return nil, err
 	}
+	if t.streamOutput != nil && num != 1 {
+		return nil, simpleTrzszError("Only one file can be written to stdout, but got %d", num)
+	}
+	if t.transferConfig.Protocol >= kProtocolVersion16 {
+		if err := t.recvTotalSize(progress); err != nil {
+			return nil, err
+		}
+	}
 
 	var localNames []string
+	defer func() { t.doneNames = appendUniqueNames(t.doneNames, localNames) }()
 	for range num {
 		var err error
 		var file fileWriter
@@ -1238,11 +1639,12 @@ func (t *trzszTransfer) recvFiles(path string, progress progressCallback) ([]str
 			return nil, err
 		}
 
-		if !slices.Contains(localNames, localName) {
+		if localName != "" && !slices.Contains(localNames, localName) {
 			localNames = append(localNames, localName)
 		}
 
 		if file == nil {
+			t.doneFiles++
 			continue
 		}
 
@@ -1263,9 +1665,28 @@ func (t *trzszTransfer) recvFiles(path string, progress progressCallback) ([]str
 			return nil, err
 		}
 
+		// the delta data should be applied and verified before the ack
+		delta, isDelta := file.(*deltaFileWriter)
+		if isDelta {
+			if err := delta.Close(); err != nil {
+				return nil, err
+			}
+		}
+
 		if err := t.recvFileMD5(digest, progress); err != nil {
 			return nil, err
 		}
+		if isDelta {
+			size, digest = delta.size, delta.digest
+		} else if size < 0 { // the size of a stream is known only at the end
+			size = t.savedSteps.Load()
+		}
+		t.reportFileData(size, digest)
+
+		if err := t.commitPartialFiles(); err != nil {
+			return nil, err
+		}
+		t.doneFiles++
 	}
 
 	return localNames, nil
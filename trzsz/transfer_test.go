@@ -25,12 +25,57 @@ SOFTWARE.
 package trzsz
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/text/encoding/charmap"
 )
 
+type peerWriter struct {
+	peer *trzszTransfer
+}
+
+func (w *peerWriter) Write(p []byte) (int, error) {
+	w.peer.addReceivedData(bytes.Clone(p), false)
+	return len(p), nil
+}
+
+func newTransferPair(protocol int) (*trzszTransfer, *trzszTransfer) {
+	sender := newTransfer(nil, nil)
+	receiver := newTransfer(nil, nil)
+	sender.writer = &peerWriter{receiver}
+	receiver.writer = &peerWriter{sender}
+	sender.transferConfig.Protocol = protocol
+	receiver.transferConfig.Protocol = protocol
+	return sender, receiver
+}
+
+func transferFiles(t *testing.T, sender, receiver *trzszTransfer, files []*sourceFile, path string,
+	sendProgress, recvProgress progressCallback) ([]string, []string) {
+	t.Helper()
+	type result struct {
+		names []string
+		err   error
+	}
+	recvChan := make(chan result, 1)
+	go func() {
+		names, err := receiver.recvFiles(path, recvProgress)
+		recvChan <- result{names, err}
+	}()
+	remoteNames, err := sender.sendFiles(files, sendProgress)
+	require.Nil(t, err)
+	res := <-recvChan
+	require.Nil(t, res.err)
+	return remoteNames, res.names
+}
+
 func TestTransferAction(t *testing.T) {
 	SetAffectedByWindows(false) // test as on Linux
 	defer func() {
@@ -210,3 +255,397 @@ func TestStripTmuxStatusLine(t *testing.T) {
 		assert.Equal([]byte("ABC123"), transfer.stripTmuxStatusLine([]byte("ABC"+P+"123"+P[:len(P)-i])))
 	}
 }
+
+func TestCreatePartialFiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	transfer := newTransfer(nil, nil)
+	transfer.transferConfig.Overwrite = true
+
+	fullPath := filepath.Join(testPath, "file.txt")
+	partPath := filepath.Join(testPath, ".file.txt"+kPartialFileSuffix)
+	require.Nil(os.WriteFile(fullPath, []byte("old content"), 0644))
+
+	file, localName, err := transfer.createFile(testPath, "file.txt", true, nil)
+	require.Nil(err)
+	assert.Equal("file.txt", localName)
+	require.Nil(writeAll(file, []byte("new content")))
+	require.Nil(file.Close())
+
+	content, err := os.ReadFile(fullPath)
+	require.Nil(err)
+	assert.Equal("old content", string(content))
+	content, err = os.ReadFile(partPath)
+	require.Nil(err)
+	assert.Equal("new content", string(content))
+	assert.Equal([]string{partPath}, transfer.createdFiles)
+
+	require.Nil(transfer.commitPartialFiles())
+	content, err = os.ReadFile(fullPath)
+	require.Nil(err)
+	assert.Equal("new content", string(content))
+	_, err = os.Stat(partPath)
+	assert.True(os.IsNotExist(err))
+	assert.Equal([]string{fullPath}, transfer.createdFiles)
+
+	file, _, err = transfer.createFile(testPath, "other.txt", true, nil)
+	require.Nil(err)
+	require.Nil(file.Close())
+	deletedFiles := transfer.deleteCreatedFiles()
+	assert.Equal([]string{fullPath, filepath.Join(testPath, ".other.txt"+kPartialFileSuffix)}, deletedFiles)
+	_, err = os.Stat(filepath.Join(testPath, "other.txt"))
+	assert.True(os.IsNotExist(err))
+
+	longName := strings.Repeat("x", kMaxFileNameLength)
+	assert.LessOrEqual(len(filepath.Base(getPartialFilePath(filepath.Join(testPath, longName)))), kMaxFileNameLength)
+}
+
+func TestPreserveModTime(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	srcPath := filepath.Join(testPath, "src")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "file.txt"), []byte("content"), 0644))
+	fileTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	dirTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	require.Nil(os.Chtimes(filepath.Join(srcPath, "file.txt"), fileTime, fileTime))
+	require.Nil(os.Chtimes(srcPath, dirTime, dirTime))
+
+	srcFiles, err := checkPathsReadable([]string{srcPath}, true, false, nil)
+	require.Nil(err)
+	require.Equal(2, len(srcFiles))
+	require.NotNil(srcFiles[1].ModTime)
+	assert.Equal(fileTime.UnixNano(), *srcFiles[1].ModTime)
+
+	recv := func(protocol int) string {
+		t.Helper()
+		dstPath, err := os.MkdirTemp(testPath, "dst_")
+		require.Nil(err)
+		transfer := newTransfer(nil, nil)
+		transfer.transferConfig.Protocol = protocol
+		for _, srcFile := range srcFiles {
+			source, err := srcFile.marshalSourceFile()
+			require.Nil(err)
+			srcFile, err := unmarshalSourceFile(source)
+			require.Nil(err)
+			file, _, err := transfer.createDirOrFile(dstPath, srcFile, true)
+			require.Nil(err)
+			if file != nil {
+				require.Nil(writeAll(file, []byte("content")))
+				require.Nil(file.Close())
+				require.Nil(transfer.commitPartialFiles())
+			}
+		}
+		require.Nil(transfer.commitDirModTimes())
+		return filepath.Join(dstPath, "src")
+	}
+
+	dstPath := recv(kProtocolVersion5)
+	info, err := os.Stat(filepath.Join(dstPath, "file.txt"))
+	require.Nil(err)
+	assert.True(fileTime.Equal(info.ModTime()))
+	info, err = os.Stat(dstPath)
+	require.Nil(err)
+	assert.True(dirTime.Equal(info.ModTime()))
+
+	dstPath = recv(kProtocolVersion4)
+	info, err = os.Stat(filepath.Join(dstPath, "file.txt"))
+	require.Nil(err)
+	assert.False(fileTime.Equal(info.ModTime()))
+}
+
+func TestTransferSymlinks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	srcPath := filepath.Join(testPath, "src")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "lib64"), 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "lib64", "file.txt"), []byte("content"), 0644))
+	require.Nil(os.Symlink("lib64", filepath.Join(srcPath, "lib")))
+	require.Nil(os.Symlink(".", filepath.Join(srcPath, "loop")))
+
+	_, err = checkPathsReadable([]string{srcPath}, true, false, nil)
+	assert.NotNil(err)
+	srcFiles, err := checkPathsReadable([]string{srcPath}, true, true, nil)
+	require.Nil(err)
+	require.Equal(5, len(srcFiles))
+
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(dstPath, 0755))
+	transfer := newTransfer(nil, nil)
+	transfer.transferConfig.Links = true
+	for _, srcFile := range srcFiles {
+		source, err := srcFile.marshalSourceFile()
+		require.Nil(err)
+		srcFile, err := unmarshalSourceFile(source)
+		require.Nil(err)
+		file, _, err := transfer.createDirOrFile(dstPath, srcFile, true)
+		require.Nil(err)
+		if file != nil {
+			require.Nil(writeAll(file, []byte("content")))
+			require.Nil(file.Close())
+			require.Nil(transfer.commitPartialFiles())
+		}
+	}
+	target, err := os.Readlink(filepath.Join(dstPath, "src", "lib"))
+	require.Nil(err)
+	assert.Equal("lib64", target)
+	content, err := os.ReadFile(filepath.Join(dstPath, "src", "lib", "file.txt"))
+	require.Nil(err)
+	assert.Equal("content", string(content))
+
+	createLink := func(name, target string) error {
+		srcFile := &sourceFile{PathID: 9, RelPath: []string{"src", name}, Link: target}
+		_, _, err := transfer.createDirOrFile(dstPath, srcFile, true)
+		return err
+	}
+	assert.Nil(createLink("up", "../src/lib64"))
+	assert.NotNil(createLink("abs", "/etc"))
+	assert.NotNil(createLink("parent", "../.."))
+	assert.NotNil(createLink("climb", "lib/../../.."))
+	_, err = os.Lstat(filepath.Join(dstPath, "src", "parent"))
+	assert.True(os.IsNotExist(err))
+
+	transfer.transferConfig.Links = false
+	assert.NotNil(createLink("other", "lib64"))
+}
+
+func TestUnsafePaths(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	dstPath := filepath.Join(testPath, "dst")
+	outPath := filepath.Join(testPath, "out")
+	require.Nil(os.MkdirAll(filepath.Join(dstPath, "dir"), 0755))
+	require.Nil(os.MkdirAll(outPath, 0755))
+	require.Nil(os.Symlink(outPath, filepath.Join(dstPath, "dir", "escape")))
+	require.Nil(os.Symlink("dir", filepath.Join(dstPath, "inside")))
+	require.Nil(os.Symlink(filepath.Join(outPath, "passwd"), filepath.Join(dstPath, ".passwd.trzsz-part")))
+
+	transfer := newTransfer(nil, nil)
+	transfer.transferConfig.Links = true
+	transfer.transferConfig.OnConflict = kConflictOverwrite
+	create := func(source string) error {
+		t.Helper()
+		srcFile, err := unmarshalSourceFile(source)
+		require.Nil(err)
+		file, _, err := transfer.createDirOrFile(dstPath, srcFile, true)
+		if file != nil {
+			require.Nil(file.Close())
+		}
+		return err
+	}
+	assertUnsafe := func(source string) {
+		t.Helper()
+		err := create(source)
+		_, ok := err.(*unsafePathError)
+		assert.True(ok, "%s: %v", source, err)
+	}
+
+	assertUnsafe(`{"path_id":1,"path_name":[".."],"is_dir":true}`)
+	assertUnsafe(`{"path_id":2,"path_name":["dir",".."]}`)
+	assertUnsafe(`{"path_id":3,"path_name":["dir","..","..","file.txt"]}`)
+	assertUnsafe(`{"path_id":4,"path_name":["dir","."]}`)
+	assertUnsafe(`{"path_id":5,"path_name":["dir",""]}`)
+	assertUnsafe(`{"path_id":6,"path_name":["/etc","passwd"]}`)
+	assertUnsafe(`{"path_id":7,"path_name":["dir","../../file.txt"]}`)
+	assertUnsafe(`{"path_id":8,"path_name":["dir","a/b"]}`)
+	assertUnsafe(`{"path_id":9,"path_name":["dir","file\u0000.txt"]}`)
+	assertUnsafe(`{"path_id":10,"path_name":["dir","escape","file.txt"]}`)
+	assertUnsafe(`{"path_id":11,"path_name":["dir","escape","sub","file.txt"]}`)
+	assertUnsafe(`{"path_id":12,"path_name":["dir","escape"],"is_dir":true}`)
+	assertUnsafe(`{"path_id":13,"path_name":["inside","escape","link"],"link":"file.txt"}`)
+	assertUnsafe(`{"path_id":14,"path_name":["passwd"]}`)
+	if isRunningOnWindows() {
+		assertUnsafe(`{"path_id":15,"path_name":["dir","..\\file.txt"]}`)
+		assertUnsafe(`{"path_id":16,"path_name":["C:","file.txt"]}`)
+	}
+
+	entries, err := os.ReadDir(outPath)
+	require.Nil(err)
+	assert.Empty(entries)
+
+	assert.Nil(create(`{"path_id":20,"path_name":["inside","file.txt"]}`))
+	assert.Nil(create(`{"path_id":21,"path_name":["dir","sub","..file.."]}`))
+	assert.Nil(create(`{"path_id":22,"path_name":["dir","escape"],"link":"sub"}`))
+	require.Nil(transfer.commitPartialFiles())
+	_, err = os.Stat(filepath.Join(dstPath, "dir", "file.txt"))
+	assert.Nil(err)
+	_, err = os.Stat(filepath.Join(dstPath, "dir", "sub", "..file.."))
+	assert.Nil(err)
+	target, err := os.Readlink(filepath.Join(dstPath, "dir", "escape"))
+	require.Nil(err)
+	assert.Equal("sub", target)
+
+	_, _, err = transfer.createFile(dstPath, "../file.txt", true, nil)
+	assert.IsType(&unsafePathError{}, err)
+	_, _, err = transfer.createFile(filepath.Join(dstPath, "dir", "sub"), "..", true, nil)
+	assert.IsType(&unsafePathError{}, err)
+	assert.Equal(`Unsafe path "a/..": dot name`, checkRelPath([]string{"a", ".."}).Error())
+}
+
+func TestConflictPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	fullPath := filepath.Join(testPath, "file.txt")
+	require.Nil(os.WriteFile(fullPath, []byte("old content"), 0644))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.Nil(os.Chtimes(fullPath, modTime, modTime))
+
+	createFile := func(policy conflictPolicy, size int64, modTime time.Time) (string, error) {
+		t.Helper()
+		transfer := newTransfer(nil, nil)
+		transfer.transferConfig.OnConflict = policy
+		mtime := modTime.UnixNano()
+		srcFile := &sourceFile{RelPath: []string{"file.txt"}, Size: size, ModTime: &mtime}
+		file, localName, err := transfer.createDirOrFile(testPath, srcFile, true)
+		if file != nil {
+			_ = file.Close()
+			transfer.deleteCreatedFiles()
+		}
+		return localName, err
+	}
+
+	localName, err := createFile(kConflictOverwrite, 1, modTime)
+	assert.Nil(err)
+	assert.Equal("file.txt", localName)
+	localName, err = createFile(kConflictRename, 1, modTime)
+	assert.Nil(err)
+	assert.Equal("file.txt.0", localName)
+	localName, err = createFile(kConflictSkip, 100, modTime.Add(time.Hour))
+	assert.Equal(errFileSkipped, err)
+	assert.Equal("file.txt", localName)
+
+	_, err = createFile(kConflictNewer, 1, modTime)
+	assert.Equal(errFileSkipped, err)
+	_, err = createFile(kConflictNewer, 1, modTime.Add(time.Second))
+	assert.Nil(err)
+
+	_, err = createFile(kConflictLarger, 11, modTime)
+	assert.Equal(errFileSkipped, err)
+	_, err = createFile(kConflictLarger, 12, modTime)
+	assert.Nil(err)
+
+	content, err := os.ReadFile(fullPath)
+	require.Nil(err)
+	assert.Equal("old content", string(content))
+}
+
+func TestTransferTotalSize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	srcPath := filepath.Join(testPath, "src")
+	require.Nil(os.MkdirAll(filepath.Join(srcPath, "sub"), 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "a.txt"), make([]byte, 1000), 0644))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "sub", "b.txt"), make([]byte, 2345), 0644))
+	require.Nil(os.Symlink("a.txt", filepath.Join(srcPath, "link")))
+	srcFiles, err := checkPathsReadable([]string{srcPath}, true, true, nil)
+	require.Nil(err)
+	assert.Equal(int64(3345), getTotalSize(srcFiles))
+	assert.Equal(int64(-1), getTotalSize([]*sourceFile{newStreamSourceFile("stdin")}))
+
+	for _, protocol := range []int{kProtocolVersion15, kProtocolVersion} {
+		dstPath := filepath.Join(testPath, fmt.Sprintf("dst%d", protocol))
+		require.Nil(os.MkdirAll(dstPath, 0755))
+		srcFiles, err := checkPathsReadable([]string{srcPath}, true, true, nil) // archived while sending
+		require.Nil(err)
+		sender, receiver := newTransferPair(protocol)
+		for _, transfer := range []*trzszTransfer{sender, receiver} {
+			transfer.transferConfig.Directory = true
+			transfer.transferConfig.Links = true
+		}
+		var sendProgress, recvProgress []TransferProgress
+		transferFiles(t, sender, receiver, srcFiles, dstPath,
+			&requestProgress{callback: func(p TransferProgress) { sendProgress = append(sendProgress, p) }},
+			&requestProgress{callback: func(p TransferProgress) { recvProgress = append(recvProgress, p) }})
+		for _, progresses := range [][]TransferProgress{sendProgress, recvProgress} {
+			require.NotEmpty(progresses)
+			last := progresses[len(progresses)-1]
+			if protocol < kProtocolVersion16 {
+				assert.Equal(int64(0), last.TotalSize)
+				assert.Equal(int64(0), last.TotalStep)
+			} else {
+				assert.Equal(int64(3345), last.TotalSize)
+				assert.Equal(int64(3345), last.TotalStep)
+			}
+		}
+	}
+}
+
+func TestTransferTotalSizeSkipped(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+
+	srcPath := filepath.Join(testPath, "src", "cfg")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.MkdirAll(filepath.Join(dstPath, "cfg"), 0755))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "a.txt"), make([]byte, 1000), 0644))
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "b.txt"), make([]byte, 2345), 0644))
+	require.Nil(os.WriteFile(filepath.Join(dstPath, "cfg", "a.txt"), make([]byte, 1000), 0644))
+	require.Nil(os.WriteFile(filepath.Join(dstPath, "a.txt"), []byte("newer"), 0644))
+	modTime := time.Now().Add(time.Hour)
+	require.Nil(os.Chtimes(filepath.Join(dstPath, "a.txt"), modTime, modTime))
+
+	for _, sync := range []bool{false, true} {
+		paths := []string{filepath.Join(srcPath, "a.txt"), filepath.Join(srcPath, "b.txt")}
+		if sync {
+			paths = []string{srcPath}
+		}
+		srcFiles, err := checkPathsReadable(paths, sync, false, nil)
+		require.Nil(err)
+		sender, receiver := newTransferPair(kProtocolVersion)
+		for _, transfer := range []*trzszTransfer{sender, receiver} {
+			transfer.transferConfig.Directory = sync
+			transfer.transferConfig.Sync = sync
+			transfer.transferConfig.OnConflict = kConflictNewer
+		}
+		var sendProgress, recvProgress []TransferProgress
+		transferFiles(t, sender, receiver, srcFiles, dstPath,
+			&requestProgress{callback: func(p TransferProgress) { sendProgress = append(sendProgress, p) }},
+			&requestProgress{callback: func(p TransferProgress) { recvProgress = append(recvProgress, p) }})
+		if sync {
+			assert.Len(receiver.unchangedFiles, 1)
+		} else {
+			assert.Len(receiver.skippedFiles, 1)
+		}
+		for _, progresses := range [][]TransferProgress{sendProgress, recvProgress} {
+			require.NotEmpty(progresses)
+			last := progresses[len(progresses)-1]
+			assert.Equal(int64(3345), last.TotalSize)
+			assert.Equal(int64(3345), last.TotalStep)
+		}
+	}
+}
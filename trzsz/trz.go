@@ -36,7 +36,8 @@ import (
 
 type trzArgs struct {
 	baseArgs
-	Path string `arg:"positional" default:"." help:"path to save file(s). (default: current directory)"`
+	Output string `arg:"-o,--output" placeholder:"-" help:"write the received file to stdout, only - is supported"`
+	Path   string `arg:"positional" default:"." help:"path to save file(s). (default: current directory)"`
 }
 
 func (trzArgs) Description() string {
@@ -60,9 +61,22 @@ func parseTrzArgs(osArgs []string) *trzArgs {
 		flags = osArgs[1:]
 	}
 	parser.MustParse(flags)
-	if args.Recursive {
+	if args.Recursive || args.Links {
 		args.Directory = true
 	}
+	if args.Delete {
+		args.Sync = true
+	}
+	if args.Sync {
+		args.Directory = true
+		args.OnConflict = kConflictOverwrite
+	}
+	if args.OnConflict != "" {
+		args.Overwrite = args.OnConflict == kConflictOverwrite
+	}
+	if args.Output != "" {
+		args.Parallel = 0 // only one file can be written to stdout
+	}
 	return &args
 }
 
@@ -73,6 +87,7 @@ func recvFiles(transfer *trzszTransfer, args *trzArgs, tmuxMode tmuxModeType, tm
 	}
 
 	if !action.Confirm {
+		transfer.reportCancelled()
 		transfer.serverExit("Cancelled")
 		return nil
 	}
@@ -92,12 +107,39 @@ func recvFiles(transfer *trzszTransfer, args *trzArgs, tmuxMode tmuxModeType, tm
 		return simpleTrzszError("The client doesn't support transfer directory")
 	}
 
+	// check if the client doesn't support the conflict policy
+	switch args.OnConflict {
+	case kConflictSkip, kConflictNewer, kConflictLarger:
+		if action.Protocol < kProtocolVersion6 {
+			return simpleTrzszError("The client doesn't support --on-conflict=%s", args.OnConflict)
+		}
+	}
+
+	// check if the client doesn't support filtering the directories
+	if args.Directory && (len(args.Include) > 0 || len(args.Exclude) > 0) && action.Protocol < kProtocolVersion8 {
+		return simpleTrzszError("The client doesn't support --include or --exclude")
+	}
+
+	// check if the client doesn't support syncing directories
+	if args.Sync && action.Protocol < kProtocolVersion11 {
+		return simpleTrzszError("The client doesn't support --sync")
+	}
+
+	// check if the client doesn't support transfer symlinks
+	if args.Links && !action.SupportLinks {
+		return simpleTrzszError("The client doesn't support transfer symlinks")
+	}
+
 	escapeChars := getEscapeChars(args.Escape)
 	if err := transfer.sendConfig(&args.baseArgs, action, escapeChars, tmuxMode, tmuxPaneWidth); err != nil {
 		return err
 	}
 
-	localNames, err := transfer.recvFiles(args.Path, nil)
+	if err := transfer.acceptWorkers(); err != nil {
+		return err
+	}
+
+	localNames, err := transfer.recvFilesWithRetry(args.Path, nil, false)
 	if err != nil {
 		return err
 	}
@@ -106,7 +148,13 @@ func recvFiles(transfer *trzszTransfer, args *trzArgs, tmuxMode tmuxModeType, tm
 		return err
 	}
 
-	transfer.serverExit(formatSavedFiles(localNames, args.Path))
+	destPath := args.Path
+	if transfer.streamOutput != nil {
+		destPath = "stdout"
+	}
+	transfer.reportSavedNames(localNames)
+	transfer.serverExit(formatSavedFiles(localNames, transfer.skippedFiles, destPath) +
+		formatSyncedFiles(transfer.unchangedFiles, transfer.deletedFiles))
 	return nil
 }
 
@@ -130,14 +178,30 @@ func TrzMain() int {
 	defer cleanupOnExit()
 
 	var err error
-	args.Path, err = filepath.Abs(args.Path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Get absolute path of [%s] failed: %v\r\n", args.Path, err)
-		return -1
-	}
-	if err := checkPathWritable(args.Path); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return -2
+	var stdout *os.File
+	if args.Output != "" {
+		if args.Output != kStdioFileName {
+			fmt.Fprintf(os.Stderr, "Only - ( stdout ) is supported by --output, but got [%s]\r\n", args.Output)
+			return -1
+		}
+		if args.Directory {
+			fmt.Fprintln(os.Stderr, "Directories can't be written to stdout")
+			return -1
+		}
+		if stdout, err = redirectStdout(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -2
+		}
+	} else {
+		args.Path, err = filepath.Abs(args.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Get absolute path of [%s] failed: %v\r\n", args.Path, err)
+			return -1
+		}
+		if err := checkPathWritable(args.Path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -2
+		}
 	}
 
 	tmuxMode, realStdout, tmuxPaneWidth, err := checkTmux()
@@ -176,7 +240,8 @@ func TrzMain() int {
 	if args.Directory {
 		mode = "D"
 	}
-	_, _ = fmt.Fprintf(os.Stdout, "\x1b[s::TRZSZ:TRANSFER:%s:%s:%013d:%d\r\n", mode, kTrzszVersion, uniqueID, port)
+	_, _ = fmt.Fprintf(os.Stdout, "\x1b[s::TRZSZ:TRANSFER:%s:%s:%013d:%d%s\r\n", mode, kTrzszVersion, uniqueID, port,
+		signTrzszTrigger(mode[0], fmt.Sprintf("%013d", uniqueID), port))
 	_ = os.Stdout.Sync()
 
 	var state *term.State
@@ -191,6 +256,16 @@ func TrzMain() int {
 	}
 
 	transfer := newTransfer(realStdout, state)
+	if stdout != nil {
+		transfer.streamOutput = stdout
+	}
+	if args.JSON {
+		if stdout != nil {
+			transfer.report = newTransferReport("trz", kStdioFileName)
+		} else {
+			transfer.report = newTransferReport("trz", args.Path)
+		}
+	}
 	defer func() {
 		if err := recover(); err != nil {
 			transfer.serverError(newTrzszError(fmt.Sprintf("%v", err), "panic", true))
@@ -199,7 +274,7 @@ func TrzMain() int {
 
 	if listener != nil {
 		defer func() { _ = listener.Close() }()
-		transfer.acceptOnTunnel(listener, fmt.Sprintf("%013d", uniqueID), port)
+		transfer.acceptOnTunnel(listener, fmt.Sprintf("%013d", uniqueID), port, args.Parallel)
 	}
 	wrapTransferInput(transfer, os.Stdin, false)
 	handleServerSignal(transfer)
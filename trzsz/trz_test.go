@@ -39,7 +39,7 @@ func newTrzArgs(args baseArgs, path string) *trzArgs {
 	if args.Timeout == 0 {
 		args.Timeout = 20
 	}
-	return &trzArgs{args, path}
+	return &trzArgs{baseArgs: args, Path: path}
 }
 
 func TestTrzArgs(t *testing.T) {
@@ -63,12 +63,16 @@ func TestTrzArgs(t *testing.T) {
 	assertArgsEqual("-d", newTrzArgs(baseArgs{Directory: true}, "."))
 	assertArgsEqual("-d -d", newTrzArgs(baseArgs{Directory: true}, "."))
 	assertArgsEqual("-r", newTrzArgs(baseArgs{Directory: true, Recursive: true}, "."))
+	assertArgsEqual("-L", newTrzArgs(baseArgs{Directory: true, Links: true}, "."))
 	assertArgsEqual("-f", newTrzArgs(baseArgs{Fork: true}, "."))
 	assertArgsEqual("-B 2k", newTrzArgs(baseArgs{Bufsize: bufferSize{2 * 1024}}, "."))
 	assertArgsEqual("-t 3", newTrzArgs(baseArgs{Timeout: 3}, "."))
-	assertArgsEqual("-cNo", newTrzArgs(baseArgs{Compress: kCompressNo}, "."))
-	assertArgsEqual("-c yes", newTrzArgs(baseArgs{Compress: kCompressYes}, "."))
-	assertArgsEqual("-c AUTO", newTrzArgs(baseArgs{Compress: kCompressAuto}, "."))
+	assertArgsEqual("-cNo", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressNo}}, "."))
+	assertArgsEqual("-c yes", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressYes}}, "."))
+	assertArgsEqual("-c AUTO", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressAuto}}, "."))
+	assertArgsEqual("-c zstd", newTrzArgs(baseArgs{Compress: compressOption{Codec: kCodecZstd}}, "."))
+	assertArgsEqual("-c s2", newTrzArgs(baseArgs{Compress: compressOption{Codec: kCodecS2}}, "."))
+	assertArgsEqual("-c lz4", newTrzArgs(baseArgs{Compress: compressOption{Codec: kCodecS2}}, "."))
 
 	assertArgsEqual("--quiet", newTrzArgs(baseArgs{Quiet: true}, "."))
 	assertArgsEqual("--overwrite", newTrzArgs(baseArgs{Overwrite: true}, "."))
@@ -77,12 +81,32 @@ func TestTrzArgs(t *testing.T) {
 	assertArgsEqual("--directory", newTrzArgs(baseArgs{Directory: true}, "."))
 	assertArgsEqual("--directory -d", newTrzArgs(baseArgs{Directory: true}, "."))
 	assertArgsEqual("--recursive", newTrzArgs(baseArgs{Directory: true, Recursive: true}, "."))
+	assertArgsEqual("--links", newTrzArgs(baseArgs{Directory: true, Links: true}, "."))
+	assertArgsEqual("--on-conflict skip", newTrzArgs(baseArgs{OnConflict: kConflictSkip}, "."))
+	assertArgsEqual("--on-conflict=Newer", newTrzArgs(baseArgs{OnConflict: kConflictNewer}, "."))
+	assertArgsEqual("--on-conflict overwrite", newTrzArgs(baseArgs{Overwrite: true, OnConflict: kConflictOverwrite}, "."))
+	assertArgsEqual("-P 4", newTrzArgs(baseArgs{Parallel: 4}, "."))
+	assertArgsEqual("--parallel 8 -d", newTrzArgs(baseArgs{Directory: true, Parallel: 8}, "."))
+	assertArgsEqual("-d --exclude .git --exclude *.o", newTrzArgs(baseArgs{Directory: true, Exclude: []string{".git", "*.o"}}, "."))
+	assertArgsEqual("-d --include=*.go", newTrzArgs(baseArgs{Directory: true, Include: []string{"*.go"}}, "."))
+	assertArgsEqual("--json", newTrzArgs(baseArgs{JSON: true}, "."))
+	assertArgsEqual("-o -", &trzArgs{baseArgs: newTrzArgs(baseArgs{}, ".").baseArgs, Output: "-", Path: "."})
+	assertArgsEqual("--output - -P 4", &trzArgs{baseArgs: newTrzArgs(baseArgs{}, ".").baseArgs, Output: "-", Path: "."})
+	assertArgsEqual("--bwlimit 1M", newTrzArgs(baseArgs{BwLimit: bandwidthLimit{1024 * 1024}}, "."))
+	assertArgsEqual("--bwlimit=512k", newTrzArgs(baseArgs{BwLimit: bandwidthLimit{512 * 1024}}, "."))
+	assertArgsEqual("--bwlimit 0", newTrzArgs(baseArgs{}, "."))
+	assertArgsEqual("--retry=2", newTrzArgs(baseArgs{Retry: 2}, "."))
+	assertArgsEqual("--pacing=RTT", newTrzArgs(baseArgs{Pacing: kPacingRTT}, "."))
+	assertArgsEqual("--sync --on-conflict skip", newTrzArgs(baseArgs{Directory: true, Overwrite: true,
+		OnConflict: kConflictOverwrite, Sync: true}, "."))
+	assertArgsEqual("--sync --delete", newTrzArgs(baseArgs{Directory: true, Overwrite: true,
+		OnConflict: kConflictOverwrite, Sync: true, Delete: true}, "."))
 	assertArgsEqual("--fork", newTrzArgs(baseArgs{Fork: true}, "."))
 	assertArgsEqual("--bufsize 2M", newTrzArgs(baseArgs{Bufsize: bufferSize{2 * 1024 * 1024}}, "."))
 	assertArgsEqual("--timeout 55", newTrzArgs(baseArgs{Timeout: 55}, "."))
-	assertArgsEqual("--compress No", newTrzArgs(baseArgs{Compress: kCompressNo}, "."))
-	assertArgsEqual("--compress yes", newTrzArgs(baseArgs{Compress: kCompressYes}, "."))
-	assertArgsEqual("--compress AUTO", newTrzArgs(baseArgs{Compress: kCompressAuto}, "."))
+	assertArgsEqual("--compress No", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressNo}}, "."))
+	assertArgsEqual("--compress yes", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressYes}}, "."))
+	assertArgsEqual("--compress AUTO", newTrzArgs(baseArgs{Compress: compressOption{Type: kCompressAuto}}, "."))
 
 	assertArgsEqual("-B1024", newTrzArgs(baseArgs{Bufsize: bufferSize{1024}}, "."))
 	assertArgsEqual("-B1025b", newTrzArgs(baseArgs{Bufsize: bufferSize{1025}}, "."))
@@ -95,7 +119,7 @@ func TestTrzArgs(t *testing.T) {
 	assertArgsEqual("-yq", newTrzArgs(baseArgs{Quiet: true, Overwrite: true}, "."))
 	assertArgsEqual("-bed", newTrzArgs(baseArgs{Binary: true, Escape: true, Directory: true}, "."))
 	assertArgsEqual("-yrB 2096 -cYes", newTrzArgs(baseArgs{Overwrite: true, Directory: true, Recursive: true,
-		Bufsize: bufferSize{2096}, Compress: kCompressYes}, "."))
+		Bufsize: bufferSize{2096}, Compress: compressOption{Type: kCompressYes}}, "."))
 	assertArgsEqual("-ebt300", newTrzArgs(baseArgs{Binary: true, Escape: true, Timeout: 300}, "."))
 	assertArgsEqual("-yqB3K -eb -t 9 -d", newTrzArgs(baseArgs{Quiet: true, Overwrite: true,
 		Bufsize: bufferSize{3 * 1024}, Escape: true, Binary: true, Timeout: 9, Directory: true}, "."))
@@ -123,6 +147,9 @@ func TestTrzArgs(t *testing.T) {
 	assertArgsError("-B10x", "invalid size 10x")
 	assertArgsError("-Bb", "invalid size b")
 	assertArgsError("-cy", "invalid compress type y")
+	assertArgsError("-c zstd:23", "invalid zstd level 23")
+	assertArgsError("-c yes:1", "invalid compress type yes:1")
+	assertArgsError("--on-conflict keep", "invalid conflict policy keep")
 	assertArgsError("-tiii", "iii")
 	assertArgsError("-t --directory", "missing value")
 	assertArgsError("-x", "unknown argument -x")
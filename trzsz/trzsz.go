@@ -25,9 +25,13 @@ SOFTWARE.
 package trzsz
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"golang.org/x/term"
@@ -41,6 +45,11 @@ type trzszArgs struct {
 	DragFile bool
 	Zmodem   bool
 	OSC52    bool
+	Auth     bool
+	Serial   string
+	Baud     int
+	Parity   string
+	Flow     string
 	Name     string
 	Args     []string
 }
@@ -50,8 +59,9 @@ func printVersion() {
 }
 
 func printHelp() {
-	fmt.Print("usage: trzsz [-h] [-v] [-r] [-t] [-d] [-z] command line\n\n" +
-		"Wrapping command line to support trzsz ( trz / tsz ).\n\n" +
+	fmt.Print("usage: trzsz [-h] [-v] [-r] [-t] [-d] [-z] [-a] command line\n" +
+		"       trzsz [-t] [-d] [-z] -s DEV [--baud N] [--parity P] [--flow F]\n\n" +
+		"Wrapping command line or serial port to support trzsz ( trz / tsz ).\n\n" +
 		"positional arguments:\n" +
 		"  command line       the original command line\n\n" +
 		"optional arguments:\n" +
@@ -60,22 +70,42 @@ func printHelp() {
 		"  -r, --relay        run as a trzsz relay server\n" +
 		"  -t, --tracelog     eanble trace log for debugging\n" +
 		"  -d, --dragfile     enable drag file(s) to upload\n" +
-		"  -z, --zmodem       enable zmodem lrzsz (rz / sz)\n" +
-		"  -o, --osc52        enable clipboard integration\n")
+		"  -z, --zmodem       enable zmodem (rz / sz) and x/ymodem\n" +
+		"  -o, --osc52        enable clipboard integration\n" +
+		"  -a, --auth         ignore the trz / tsz not authenticated by $LC_TRZSZ_SECRET\n" +
+		"  -s, --serial DEV   open the serial port instead of running a command line\n" +
+		"  --baud N           baud rate of the serial port (default: 115200)\n" +
+		"  --parity P         parity of the serial port: none, odd, even (default: none)\n" +
+		"  --flow F           flow control of the serial port: none, rtscts, xonxoff (default: none)\n")
 }
 
-func parseTrzszArgs() *trzszArgs {
-	args := &trzszArgs{}
+func parseTrzszArgs(osArgs []string) (*trzszArgs, error) {
+	args := &trzszArgs{Baud: 115200, Parity: kParityNone, Flow: kFlowNone}
 	var i int
+	// the value of an option is the next argument, or after `=`
+	optionValue := func(name string) (string, error) {
+		if _, value, ok := strings.Cut(osArgs[i], "="); ok {
+			return value, nil
+		}
+		if i+1 >= len(osArgs) {
+			return "", fmt.Errorf("%s expects a value", name)
+		}
+		i++
+		return osArgs[i], nil
+	}
 out:
-	for i = 1; i < len(os.Args); i++ {
-		switch os.Args[i] {
+	for i = 1; i < len(osArgs); i++ {
+		option, _, _ := strings.Cut(osArgs[i], "=")
+		if !strings.HasPrefix(option, "--") {
+			option = osArgs[i]
+		}
+		switch option {
 		case "-h", "--help":
 			args.Help = true
-			return args
+			return args, nil
 		case "-v", "--version":
 			args.Version = true
-			return args
+			return args, nil
 		case "-r", "--relay":
 			args.Relay = true
 		case "-t", "--tracelog":
@@ -86,17 +116,66 @@ out:
 			args.Zmodem = true
 		case "-o", "--osc52":
 			args.OSC52 = true
+		case "-a", "--auth":
+			args.Auth = true
+		case "-s", "--serial":
+			value, err := optionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			args.Serial = value
+		case "--baud":
+			value, err := optionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			if args.Baud, err = strconv.Atoi(value); err != nil || args.Baud <= 0 {
+				return nil, fmt.Errorf("invalid baud rate: %s", value)
+			}
+		case "--parity":
+			value, err := optionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			if args.Parity = strings.ToLower(value); args.Parity != kParityNone &&
+				args.Parity != kParityOdd && args.Parity != kParityEven {
+				return nil, fmt.Errorf("invalid parity: %s", value)
+			}
+		case "--flow":
+			value, err := optionValue(option)
+			if err != nil {
+				return nil, err
+			}
+			if args.Flow = strings.ToLower(value); args.Flow != kFlowNone &&
+				args.Flow != kFlowRtsCts && args.Flow != kFlowXonXoff {
+				return nil, fmt.Errorf("invalid flow control: %s", value)
+			}
 		default:
 			break out
 		}
 	}
-	if i >= len(os.Args) {
+	if args.Serial != "" {
+		if i < len(osArgs) {
+			return nil, fmt.Errorf("the command line can't be used with --serial")
+		}
+		if args.Relay {
+			return nil, fmt.Errorf("--relay can't be used with --serial")
+		}
+		if args.Auth {
+			return nil, fmt.Errorf("--auth can't be used with --serial")
+		}
+		return args, nil
+	}
+	if args.Relay && args.Auth {
+		return nil, fmt.Errorf("--auth can't be used with --relay")
+	}
+	if i >= len(osArgs) {
 		args.Help = true
-		return args
+		return args, nil
 	}
-	args.Name = os.Args[i]
-	args.Args = os.Args[i+1:]
-	return args
+	args.Name = osArgs[i]
+	args.Args = osArgs[i+1:]
+	return args, nil
 }
 
 func handleSignal(pty *trzszPty, filter *TrzszFilter) {
@@ -122,7 +201,11 @@ func handleSignal(pty *trzszPty, filter *TrzszFilter) {
 // TrzszMain is the main function of `trzsz` binary.
 func TrzszMain() int {
 	// parse command line arguments
-	args := parseTrzszArgs()
+	args, err := parseTrzszArgs(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return -1
+	}
 	if args.Help {
 		printHelp()
 		return 0
@@ -141,6 +224,23 @@ func TrzszMain() int {
 		return -1
 	}
 
+	// open the serial port instead
+	if args.Serial != "" {
+		return runSerial(args)
+	}
+
+	// the secret is inherited by the command line, and forwarded by ssh as `SendEnv LC_*`
+	var secret string
+	if args.Auth {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			fmt.Fprintf(os.Stderr, "generate secret failed: %v\r\n", err)
+			return -1
+		}
+		secret = hex.EncodeToString(buf)
+		_ = os.Setenv(kTrzszSecretEnv, secret)
+	}
+
 	// spawn a pty
 	pty, err := spawn(args.Name, args.Args...)
 	if err != nil {
@@ -180,8 +280,13 @@ func TrzszMain() int {
 			DetectTraceLog:  args.TraceLog,
 			EnableZmodem:    args.Zmodem,
 			EnableOSC52:     args.OSC52,
+			TriggerSecret:   secret,
 		})
 		filter.readTrzszConfig()
+		// the progress bar is messy if the output is not a terminal, e.g. redirected to a log file
+		if filter.progressStyle.Load() == nil && !term.IsTerminal(int(os.Stdout.Fd())) {
+			filter.SetProgressStyle(kProgressLog)
+		}
 		pty.OnResize(filter.SetTerminalColumns)
 		// handle signal
 		go handleSignal(pty, filter)
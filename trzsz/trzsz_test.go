@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrzszArgs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	assertArgsEqual := func(cmdline string, expected *trzszArgs) {
+		t.Helper()
+		args, err := parseTrzszArgs(strings.Split("trzsz "+cmdline, " "))
+		require.Nil(err)
+		if expected.Baud == 0 {
+			expected.Baud, expected.Parity, expected.Flow = 115200, kParityNone, kFlowNone
+		}
+		assert.Equal(expected, args)
+	}
+	assertArgsError := func(cmdline, errMsg string) {
+		t.Helper()
+		_, err := parseTrzszArgs(strings.Split("trzsz "+cmdline, " "))
+		require.NotNil(err)
+		assert.Equal(errMsg, err.Error())
+	}
+
+	assertArgsEqual("ssh a", &trzszArgs{Name: "ssh", Args: []string{"a"}})
+	assertArgsEqual("-d -z --osc52 ssh -p 22 a", &trzszArgs{DragFile: true, Zmodem: true, OSC52: true,
+		Name: "ssh", Args: []string{"-p", "22", "a"}})
+	assertArgsEqual("-z", &trzszArgs{Zmodem: true, Help: true})
+	assertArgsEqual("-a --dragfile ssh a", &trzszArgs{Auth: true, DragFile: true, Name: "ssh", Args: []string{"a"}})
+
+	assertArgsEqual("-s /dev/ttyUSB0", &trzszArgs{Serial: "/dev/ttyUSB0"})
+	assertArgsEqual("-z --serial=/dev/ttyUSB0 --baud 9600 --parity=Even --flow rtscts",
+		&trzszArgs{Zmodem: true, Serial: "/dev/ttyUSB0", Baud: 9600, Parity: kParityEven, Flow: kFlowRtsCts})
+	assertArgsEqual("--serial COM3 --parity odd --flow=xonxoff",
+		&trzszArgs{Serial: "COM3", Baud: 115200, Parity: kParityOdd, Flow: kFlowXonXoff})
+
+	assertArgsError("--serial", "--serial expects a value")
+	assertArgsError("-s /dev/ttyUSB0 --baud 0", "invalid baud rate: 0")
+	assertArgsError("-s /dev/ttyUSB0 --baud=fast", "invalid baud rate: fast")
+	assertArgsError("-s /dev/ttyUSB0 --parity mark", "invalid parity: mark")
+	assertArgsError("-s /dev/ttyUSB0 --flow dtr", "invalid flow control: dtr")
+	assertArgsError("-s /dev/ttyUSB0 ssh a", "the command line can't be used with --serial")
+	assertArgsError("-r -s /dev/ttyUSB0", "--relay can't be used with --serial")
+	assertArgsError("--auth -s /dev/ttyUSB0", "--auth can't be used with --serial")
+	assertArgsError("-r -a ssh a", "--auth can't be used with --relay")
+}
@@ -27,6 +27,7 @@ package trzsz
 import (
 	"fmt"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/trzsz/go-arg"
@@ -35,7 +36,8 @@ import (
 
 type tszArgs struct {
 	baseArgs
-	File []string `arg:"positional,required" help:"file(s) to be sent"`
+	Name string   `arg:"--name" placeholder:"NAME" help:"file name for the data read from stdin ( - ).\n(default: stdin)"`
+	File []string `arg:"positional,required" help:"file(s) to be sent, - means stdin"`
 }
 
 func (tszArgs) Description() string {
@@ -59,9 +61,19 @@ func parseTszArgs(osArgs []string) *tszArgs {
 		flags = osArgs[1:]
 	}
 	parser.MustParse(flags)
-	if args.Recursive {
+	if args.Recursive || args.Links {
 		args.Directory = true
 	}
+	if args.Delete {
+		args.Sync = true
+	}
+	if args.Sync {
+		args.Directory = true
+		args.OnConflict = kConflictOverwrite
+	}
+	if args.OnConflict != "" {
+		args.Overwrite = args.OnConflict == kConflictOverwrite
+	}
 	return &args
 }
 
@@ -72,6 +84,7 @@ func sendFiles(transfer *trzszTransfer, files []*sourceFile, args *tszArgs, tmux
 	}
 
 	if !action.Confirm {
+		transfer.reportCancelled()
 		transfer.serverExit("Cancelled")
 		return nil
 	}
@@ -91,14 +104,51 @@ func sendFiles(transfer *trzszTransfer, files []*sourceFile, args *tszArgs, tmux
 		return simpleTrzszError("The client doesn't support transfer directory")
 	}
 
+	// check if the client doesn't support the conflict policy
+	switch args.OnConflict {
+	case kConflictSkip, kConflictNewer, kConflictLarger:
+		if action.Protocol < kProtocolVersion6 {
+			return simpleTrzszError("The client doesn't support --on-conflict=%s", args.OnConflict)
+		}
+	}
+
+	// check if the client doesn't support syncing directories
+	if args.Sync && action.Protocol < kProtocolVersion11 {
+		return simpleTrzszError("The client doesn't support --sync")
+	}
+
+	// check if the client doesn't support transfer symlinks
+	if args.Links && !action.SupportLinks {
+		return simpleTrzszError("The client doesn't support transfer symlinks")
+	}
+
+	// check if the client doesn't support receiving a stream
+	if transfer.streamInput != nil && action.Protocol < kProtocolVersion9 {
+		return simpleTrzszError("The client doesn't support sending stdin")
+	}
+
 	var escapeChars [][]unicode
 	if err := transfer.sendConfig(&args.baseArgs, action, escapeChars, tmuxMode, tmuxPaneWidth); err != nil {
 		return err
 	}
 
-	if _, err := transfer.sendFiles(files, nil); err != nil {
+	// the client asks to transfer symlinks as links
+	if transfer.transferConfig.Links && !args.Links && transfer.streamInput == nil {
+		files, err = checkPathsReadable(args.File, args.Directory, true, newPathFilter(args.Include, args.Exclude))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := transfer.acceptWorkers(); err != nil {
+		return err
+	}
+
+	remoteNames, err := transfer.sendFilesWithRetry(files, nil, false)
+	if err != nil {
 		return err
 	}
+	transfer.reportSavedNames(remoteNames)
 
 	msg, err := transfer.recvExit()
 	if err != nil {
@@ -128,12 +178,31 @@ func TszMain() int {
 	// cleanup on exit
 	defer cleanupOnExit()
 
-	files, err := checkPathsReadable(args.File, args.Directory)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return -1
+	var files []*sourceFile
+	var stdin *os.File
+	var err error
+	if slices.Contains(args.File, kStdioFileName) {
+		if len(args.File) > 1 {
+			fmt.Fprintln(os.Stderr, "- ( stdin ) can't be sent with other files")
+			return -1
+		}
+		if stdin, err = redirectStdin(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
+		name := args.Name
+		if name == "" {
+			name = "stdin"
+		}
+		files = []*sourceFile{newStreamSourceFile(name)}
+	} else {
+		files, err = checkPathsReadable(args.File, args.Directory, args.Links, newPathFilter(args.Include, args.Exclude))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return -1
+		}
 	}
-	if args.Overwrite {
+	if getConflictPolicy(args.Overwrite, args.OnConflict) != kConflictRename {
 		if err := checkDuplicateNames(files); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return -2
@@ -172,7 +241,8 @@ func TszMain() int {
 
 	listener, port := listenForTunnel()
 
-	_, _ = fmt.Fprintf(os.Stdout, "\x1b[s::TRZSZ:TRANSFER:S:%s:%013d:%d\r\n", kTrzszVersion, uniqueID, port)
+	_, _ = fmt.Fprintf(os.Stdout, "\x1b[s::TRZSZ:TRANSFER:S:%s:%013d:%d%s\r\n", kTrzszVersion, uniqueID, port,
+		signTrzszTrigger('S', fmt.Sprintf("%013d", uniqueID), port))
 	_ = os.Stdout.Sync()
 
 	var state *term.State
@@ -187,6 +257,12 @@ func TszMain() int {
 	}
 
 	transfer := newTransfer(realStdout, state)
+	if stdin != nil {
+		transfer.streamInput = stdin
+	}
+	if args.JSON {
+		transfer.report = newTransferReport("tsz", "")
+	}
 	defer func() {
 		if err := recover(); err != nil {
 			transfer.serverError(newTrzszError(fmt.Sprintf("%v", err), "panic", true))
@@ -195,7 +271,7 @@ func TszMain() int {
 
 	if listener != nil {
 		defer func() { _ = listener.Close() }()
-		transfer.acceptOnTunnel(listener, fmt.Sprintf("%013d", uniqueID), port)
+		transfer.acceptOnTunnel(listener, fmt.Sprintf("%013d", uniqueID), port, args.Parallel)
 	}
 	wrapTransferInput(transfer, os.Stdin, false)
 	handleServerSignal(transfer)
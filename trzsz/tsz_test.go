@@ -39,7 +39,7 @@ func newTszArgs(args baseArgs, files []string) *tszArgs {
 	if args.Timeout == 0 {
 		args.Timeout = 20
 	}
-	return &tszArgs{args, files}
+	return &tszArgs{baseArgs: args, File: files}
 }
 
 func TestTszArgs(t *testing.T) {
@@ -62,12 +62,18 @@ func TestTszArgs(t *testing.T) {
 	assertArgsEqual("-e a", newTszArgs(baseArgs{Escape: true}, []string{"a"}))
 	assertArgsEqual("-d a", newTszArgs(baseArgs{Directory: true}, []string{"a"}))
 	assertArgsEqual("-r a", newTszArgs(baseArgs{Directory: true, Recursive: true}, []string{"a"}))
+	assertArgsEqual("-L a", newTszArgs(baseArgs{Directory: true, Links: true}, []string{"a"}))
 	assertArgsEqual("-f a", newTszArgs(baseArgs{Fork: true}, []string{"a"}))
 	assertArgsEqual("-B 2k a", newTszArgs(baseArgs{Bufsize: bufferSize{2 * 1024}}, []string{"a"}))
 	assertArgsEqual("-t 3 a", newTszArgs(baseArgs{Timeout: 3}, []string{"a"}))
-	assertArgsEqual("-cno a", newTszArgs(baseArgs{Compress: kCompressNo}, []string{"a"}))
-	assertArgsEqual("-c Yes a", newTszArgs(baseArgs{Compress: kCompressYes}, []string{"a"}))
-	assertArgsEqual("-c auto a", newTszArgs(baseArgs{Compress: kCompressAuto}, []string{"a"}))
+	assertArgsEqual("-cno a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressNo}}, []string{"a"}))
+	assertArgsEqual("-c Yes a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressYes}}, []string{"a"}))
+	assertArgsEqual("-c auto a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressAuto}}, []string{"a"}))
+	assertArgsEqual("-c none a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressNo}}, []string{"a"}))
+	assertArgsEqual("-c s2 a", newTszArgs(baseArgs{Compress: compressOption{Codec: kCodecS2}}, []string{"a"}))
+	assertArgsEqual("-c LZ4 a", newTszArgs(baseArgs{Compress: compressOption{Codec: kCodecS2}}, []string{"a"}))
+	assertArgsEqual("-c ZSTD:19 a", newTszArgs(baseArgs{Compress: compressOption{Codec: kCodecZstd, Level: 19}},
+		[]string{"a"}))
 
 	assertArgsEqual("--quiet a", newTszArgs(baseArgs{Quiet: true}, []string{"a"}))
 	assertArgsEqual("--overwrite a", newTszArgs(baseArgs{Overwrite: true}, []string{"a"}))
@@ -75,12 +81,29 @@ func TestTszArgs(t *testing.T) {
 	assertArgsEqual("--escape a", newTszArgs(baseArgs{Escape: true}, []string{"a"}))
 	assertArgsEqual("--directory a", newTszArgs(baseArgs{Directory: true}, []string{"a"}))
 	assertArgsEqual("--recursive a", newTszArgs(baseArgs{Directory: true, Recursive: true}, []string{"a"}))
+	assertArgsEqual("--links a", newTszArgs(baseArgs{Directory: true, Links: true}, []string{"a"}))
+	assertArgsEqual("--on-conflict larger a", newTszArgs(baseArgs{OnConflict: kConflictLarger}, []string{"a"}))
+	assertArgsEqual("-y --on-conflict=rename -y a", newTszArgs(baseArgs{OnConflict: kConflictRename}, []string{"a"}))
+	assertArgsEqual("-P 4 a", newTszArgs(baseArgs{Parallel: 4}, []string{"a"}))
+	assertArgsEqual("--parallel=2 a b", newTszArgs(baseArgs{Parallel: 2}, []string{"a", "b"}))
+	assertArgsEqual("--json a", newTszArgs(baseArgs{JSON: true}, []string{"a"}))
+	assertArgsEqual("-", newTszArgs(baseArgs{}, []string{"-"}))
+	assertArgsEqual("--name out.log -", &tszArgs{baseArgs: newTszArgs(baseArgs{}, nil).baseArgs, Name: "out.log", File: []string{"-"}})
+	assertArgsEqual("--bwlimit 2m a", newTszArgs(baseArgs{BwLimit: bandwidthLimit{2 * 1024 * 1024}}, []string{"a"}))
+	assertArgsEqual("--retry 3 a", newTszArgs(baseArgs{Retry: 3}, []string{"a"}))
+	assertArgsEqual("--pacing fixed a", newTszArgs(baseArgs{Pacing: kPacingFixed}, []string{"a"}))
+	assertArgsEqual("--sync a", newTszArgs(baseArgs{Directory: true, Overwrite: true, OnConflict: kConflictOverwrite,
+		Sync: true}, []string{"a"}))
+	assertArgsEqual("--delete a", newTszArgs(baseArgs{Directory: true, Overwrite: true, OnConflict: kConflictOverwrite,
+		Sync: true, Delete: true}, []string{"a"}))
+	assertArgsEqual("-d --exclude node_modules a", newTszArgs(baseArgs{Directory: true, Exclude: []string{"node_modules"}}, []string{"a"}))
+	assertArgsEqual("-d --include *.go --include *.md a", newTszArgs(baseArgs{Directory: true, Include: []string{"*.go", "*.md"}}, []string{"a"}))
 	assertArgsEqual("--fork a", newTszArgs(baseArgs{Fork: true}, []string{"a"}))
 	assertArgsEqual("--bufsize 2M a", newTszArgs(baseArgs{Bufsize: bufferSize{2 * 1024 * 1024}}, []string{"a"}))
 	assertArgsEqual("--timeout 55 a", newTszArgs(baseArgs{Timeout: 55}, []string{"a"}))
-	assertArgsEqual("--compress NO a", newTszArgs(baseArgs{Compress: kCompressNo}, []string{"a"}))
-	assertArgsEqual("--compress YES a", newTszArgs(baseArgs{Compress: kCompressYes}, []string{"a"}))
-	assertArgsEqual("--compress Auto a", newTszArgs(baseArgs{Compress: kCompressAuto}, []string{"a"}))
+	assertArgsEqual("--compress NO a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressNo}}, []string{"a"}))
+	assertArgsEqual("--compress YES a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressYes}}, []string{"a"}))
+	assertArgsEqual("--compress Auto a", newTszArgs(baseArgs{Compress: compressOption{Type: kCompressAuto}}, []string{"a"}))
 
 	assertArgsEqual("-B1024 a", newTszArgs(baseArgs{Bufsize: bufferSize{1024}}, []string{"a"}))
 	assertArgsEqual("-B1025b a", newTszArgs(baseArgs{Bufsize: bufferSize{1025}}, []string{"a"}))
@@ -93,7 +116,7 @@ func TestTszArgs(t *testing.T) {
 	assertArgsEqual("-yq a", newTszArgs(baseArgs{Quiet: true, Overwrite: true}, []string{"a"}))
 	assertArgsEqual("-bed a", newTszArgs(baseArgs{Binary: true, Escape: true, Directory: true}, []string{"a"}))
 	assertArgsEqual("-yrB 2096 -cauto a", newTszArgs(baseArgs{Overwrite: true, Directory: true, Recursive: true,
-		Bufsize: bufferSize{2096}, Compress: kCompressAuto}, []string{"a"}))
+		Bufsize: bufferSize{2096}, Compress: compressOption{Type: kCompressAuto}}, []string{"a"}))
 	assertArgsEqual("-ebt300 a", newTszArgs(baseArgs{Binary: true, Escape: true, Timeout: 300}, []string{"a"}))
 	assertArgsEqual("-yqB3K -eb -t 9 -d a", newTszArgs(baseArgs{Quiet: true, Overwrite: true,
 		Bufsize: bufferSize{3 * 1024}, Escape: true, Binary: true, Timeout: 9, Directory: true}, []string{"a"}))
@@ -122,6 +145,9 @@ func TestTszArgs(t *testing.T) {
 	assertArgsError("-B10x a", "invalid size 10x")
 	assertArgsError("-Bb a", "invalid size b")
 	assertArgsError("-c y a", "invalid compress type y")
+	assertArgsError("-c zstd:0 a", "invalid zstd level 0")
+	assertArgsError("-c s2:1 a", "invalid compress type s2:1")
+	assertArgsError("-c lz4:1 a", "invalid compress type lz4:1")
 	assertArgsError("-tiii a", "iii")
 	assertArgsError("-t --directory a", "missing value")
 	assertArgsError("-x a", "unknown argument -x")
@@ -27,6 +27,7 @@ SOFTWARE.
 package trzsz
 
 import (
+	"os"
 	"syscall"
 )
 
@@ -39,3 +40,11 @@ func getSysProcAttr() *syscall.SysProcAttr {
 var getCygpath = func() string {
 	return ""
 }
+
+func openConsoleInput() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+func openConsoleOutput() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
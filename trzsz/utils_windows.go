@@ -74,3 +74,11 @@ var getCygpath = func() func() string {
 		return cygpathPath
 	}
 }()
+
+func openConsoleInput() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
+
+func openConsoleOutput() (*os.File, error) {
+	return os.OpenFile("CONOUT$", os.O_RDWR, 0)
+}
@@ -0,0 +1,546 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// the protocols of zmodemTransfer, which is ZMODEM if empty
+const (
+	kXmodem = "XMODEM"
+	kYmodem = "YMODEM"
+)
+
+const (
+	kSOH    byte = 0x01
+	kSTX    byte = 0x02
+	kEOT    byte = 0x04
+	kACK    byte = 0x06
+	kNAK    byte = 0x15
+	kCAN    byte = 0x18
+	kCPMEOF byte = 0x1a
+	kCRC16  byte = 'C'
+)
+
+const (
+	kXymodemMaxRetries = 10
+	kXymodemTimeout    = 10 * time.Second
+	kXymodemStartWait  = 3 * time.Second
+	kXymodemSenderWait = 60 * time.Second
+)
+
+var errXymodemTimeout = simpleTrzszError("Xmodem timeout")
+var errXymodemCanceled = simpleTrzszError("Cancelled by the remote")
+
+// the banners of U-Boot `loadx` / `loady`, lrzsz `rx` / `rb` and `sx` / `sb`
+var xymodemRecvRegexp = regexp.MustCompile(`Ready for binary \((xmodem|ymodem)\) download|\b(rx): ready to receive|\b(rb) waiting to receive`)
+var xymodemSendRegexp = regexp.MustCompile(`(?:Sending ([^\r\n]+), \d+ blocks: )?Give your local (XMODEM|YMODEM) receive command now`)
+
+// detectXYmodem detects a XMODEM or YMODEM transfer, which has no init sequence as ZMODEM does,
+// by the banner of the command running on the server.
+func detectXYmodem(buf []byte) *zmodemTransfer {
+	if match := xymodemRecvRegexp.FindSubmatch(buf); match != nil {
+		switch string(bytes.Join(match[1:], nil)) {
+		case "xmodem", "rx":
+			return &zmodemTransfer{upload: true, protocol: kXmodem}
+		default:
+			return &zmodemTransfer{upload: true, protocol: kYmodem}
+		}
+	}
+	if match := xymodemSendRegexp.FindSubmatch(buf); match != nil {
+		return &zmodemTransfer{upload: false, protocol: string(match[2]), fileName: string(match[1])}
+	}
+	return nil
+}
+
+// xymodemReader reads in the background, so that reading a byte can time out.
+type xymodemReader struct {
+	ch   chan []byte
+	done chan struct{}
+	buf  []byte
+	err  error
+}
+
+func newXymodemReader(reader io.Reader) *xymodemReader {
+	r := &xymodemReader{ch: make(chan []byte, 16), done: make(chan struct{})}
+	go func() {
+		defer close(r.ch)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := reader.Read(buf)
+			if n > 0 {
+				select {
+				case r.ch <- buf[:n]:
+				case <-r.done:
+					return
+				}
+			}
+			if err != nil {
+				r.err = err
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *xymodemReader) close() {
+	close(r.done)
+}
+
+func (r *xymodemReader) readByte(timeout time.Duration) (byte, error) {
+	if len(r.buf) == 0 {
+		select {
+		case buf, ok := <-r.ch:
+			if !ok {
+				return 0, r.err
+			}
+			r.buf = buf
+		case <-time.After(timeout):
+			return 0, errXymodemTimeout
+		}
+	}
+	c := r.buf[0]
+	r.buf = r.buf[1:]
+	return c, nil
+}
+
+func (r *xymodemReader) readFull(buf []byte, timeout time.Duration) error {
+	for i := range buf {
+		c, err := r.readByte(timeout)
+		if err != nil {
+			return err
+		}
+		buf[i] = c
+	}
+	return nil
+}
+
+// purge drops the input until the line is quiet, before asking to resend a block.
+func (r *xymodemReader) purge() {
+	r.buf = nil
+	for {
+		select {
+		case _, ok := <-r.ch:
+			if !ok {
+				return
+			}
+		case <-time.After(time.Second):
+			return
+		}
+	}
+}
+
+func xymodemChecksum(data []byte) byte {
+	var sum byte
+	for _, c := range data {
+		sum += c
+	}
+	return sum
+}
+
+func encodeXymodemBlock(num byte, data []byte, crc bool) []byte {
+	header := kSOH
+	if len(data) == 1024 {
+		header = kSTX
+	}
+	block := append([]byte{header, num, ^num}, data...)
+	if crc {
+		crc16 := crc16Update(0, data...)
+		return append(block, byte(crc16>>8), byte(crc16))
+	}
+	return append(block, xymodemChecksum(data))
+}
+
+// padXymodemData pads the data to a block of 128 or 1024 bytes.
+func padXymodemData(data []byte, pad byte) []byte {
+	size := 128
+	if len(data) > 128 {
+		size = 1024
+	}
+	return append(data, bytes.Repeat([]byte{pad}, size-len(data))...)
+}
+
+// xymodemReceiver receives files from the remote `sx` / `sb`, always in the CRC mode.
+type xymodemReceiver struct {
+	reader    *xymodemReader
+	writer    io.Writer
+	path      string
+	progress  progressCallback
+	ymodem    bool
+	name      string
+	savedName []string
+}
+
+func newXymodemReceiver(reader io.Reader, writer io.Writer, path string, ymodem bool, name string,
+	progress progressCallback) *xymodemReceiver {
+	return &xymodemReceiver{reader: newXymodemReader(reader), writer: writer, path: path, progress: progress,
+		ymodem: ymodem, name: name}
+}
+
+func (r *xymodemReceiver) send(c byte) error {
+	return writeAll(r.writer, []byte{c})
+}
+
+func (r *xymodemReceiver) cancel(err error) error {
+	_ = writeAll(r.writer, []byte{kCAN, kCAN, kCAN, kCAN, kCAN})
+	return err
+}
+
+// recvBlock returns the number and the data of a block, or nil data if it's EOT.
+func (r *xymodemReceiver) recvBlock(timeout time.Duration) (byte, []byte, error) {
+	for {
+		c, err := r.reader.readByte(timeout)
+		if err != nil {
+			return 0, nil, err
+		}
+		var size int
+		switch c {
+		case kSOH:
+			size = 128
+		case kSTX:
+			size = 1024
+		case kEOT:
+			return 0, nil, nil
+		case kCAN:
+			if c, err := r.reader.readByte(time.Second); err == nil && c == kCAN {
+				return 0, nil, errXymodemCanceled
+			}
+			continue
+		default:
+			continue // the noise before the block
+		}
+		block := make([]byte, size+4)
+		if err := r.reader.readFull(block, time.Second); err != nil {
+			if err == errXymodemTimeout {
+				return 0, nil, errZmodemBadCRC
+			}
+			return 0, nil, err
+		}
+		data := block[2 : 2+size]
+		if block[0] != ^block[1] || crc16Update(0, data...) != uint16(block[size+2])<<8|uint16(block[size+3]) {
+			return 0, nil, errZmodemBadCRC
+		}
+		return block[0], data, nil
+	}
+}
+
+// waitBlock sends the request until the first block arrives, then asks to resend the bad ones.
+func (r *xymodemReceiver) waitBlock(request byte) (byte, []byte, error) {
+	timeout := kXymodemTimeout
+	if request == kCRC16 {
+		timeout = kXymodemStartWait
+	}
+	for range kXymodemMaxRetries {
+		if err := r.send(request); err != nil {
+			return 0, nil, err
+		}
+		num, data, err := r.recvBlock(timeout)
+		if err != errZmodemBadCRC && err != errXymodemTimeout {
+			return num, data, err
+		}
+		if err == errZmodemBadCRC {
+			r.reader.purge()
+		}
+		if request != kCRC16 {
+			request = kNAK
+		}
+	}
+	return 0, nil, r.cancel(errXymodemTimeout)
+}
+
+func (r *xymodemReceiver) run() error {
+	defer r.reader.close()
+	for {
+		info := &zmodemFileInfo{name: r.name, size: -1}
+		if r.ymodem {
+			num, data, err := r.waitBlock(kCRC16)
+			if err != nil {
+				return err
+			}
+			if data == nil || num != 0 {
+				return r.cancel(simpleTrzszError("Ymodem expects the file info but got block %d", num))
+			}
+			if data[0] == 0 { // the end of the batch
+				return r.send(kACK)
+			}
+			if info, err = parseZmodemFileInfo(data); err != nil {
+				return r.cancel(err)
+			}
+			if err := r.send(kACK); err != nil {
+				return err
+			}
+		}
+		if err := r.recvFile(info); err != nil {
+			return err
+		}
+		if !r.ymodem {
+			return nil
+		}
+	}
+}
+
+func (r *xymodemReceiver) recvFile(info *zmodemFileInfo) error {
+	name := getZmodemFileName(info.name)
+	if name == "" {
+		name = "xmodem.bin"
+	}
+	partPath := getPartialFilePath(filepath.Join(r.path, name))
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return r.cancel(simpleTrzszError("Open [%s] error: %v", partPath, err))
+	}
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	if r.progress != nil {
+		if r.ymodem && info.hasPending {
+			r.progress.onNum(info.filesLeft)
+		}
+		r.progress.onName(name)
+		r.progress.onSize(info.size)
+	}
+
+	var step int64
+	expected := byte(1)
+	num, data, err := r.waitBlock(kCRC16)
+	for {
+		if err != nil {
+			return err
+		}
+		if data == nil { // EOT
+			break
+		}
+		if num == expected {
+			if info.size >= 0 && step+int64(len(data)) > info.size {
+				data = data[:max(info.size-step, 0)] // YMODEM pads the last block
+			}
+			if err := writeAll(file, data); err != nil {
+				return r.cancel(simpleTrzszError("Write [%s] error: %v", partPath, err))
+			}
+			step += int64(len(data))
+			expected++
+			if r.progress != nil {
+				r.progress.onStep(step)
+			}
+		} else if num != expected-1 { // not a resent block
+			return r.cancel(simpleTrzszError("Block %d is out of sequence, expect %d", num, expected))
+		}
+		num, data, err = r.waitBlock(kACK)
+	}
+
+	if err := r.send(kACK); err != nil {
+		return err
+	}
+	err = file.Close()
+	file = nil
+	if err != nil {
+		return simpleTrzszError("Close [%s] error: %v", partPath, err)
+	}
+	newName, err := saveZmodemFile(r.path, partPath, name, info)
+	if err != nil {
+		return err
+	}
+	r.savedName = append(r.savedName, newName)
+	if r.progress != nil {
+		r.progress.onDone()
+	}
+	return nil
+}
+
+// xymodemSender sends files to the remote `rx` / `rb` or U-Boot `loadx` / `loady`.
+type xymodemSender struct {
+	reader   *xymodemReader
+	writer   io.Writer
+	progress progressCallback
+	ymodem   bool
+	crc      bool
+}
+
+func newXymodemSender(reader io.Reader, writer io.Writer, ymodem bool, progress progressCallback) *xymodemSender {
+	return &xymodemSender{reader: newXymodemReader(reader), writer: writer, progress: progress, ymodem: ymodem}
+}
+
+// waitStart waits for the receiver to ask for the first block, `C` for the CRC mode, or NAK for the checksum mode.
+func (s *xymodemSender) waitStart() error {
+	deadline := time.Now().Add(kXymodemSenderWait)
+	for {
+		c, err := s.reader.readByte(time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		switch c {
+		case kCRC16:
+			s.crc = true
+			return nil
+		case kNAK:
+			s.crc = false
+			return nil
+		case kCAN:
+			if c, err := s.reader.readByte(time.Second); err == nil && c == kCAN {
+				return errXymodemCanceled
+			}
+		}
+	}
+}
+
+// sendBlock sends the block until it's acknowledged.
+func (s *xymodemSender) sendBlock(block []byte) error {
+	for range kXymodemMaxRetries {
+		if err := writeAll(s.writer, block); err != nil {
+			return err
+		}
+		for {
+			c, err := s.reader.readByte(kXymodemTimeout)
+			if err == errXymodemTimeout {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if c == kACK {
+				return nil
+			}
+			if c == kNAK {
+				break
+			}
+			if c == kCAN {
+				if c, err := s.reader.readByte(time.Second); err == nil && c == kCAN {
+					return errXymodemCanceled
+				}
+			}
+		}
+	}
+	return errXymodemTimeout
+}
+
+func (s *xymodemSender) run(files []string) error {
+	defer s.reader.close()
+	if !s.ymodem && len(files) != 1 {
+		return simpleTrzszError("XMODEM can only send one file")
+	}
+
+	var bytesLeft int64
+	for _, path := range files {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return simpleTrzszError("Stat [%s] error: %v", path, err)
+		}
+		bytesLeft += stat.Size()
+	}
+	if s.progress != nil {
+		s.progress.onNum(int64(len(files)))
+		s.progress.onTotal(bytesLeft)
+	}
+	for i, path := range files {
+		size, err := s.sendFile(path, int64(len(files)-i), bytesLeft)
+		if err != nil {
+			return err
+		}
+		bytesLeft -= size
+	}
+
+	if s.ymodem { // an empty file info ends the batch
+		if err := s.waitStart(); err != nil {
+			return err
+		}
+		return s.sendBlock(encodeXymodemBlock(0, make([]byte, 128), s.crc))
+	}
+	return nil
+}
+
+func (s *xymodemSender) sendFile(path string, filesLeft, bytesLeft int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, simpleTrzszError("Open [%s] error: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, simpleTrzszError("Stat [%s] error: %v", path, err)
+	}
+	name := filepath.Base(path)
+
+	if err := s.waitStart(); err != nil {
+		return 0, err
+	}
+	if s.ymodem {
+		info := fmt.Appendf(nil, "%s\x00%d %o %o 0 %d %d", name, stat.Size(), stat.ModTime().Unix(),
+			0100000|stat.Mode().Perm(), filesLeft, bytesLeft)
+		if len(info) > 1024 {
+			return 0, simpleTrzszError("File name too long: %s", name)
+		}
+		if err := s.sendBlock(encodeXymodemBlock(0, padXymodemData(info, 0), s.crc)); err != nil {
+			return 0, err
+		}
+		if err := s.waitStart(); err != nil {
+			return 0, err
+		}
+	}
+	if s.progress != nil {
+		s.progress.onName(name)
+		s.progress.onSize(stat.Size())
+	}
+
+	// 1K blocks are sent in the CRC mode, except the tail which is small enough for 128 bytes blocks
+	buffer := make([]byte, 1024)
+	num := byte(1)
+	var step int64
+	for step < stat.Size() {
+		size := 128
+		if s.crc && stat.Size()-step > 896 {
+			size = 1024
+		}
+		n, err := io.ReadFull(file, buffer[:size])
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, simpleTrzszError("Read [%s] error: %v", path, err)
+		}
+		if err := s.sendBlock(encodeXymodemBlock(num, padXymodemData(buffer[:n], kCPMEOF), s.crc)); err != nil {
+			return 0, err
+		}
+		num++
+		step += int64(n)
+		if s.progress != nil {
+			s.progress.onStep(step)
+		}
+	}
+
+	if err := s.sendBlock([]byte{kEOT}); err != nil {
+		return 0, err
+	}
+	if s.progress != nil {
+		s.progress.onDone()
+	}
+	return stat.Size(), nil
+}
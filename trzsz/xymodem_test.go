@@ -0,0 +1,222 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectXYmodem(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assertDetectXYmodem := func(buf string, upload bool, protocol, fileName string) {
+		t.Helper()
+		zmodem := detectXYmodem([]byte(buf))
+		if protocol == "" {
+			assert.Nil(zmodem)
+			return
+		}
+		require.NotNil(zmodem)
+		assert.Equal(upload, zmodem.upload)
+		assert.Equal(protocol, zmodem.protocol)
+		assert.Equal(fileName, zmodem.fileName)
+	}
+
+	assertDetectXYmodem("## Ready for binary (xmodem) download to 0x82000000 at 115200 bps...\r\n", true, kXmodem, "")
+	assertDetectXYmodem("## Ready for binary (ymodem) download to 0x82000000 at 115200 bps...\r\n", true, kYmodem, "")
+	assertDetectXYmodem("rx: ready to receive a.bin\r\n", true, kXmodem, "")
+	assertDetectXYmodem("rb waiting to receive.", true, kYmodem, "")
+	assertDetectXYmodem("Sending a b.bin, 12 blocks: Give your local XMODEM receive command now.\r\n",
+		false, kXmodem, "a b.bin")
+	assertDetectXYmodem("Give your local YMODEM receive command now.\r\n", false, kYmodem, "")
+
+	assertDetectXYmodem("## Ready for binary (kermit) download to 0x82000000 at 115200 bps...\r\n", false, "", "")
+	assertDetectXYmodem("prx: ready to receive a.bin\r\n", false, "", "")
+	assertDetectXYmodem("Give your local ZMODEM receive command now.\r\n", false, "", "")
+}
+
+func TestXymodemBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	block := encodeXymodemBlock(1, padXymodemData([]byte("123456789"), kCPMEOF), true)
+	assert.Equal(3+128+2, len(block))
+	assert.Equal([]byte{kSOH, 1, 0xfe}, block[:3])
+	assert.Equal(bytes.Repeat([]byte{kCPMEOF}, 119), block[12:131])
+
+	block = encodeXymodemBlock(2, padXymodemData(bytes.Repeat([]byte{'a'}, 129), kCPMEOF), true)
+	assert.Equal(3+1024+2, len(block))
+	assert.Equal([]byte{kSTX, 2, 0xfd}, block[:3])
+
+	block = encodeXymodemBlock(0xff, padXymodemData([]byte{1, 2, 3}, 0), false)
+	assert.Equal(3+128+1, len(block))
+	assert.Equal([]byte{kSOH, 0xff, 0}, block[:3])
+	assert.Equal(byte(6), block[len(block)-1])
+
+	assert.Equal(uint16(0x31c3), crc16Update(0, []byte("123456789")...))
+}
+
+func runXymodemTransfer(t *testing.T, ymodem bool, files []string, dstPath string, corruptPos int) []string {
+	t.Helper()
+	require := require.New(t)
+
+	senderReader, receiverWriter := io.Pipe()
+	receiverReader, senderWriter := io.Pipe()
+	var writer io.Writer = senderWriter
+	if corruptPos > 0 {
+		writer = &corruptWriter{writer: senderWriter, pos: corruptPos}
+	}
+
+	var sendProgress, recvProgress zmodemTestProgress
+	sender := newXymodemSender(senderReader, writer, ymodem, &sendProgress)
+	receiver := newXymodemReceiver(receiverReader, receiverWriter, dstPath, ymodem, "", &recvProgress)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- receiver.run()
+		_ = receiverReader.Close()
+		_ = receiverWriter.Close()
+	}()
+	go func() {
+		errs <- sender.run(files)
+		_ = senderReader.Close()
+		_ = senderWriter.Close()
+	}()
+	for range 2 {
+		select {
+		case err := <-errs:
+			require.Nil(err)
+		case <-time.After(30 * time.Second):
+			require.FailNow("xymodem transfer timeout")
+		}
+	}
+	require.Equal(len(sendProgress.names), sendProgress.done)
+	require.Equal(len(recvProgress.names), recvProgress.done)
+	return receiver.savedName
+}
+
+func TestXymodemTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	var files []string
+	for name, size := range map[string]int{"empty": 0, "one": 1, "block": 1024, "large": 100*1024 + 200} {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(i * 13)
+		}
+		require.Nil(os.WriteFile(filepath.Join(srcPath, name), content, 0644))
+		files = append(files, filepath.Join(srcPath, name))
+	}
+
+	// YMODEM sends the names and the sizes
+	savedNames := runXymodemTransfer(t, true, files, dstPath, 0)
+	require.Equal(len(files), len(savedNames))
+	for i, file := range files {
+		assert.Equal(filepath.Base(file), savedNames[i])
+		assertFileEqual(t, file, filepath.Join(dstPath, savedNames[i]))
+	}
+
+	// XMODEM pads the last block
+	large := filepath.Join(srcPath, "large")
+	savedNames = runXymodemTransfer(t, false, []string{large}, dstPath, 0)
+	assert.Equal([]string{"xmodem.bin"}, savedNames)
+	content, err := os.ReadFile(large)
+	require.Nil(err)
+	received, err := os.ReadFile(filepath.Join(dstPath, "xmodem.bin"))
+	require.Nil(err)
+	assert.Equal(append(content, bytes.Repeat([]byte{kCPMEOF}, 128-200%128)...), received)
+
+	// the corrupted block is sent again
+	savedNames = runXymodemTransfer(t, true, []string{large}, dstPath, 50000)
+	assert.Equal([]string{"large.0"}, savedNames)
+	assertFileEqual(t, large, filepath.Join(dstPath, "large.0"))
+}
+
+func TestXymodemCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	reader, writer := io.Pipe()
+	receiver := newXymodemReceiver(reader, io.Discard, t.TempDir(), true, "", nil)
+	go func() { _, _ = writer.Write([]byte{kCAN, kCAN, kCAN}) }()
+	assert.Equal(errXymodemCanceled, receiver.run())
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	assert.Nil(os.WriteFile(path, []byte("a"), 0644))
+	sender := newXymodemSender(bytes.NewReader([]byte{kCAN, kCAN}), io.Discard, false, nil)
+	assert.Equal(errXymodemCanceled, sender.run([]string{path}))
+	sender = newXymodemSender(bytes.NewReader(nil), io.Discard, false, nil)
+	assert.NotNil(sender.run([]string{path, path}))
+}
+
+func TestXymodemFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	localPath := filepath.Join(testPath, "local")
+	remotePath := filepath.Join(testPath, "remote")
+	require.Nil(os.MkdirAll(localPath, 0755))
+	require.Nil(os.MkdirAll(remotePath, 0755))
+	content := bytes.Repeat([]byte("\x00\x18\x11\x13Cxymodem\r\n"), 1024)
+	require.Nil(os.WriteFile(filepath.Join(localPath, "u-boot.bin"), content, 0644))
+	require.Nil(os.WriteFile(filepath.Join(remotePath, "dump.bin"), content, 0644))
+
+	// run `loady` in U-Boot
+	output := runZmodemFilter(t, localPath, func(reader io.Reader, writer io.Writer) error {
+		_, _ = writer.Write([]byte("## Ready for binary (ymodem) download to 0x82000000 at 115200 bps...\r\n"))
+		return newXymodemReceiver(reader, writer, remotePath, true, "", nil).run()
+	}, []string{filepath.Join(localPath, "u-boot.bin")})
+	assertFileEqual(t, filepath.Join(localPath, "u-boot.bin"), filepath.Join(remotePath, "u-boot.bin"))
+	assert.Contains(output, "u-boot.bin")
+	assert.Contains(output, "Success")
+
+	// run `sx dump.bin` on the server
+	output = runZmodemFilter(t, localPath, func(reader io.Reader, writer io.Writer) error {
+		_, _ = writer.Write([]byte("Sending dump.bin, 96 blocks: Give your local XMODEM receive command now.\r\n"))
+		return newXymodemSender(reader, writer, false, nil).run([]string{filepath.Join(remotePath, "dump.bin")})
+	}, nil)
+	assertFileEqual(t, filepath.Join(remotePath, "dump.bin"), filepath.Join(localPath, "dump.bin"))
+	assert.Contains(output, "dump.bin")
+	assert.Contains(output, "Success")
+}
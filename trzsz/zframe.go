@@ -0,0 +1,384 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	kZPAD   byte = '*'
+	kZBIN   byte = 'A'
+	kZHEX   byte = 'B'
+	kZBIN32 byte = 'C'
+
+	kZCRCE byte = 'h' // end of frame, header packet follows
+	kZCRCG byte = 'i' // frame continues nonstop
+	kZCRCQ byte = 'j' // frame continues, ZACK expected
+	kZCRCW byte = 'k' // end of frame, ZACK expected
+	kZRUB0 byte = 'l' // translate to 0x7f
+	kZRUB1 byte = 'm' // translate to 0xff
+
+	kXON  byte = 0x11
+	kXOFF byte = 0x13
+)
+
+const (
+	kZRQINIT byte = iota
+	kZRINIT
+	kZSINIT
+	kZACK
+	kZFILE
+	kZSKIP
+	kZNAK
+	kZABORT
+	kZFIN
+	kZRPOS
+	kZDATA
+	kZEOF
+	kZFERR
+	kZCRC
+	kZCHALLENGE
+	kZCOMPL
+	kZCAN
+	kZFREECNT
+	kZCOMMAND
+)
+
+// the flags of ZRINIT in ZF0
+const (
+	kCANFDX  byte = 0x01
+	kCANOVIO byte = 0x02
+	kCANFC32 byte = 0x20
+	kESCCTL  byte = 0x40
+)
+
+const kZmodemMaxSubpacket = 64 * 1024
+
+var errZmodemCanceled = simpleTrzszError("Cancelled by the remote")
+var errZmodemBadCRC = simpleTrzszError("Bad zmodem CRC")
+
+// zmodemHeader is the type and the 4 bytes of a frame header.
+// The bytes are ZP0..ZP3 of a position, or ZF3..ZF0 of the flags.
+type zmodemHeader struct {
+	typ  byte
+	data [4]byte
+}
+
+func newPosHeader(typ byte, pos int64) zmodemHeader {
+	h := zmodemHeader{typ: typ}
+	binary.LittleEndian.PutUint32(h.data[:], uint32(pos))
+	return h
+}
+
+func newFlagsHeader(typ byte, zf0 byte) zmodemHeader {
+	return zmodemHeader{typ: typ, data: [4]byte{0, 0, 0, zf0}}
+}
+
+func (h zmodemHeader) pos() int64 {
+	return int64(binary.LittleEndian.Uint32(h.data[:]))
+}
+
+func (h zmodemHeader) zf0() byte {
+	return h.data[3]
+}
+
+func (h zmodemHeader) String() string {
+	return fmt.Sprintf("zmodem header %d [% x]", h.typ, h.data)
+}
+
+func crc16Update(crc uint16, data ...byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// zmodemEscape appends the byte escaped by ZDLE. All the control characters are escaped,
+// so that they pass through the terminals, the ssh and the tmux.
+func zmodemEscape(buf []byte, c byte) []byte {
+	if c&0x60 == 0 {
+		return append(buf, kZDLE, c^0x40)
+	}
+	return append(buf, c)
+}
+
+func encodeHexHeader(h zmodemHeader) []byte {
+	raw := append([]byte{h.typ}, h.data[:]...)
+	crc := crc16Update(0, raw...)
+	buf := append([]byte{kZPAD, kZPAD, kZDLE, kZHEX}, fmt.Sprintf("%02x%02x%02x%02x%02x%04x",
+		raw[0], raw[1], raw[2], raw[3], raw[4], crc)...)
+	buf = append(buf, '\r', '\n'|0x80)
+	if h.typ != kZFIN && h.typ != kZACK {
+		buf = append(buf, kXON)
+	}
+	return buf
+}
+
+func encodeBinHeader(h zmodemHeader, useCRC32 bool) []byte {
+	raw := append([]byte{h.typ}, h.data[:]...)
+	var buf []byte
+	if useCRC32 {
+		buf = []byte{kZPAD, kZDLE, kZBIN32}
+		raw = binary.LittleEndian.AppendUint32(raw, crc32.ChecksumIEEE(raw))
+	} else {
+		buf = []byte{kZPAD, kZDLE, kZBIN}
+		raw = binary.BigEndian.AppendUint16(raw, crc16Update(0, raw...))
+	}
+	for _, c := range raw {
+		buf = zmodemEscape(buf, c)
+	}
+	return buf
+}
+
+func encodeSubpacket(data []byte, end byte, useCRC32 bool) []byte {
+	buf := make([]byte, 0, len(data)+len(data)/8+16)
+	for _, c := range data {
+		buf = zmodemEscape(buf, c)
+	}
+	buf = append(buf, kZDLE, end)
+	var crc []byte
+	if useCRC32 {
+		crc = binary.LittleEndian.AppendUint32(nil, crc32.Update(crc32.ChecksumIEEE(data), crc32.IEEETable, []byte{end}))
+	} else {
+		crc = binary.BigEndian.AppendUint16(nil, crc16Update(crc16Update(0, data...), end))
+	}
+	for _, c := range crc {
+		buf = zmodemEscape(buf, c)
+	}
+	return buf
+}
+
+// isZmodemGarbage returns true if the error is caused by the corrupted data, which can be resent.
+func isZmodemGarbage(err error) bool {
+	if err == errZmodemCanceled {
+		return false
+	}
+	_, ok := err.(*trzszError)
+	return ok
+}
+
+type zmodemReader struct {
+	reader *bufio.Reader
+}
+
+func newZmodemReader(reader io.Reader) *zmodemReader {
+	return &zmodemReader{bufio.NewReaderSize(reader, 32*1024)}
+}
+
+// readRaw reads a byte, skipping the flow control characters.
+func (r *zmodemReader) readRaw() (byte, error) {
+	for {
+		c, err := r.reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case kXON, kXOFF, kXON | 0x80, kXOFF | 0x80:
+			continue
+		}
+		return c, nil
+	}
+}
+
+// readEscaped reads an unescaped byte, or returns the frame end type with end true.
+func (r *zmodemReader) readEscaped() (c byte, end bool, err error) {
+	if c, err = r.readRaw(); err != nil || c != kZDLE {
+		return
+	}
+	for cans := 1; ; cans++ {
+		if c, err = r.readRaw(); err != nil {
+			return
+		}
+		if c != kZDLE {
+			break
+		}
+		if cans >= 4 { // ZDLE is CAN, 5 CANs cancel the session
+			return 0, false, errZmodemCanceled
+		}
+	}
+	switch {
+	case c == kZCRCE || c == kZCRCG || c == kZCRCQ || c == kZCRCW:
+		return c, true, nil
+	case c == kZRUB0:
+		return 0x7f, false, nil
+	case c == kZRUB1:
+		return 0xff, false, nil
+	case c&0x60 == 0x40:
+		return c ^ 0x40, false, nil
+	}
+	return 0, false, simpleTrzszError("Bad zmodem escape: %#x", c)
+}
+
+func (r *zmodemReader) readEscapedBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	for i := range buf {
+		c, end, err := r.readEscaped()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return nil, simpleTrzszError("Unexpected zmodem frame end: %c", c)
+		}
+		buf[i] = c
+	}
+	return buf, nil
+}
+
+// readHeader skips the garbage until a valid header, and returns whether the data uses CRC32.
+func (r *zmodemReader) readHeader() (zmodemHeader, bool, error) {
+	cans := 0
+	for {
+		c, err := r.readRaw()
+		if err != nil {
+			return zmodemHeader{}, false, err
+		}
+		if c == kZDLE {
+			if cans++; cans >= 5 {
+				return zmodemHeader{}, false, errZmodemCanceled
+			}
+			continue
+		}
+		cans = 0
+		if c != kZPAD {
+			continue
+		}
+		for c == kZPAD {
+			if c, err = r.readRaw(); err != nil {
+				return zmodemHeader{}, false, err
+			}
+		}
+		if c != kZDLE {
+			continue
+		}
+		if c, err = r.readRaw(); err != nil {
+			return zmodemHeader{}, false, err
+		}
+		var header zmodemHeader
+		var useCRC32 bool
+		switch c {
+		case kZHEX:
+			header, err = r.readHexHeader()
+		case kZBIN:
+			header, err = r.readBinHeader(false)
+		case kZBIN32:
+			header, err = r.readBinHeader(true)
+			useCRC32 = true
+		default:
+			continue
+		}
+		if err == nil {
+			return header, useCRC32, nil
+		}
+		if !isZmodemGarbage(err) {
+			return zmodemHeader{}, false, err
+		}
+	}
+}
+
+func (r *zmodemReader) readHexHeader() (zmodemHeader, error) {
+	var buf [14]byte
+	for i := range buf {
+		c, err := r.readRaw()
+		if err != nil {
+			return zmodemHeader{}, err
+		}
+		buf[i] = c
+	}
+	var raw [7]byte
+	if _, err := hex.Decode(raw[:], buf[:]); err != nil {
+		return zmodemHeader{}, errZmodemBadCRC
+	}
+	if crc16Update(0, raw[:5]...) != binary.BigEndian.Uint16(raw[5:]) {
+		return zmodemHeader{}, errZmodemBadCRC
+	}
+	// the CR LF is optional, and the XON is skipped as a flow control character
+	for range 2 {
+		if c, err := r.reader.Peek(1); err != nil || c[0]&0x7f != '\r' && c[0]&0x7f != '\n' {
+			break
+		}
+		_, _ = r.reader.ReadByte()
+	}
+	return zmodemHeader{typ: raw[0], data: [4]byte(raw[1:5])}, nil
+}
+
+func (r *zmodemReader) readBinHeader(useCRC32 bool) (zmodemHeader, error) {
+	crcLen := 2
+	if useCRC32 {
+		crcLen = 4
+	}
+	raw, err := r.readEscapedBytes(5 + crcLen)
+	if err != nil {
+		return zmodemHeader{}, err
+	}
+	if useCRC32 && crc32.ChecksumIEEE(raw[:5]) != binary.LittleEndian.Uint32(raw[5:]) ||
+		!useCRC32 && crc16Update(0, raw[:5]...) != binary.BigEndian.Uint16(raw[5:]) {
+		return zmodemHeader{}, errZmodemBadCRC
+	}
+	return zmodemHeader{typ: raw[0], data: [4]byte(raw[1:5])}, nil
+}
+
+// readSubpacket reads a data subpacket, and returns the data and the frame end type.
+func (r *zmodemReader) readSubpacket(useCRC32 bool) ([]byte, byte, error) {
+	var data []byte
+	for {
+		c, end, err := r.readEscaped()
+		if err != nil {
+			return nil, 0, err
+		}
+		if end {
+			crcLen := 2
+			if useCRC32 {
+				crcLen = 4
+			}
+			crc, err := r.readEscapedBytes(crcLen)
+			if err != nil {
+				return nil, 0, err
+			}
+			if useCRC32 && crc32.Update(crc32.ChecksumIEEE(data), crc32.IEEETable, []byte{c}) !=
+				binary.LittleEndian.Uint32(crc) ||
+				!useCRC32 && crc16Update(crc16Update(0, data...), c) != binary.BigEndian.Uint16(crc) {
+				return nil, 0, errZmodemBadCRC
+			}
+			return data, c, nil
+		}
+		if len(data) >= kZmodemMaxSubpacket {
+			return nil, 0, simpleTrzszError("Zmodem subpacket too long")
+		}
+		data = append(data, c)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmodemHexHeader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.Equal("**\x18B00000000000000\r\x8a\x11", string(encodeHexHeader(newPosHeader(kZRQINIT, 0))))
+	assert.Equal("**\x18B0100000023be50\r\x8a\x11", string(encodeHexHeader(newFlagsHeader(kZRINIT, 0x23))))
+	assert.Equal("**\x18B0800000000022d\r\x8a", string(encodeHexHeader(newPosHeader(kZFIN, 0))))
+
+	reader := newZmodemReader(bytes.NewReader([]byte("garbage**\x18B0100000063f694\r\x8a\x11" +
+		"**\x18B0100000063f695\r\x8a\x11" + string(encodeHexHeader(newPosHeader(kZRPOS, 0x12345678))))))
+	header, useCRC32, err := reader.readHeader()
+	require.Nil(err)
+	assert.False(useCRC32)
+	assert.Equal(byte(kZRINIT), header.typ)
+	assert.Equal(kCANFDX|kCANOVIO|kCANFC32|kESCCTL, header.zf0())
+
+	// the header with a bad CRC is skipped
+	header, _, err = reader.readHeader()
+	require.Nil(err)
+	assert.Equal(byte(kZRPOS), header.typ)
+	assert.Equal(int64(0x12345678), header.pos())
+}
+
+func TestZmodemBinHeader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, useCRC32 := range []bool{false, true} {
+		var buf []byte
+		for _, pos := range []int64{0, 0x18, 0x11131891, 0x7fffffff} {
+			buf = append(buf, encodeBinHeader(newPosHeader(kZDATA, pos), useCRC32)...)
+		}
+		for _, c := range buf[3:] {
+			assert.NotEqual(byte(kXON), c)
+			assert.NotEqual(byte(kXOFF), c)
+		}
+		reader := newZmodemReader(bytes.NewReader(buf))
+		for _, pos := range []int64{0, 0x18, 0x11131891, 0x7fffffff} {
+			header, crc32, err := reader.readHeader()
+			require.Nil(err)
+			assert.Equal(useCRC32, crc32)
+			assert.Equal(byte(kZDATA), header.typ)
+			assert.Equal(pos, header.pos())
+		}
+	}
+
+	reader := newZmodemReader(bytes.NewReader([]byte("\x18\x18\x18\x18\x18\x08\x08\x08\x08\x08")))
+	_, _, err := reader.readHeader()
+	assert.Equal(errZmodemCanceled, err)
+}
+
+func TestZmodemSubpacket(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for _, useCRC32 := range []bool{false, true} {
+		buf := encodeSubpacket(data, kZCRCG, useCRC32)
+		buf = append(buf, encodeSubpacket(nil, kZCRCE, useCRC32)...)
+		for _, c := range buf {
+			assert.True(c&0x60 != 0 || c == kZDLE)
+		}
+
+		reader := newZmodemReader(bytes.NewReader(buf))
+		recv, end, err := reader.readSubpacket(useCRC32)
+		require.Nil(err)
+		assert.Equal(data, recv)
+		assert.Equal(byte(kZCRCG), end)
+		recv, end, err = reader.readSubpacket(useCRC32)
+		require.Nil(err)
+		assert.Empty(recv)
+		assert.Equal(byte(kZCRCE), end)
+
+		// flow control characters are skipped
+		buf = encodeSubpacket([]byte("hello"), kZCRCW, useCRC32)
+		buf = append(append(append([]byte{}, buf[:2]...), kXON, kXOFF), buf[2:]...)
+		recv, end, err = newZmodemReader(bytes.NewReader(buf)).readSubpacket(useCRC32)
+		require.Nil(err)
+		assert.Equal("hello", string(recv))
+		assert.Equal(byte(kZCRCW), end)
+
+		// corrupted data
+		buf = encodeSubpacket([]byte("hello world"), kZCRCG, useCRC32)
+		buf[3] ^= 0x01
+		_, _, err = newZmodemReader(bytes.NewReader(buf)).readSubpacket(useCRC32)
+		assert.Equal(errZmodemBadCRC, err)
+		assert.True(isZmodemGarbage(err))
+	}
+
+	assert.False(isZmodemGarbage(errZmodemCanceled))
+}
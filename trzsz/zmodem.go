@@ -31,6 +31,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -38,12 +39,23 @@ import (
 // zmodem escape leader char
 const kZDLE byte = 030
 
+// zmodemClient is the local `rz` / `sz`, a lrzsz process or the native one.
+type zmodemClient struct {
+	wait   func() error
+	kill   func()
+	native bool
+}
+
 type zmodemTransfer struct {
 	upload          bool
+	native          bool
+	protocol        string // XMODEM or YMODEM, empty for ZMODEM
+	fileName        string // the name of the file sent by XMODEM, if the server shows it
+	progress        *multiProgress
 	logger          *traceLogger
 	serverIn        io.Writer
 	clientOut       io.Writer
-	cmd             atomic.Pointer[exec.Cmd]
+	client          atomic.Pointer[zmodemClient]
 	stdin           io.WriteCloser
 	stdout          io.ReadCloser
 	clientFinished  atomic.Bool
@@ -52,6 +64,8 @@ type zmodemTransfer struct {
 	stopped         atomic.Bool
 	cleaned         atomic.Bool
 	cleanupTimer    *time.Timer
+	cleanupMutex    sync.Mutex
+	timerMutex      sync.Mutex
 	clientTimer     *time.Timer
 	serverTimer     *time.Timer
 	lastUpdateTime  *time.Time
@@ -85,6 +99,12 @@ func (z *zmodemTransfer) writeMessage(msg string) {
 }
 
 func (z *zmodemTransfer) updateProgress(buf []byte) {
+	if z.native { // the native client shows the progress of each file
+		if buf == nil {
+			_ = writeAll(z.clientOut, []byte("\r\n"))
+		}
+		return
+	}
 	if buf == nil {
 		now := timeNowFunc()
 		z.showProgress(&now)
@@ -124,6 +144,8 @@ func (z *zmodemTransfer) getSpeed(now *time.Time) string {
 }
 
 func (z *zmodemTransfer) resetCleanupTimer() {
+	z.cleanupMutex.Lock()
+	defer z.cleanupMutex.Unlock()
 	if z.cleanupTimer != nil {
 		z.cleanupTimer.Stop()
 	}
@@ -141,6 +163,8 @@ func (z *zmodemTransfer) resetClientTimer() {
 	if !z.upload {
 		return
 	}
+	z.timerMutex.Lock()
+	defer z.timerMutex.Unlock()
 	if z.clientTimer != nil {
 		z.clientTimer.Stop()
 	}
@@ -153,6 +177,8 @@ func (z *zmodemTransfer) resetServerTimer() {
 	if z.upload {
 		return
 	}
+	z.timerMutex.Lock()
+	defer z.timerMutex.Unlock()
 	if z.serverTimer != nil {
 		z.serverTimer.Stop()
 	}
@@ -182,9 +208,9 @@ func (z *zmodemTransfer) handleZmodemError(msg string) {
 
 	_ = writeAll(z.serverIn, zmodemCancelFullSequence)
 
-	if cmd := z.cmd.Load(); cmd != nil {
+	if client := z.client.Load(); client != nil {
+		z.ensureClientExit(client) // the native client may not be reading
 		_ = writeAll(z.stdin, zmodemCancelFullSequence)
-		z.ensureClientExit(cmd)
 	}
 
 	z.writeMessage(msg)
@@ -200,9 +226,9 @@ func (z *zmodemTransfer) handleServerOutput(buf []byte) bool {
 	}
 
 	// forward server output to the client
-	if cmd := z.cmd.Load(); cmd != nil {
+	if z.client.Load() != nil {
 		z.resetServerTimer()
-		if len(buf) < 50 && zmodemFinishRegexp.Match(buf) {
+		if z.protocol == "" && len(buf) < 50 && zmodemFinishRegexp.Match(buf) {
 			if z.serverFinished.CompareAndSwap(false, true) {
 				z.ensureOverAndOut()
 			}
@@ -225,16 +251,18 @@ func (z *zmodemTransfer) handleServerOutput(buf []byte) bool {
 	return true
 }
 
-func (z *zmodemTransfer) handleZmodemStream(cmd *exec.Cmd) {
+func (z *zmodemTransfer) handleZmodemStream(client *zmodemClient) {
 	if z.logger != nil {
 		z.logger.writeTraceLog([]byte("zmodem begin"), "debug")
 	}
-	z.cmd.Store(cmd)
+	z.client.Store(client)
 	z.resetClientTimer()
 	z.resetServerTimer()
 
-	// async check if the client has exited
-	go z.checkClientExited(cmd)
+	// async check if the lrzsz client has exited
+	if !client.native {
+		go z.checkClientExited(client)
+	}
 
 	// forward client output to the server
 	buffer := make([]byte, 32*1024)
@@ -252,7 +280,7 @@ func (z *zmodemTransfer) handleZmodemStream(cmd *exec.Cmd) {
 				}
 				break
 			}
-			if len(buf) < 50 && zmodemFinishRegexp.Match(buf) {
+			if z.protocol == "" && len(buf) < 50 && zmodemFinishRegexp.Match(buf) {
 				if z.clientFinished.CompareAndSwap(false, true) {
 					z.ensureOverAndOut()
 				}
@@ -274,11 +302,18 @@ func (z *zmodemTransfer) handleZmodemStream(cmd *exec.Cmd) {
 		}
 	}
 
+	z.timerMutex.Lock()
 	if z.clientTimer != nil {
 		z.clientTimer.Stop()
 	}
+	z.timerMutex.Unlock()
 
-	z.ensureClientExit(cmd)
+	z.ensureClientExit(client)
+
+	// check if the native client has exited after all its output is forwarded
+	if client.native {
+		z.checkClientExited(client)
+	}
 }
 
 func (z *zmodemTransfer) ensureOverAndOut() {
@@ -295,20 +330,22 @@ func (z *zmodemTransfer) ensureOverAndOut() {
 	}
 }
 
-func (z *zmodemTransfer) ensureClientExit(cmd *exec.Cmd) {
+func (z *zmodemTransfer) ensureClientExit(client *zmodemClient) {
 	go func() {
 		time.Sleep(500 * time.Millisecond)
-		_ = cmd.Process.Kill()
+		client.kill()
 	}()
 }
 
-func (z *zmodemTransfer) checkClientExited(cmd *exec.Cmd) {
-	_ = cmd.Wait()
+func (z *zmodemTransfer) checkClientExited(client *zmodemClient) {
+	err := client.wait()
 	z.stopped.Store(true)
 
+	z.timerMutex.Lock()
 	if z.serverTimer != nil {
 		z.serverTimer.Stop()
 	}
+	z.timerMutex.Unlock()
 
 	z.updateProgress(nil) // nil means finished
 
@@ -316,19 +353,27 @@ func (z *zmodemTransfer) checkClientExited(cmd *exec.Cmd) {
 		z.logger.writeTraceLog([]byte("zmodem end"), "debug")
 	}
 
-	if code := cmd.ProcessState.ExitCode(); code != 0 {
-		z.writeMessage(fmt.Sprintf("client exit with %d", code))
+	if z.progress != nil {
+		z.progress.finish()
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		z.writeMessage(fmt.Sprintf("client exit with %d", exitErr.ExitCode()))
+	} else if err != nil {
+		z.writeMessage(err.Error())
 	} else {
 		z.writeMessage("\033[1;32mSuccess!!\033[0m")
 	}
 
 	z.resetCleanupTimer()
 
-	// make sure the server exit
-	_ = writeAll(z.serverIn, zmodemCancelFullSequence)
+	// make sure the server exit, the XMODEM and YMODEM have no handshake to finish
+	if z.protocol == "" || err != nil {
+		_ = writeAll(z.serverIn, zmodemCancelFullSequence)
+	}
 }
 
-func (z *zmodemTransfer) launchZmodemCmd(dir, name string, args ...string) (*exec.Cmd, error) {
+func (z *zmodemTransfer) launchZmodemCmd(dir, name string, args ...string) (*zmodemClient, error) {
 	var err error
 	cmd := exec.Command(name, args...)
 	cmd.Dir = dir
@@ -343,10 +388,48 @@ func (z *zmodemTransfer) launchZmodemCmd(dir, name string, args ...string) (*exe
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	return cmd, nil
+	return &zmodemClient{wait: cmd.Wait, kill: func() { _ = cmd.Process.Kill() }}, nil
+}
+
+// launchNativeClient runs the native `rz` / `sz` in a goroutine, which reads and writes the zmodem stream by pipes.
+func (z *zmodemTransfer) launchNativeClient(run func(reader io.Reader, writer io.Writer) error) *zmodemClient {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	z.stdin, z.stdout = inWriter, outReader
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = run(inReader, outWriter)
+		_ = inReader.CloseWithError(io.ErrClosedPipe)
+		_ = outWriter.Close()
+	}()
+	return &zmodemClient{
+		wait: func() error {
+			<-done
+			return err
+		},
+		kill: func() {
+			_ = inReader.CloseWithError(io.ErrClosedPipe)
+			_ = outWriter.CloseWithError(io.ErrClosedPipe)
+		},
+		native: true,
+	}
 }
 
 func (z *zmodemTransfer) uploadFiles(files []string) {
+	if z.protocol != "" {
+		z.handleZmodemStream(z.launchNativeClient(func(reader io.Reader, writer io.Writer) error {
+			return newXymodemSender(reader, writer, z.protocol == kYmodem, z.getProgress()).run(files)
+		}))
+		return
+	}
+	if z.native {
+		z.handleZmodemStream(z.launchNativeClient(func(reader io.Reader, writer io.Writer) error {
+			return newZmodemSender(reader, writer, z.getProgress()).run(files)
+		}))
+		return
+	}
 	workDir := ""
 	for i := range files {
 		fileDir := filepath.Dir(files[i])
@@ -357,21 +440,40 @@ func (z *zmodemTransfer) uploadFiles(files []string) {
 			files[i] = filepath.Base(files[i])
 		}
 	}
-	cmd, err := z.launchZmodemCmd(workDir, "sz", append([]string{"-e", "-b", "-B", "32768"}, files...)...)
+	client, err := z.launchZmodemCmd(workDir, "sz", append([]string{"-e", "-b", "-B", "32768"}, files...)...)
 	if err != nil {
 		z.handleZmodemError(fmt.Sprintf("run sz client failed: %v", err))
 		return
 	}
-	z.handleZmodemStream(cmd)
+	z.handleZmodemStream(client)
 }
 
 func (z *zmodemTransfer) downloadFiles(path string) {
-	cmd, err := z.launchZmodemCmd(path, "rz", "-E", "-e", "-b", "-B", "32768")
+	if z.protocol != "" {
+		z.handleZmodemStream(z.launchNativeClient(func(reader io.Reader, writer io.Writer) error {
+			return newXymodemReceiver(reader, writer, path, z.protocol == kYmodem, z.fileName, z.getProgress()).run()
+		}))
+		return
+	}
+	if z.native {
+		z.handleZmodemStream(z.launchNativeClient(func(reader io.Reader, writer io.Writer) error {
+			return newZmodemReceiver(reader, writer, path, z.getProgress()).run()
+		}))
+		return
+	}
+	client, err := z.launchZmodemCmd(path, "rz", "-E", "-e", "-b", "-B", "32768")
 	if err != nil {
 		z.handleZmodemError(fmt.Sprintf("run rz client failed: %v", err))
 		return
 	}
-	z.handleZmodemStream(cmd)
+	z.handleZmodemStream(client)
+}
+
+func (z *zmodemTransfer) getProgress() progressCallback {
+	if z.progress == nil {
+		return nil
+	}
+	return z.progress
 }
 
 func (z *zmodemTransfer) handleZmodemEvent(logger *traceLogger, serverIn io.Writer, clientOut io.Writer,
@@ -25,7 +25,14 @@ SOFTWARE.
 package trzsz
 
 import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -68,3 +75,96 @@ func TestDetectZmodem(t *testing.T) {
 	assertDetectZmodem("**\x18B0100000023be50"+string(zmodemCancelFullSequence), nil)
 	assertDetectZmodem("**\x18B0100000063f694\x0d\x8a\x11"+string(zmodemCancelFullSequence), nil)
 }
+
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(buf []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(buf)
+}
+
+func (b *lockedBuffer) Close() error {
+	return nil
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// runZmodemFilter runs `sz` or `rz` on the server, and waits for the filter to finish.
+func runZmodemFilter(t *testing.T, localPath string, server func(reader io.Reader, writer io.Writer) error,
+	dragFiles []string) string {
+	t.Helper()
+	require := require.New(t)
+	serverInReader, serverInWriter := io.Pipe()
+	serverOutReader, serverOutWriter := io.Pipe()
+	clientInReader, clientInWriter := io.Pipe()
+	clientOut := &lockedBuffer{}
+	filter := NewTrzszFilter(clientInReader, clientOut, serverInWriter, serverOutReader,
+		TrzszOptions{TerminalColumns: 100, EnableZmodem: true})
+	filter.SetDefaultDownloadPath(localPath)
+	if dragFiles != nil {
+		filter.dragFiles.Store(&dragFiles)
+	}
+	defer func() {
+		filter.Close()
+		_ = clientInWriter.Close()
+		_ = serverOutWriter.Close()
+		_ = serverInReader.Close()
+	}()
+
+	require.Nil(server(serverInReader, serverOutWriter))
+	go func() { _, _ = io.Copy(io.Discard, serverInReader) }()
+	for range 100 {
+		if strings.Contains(clientOut.String(), "Success") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for range 20 {
+		// the output of the shell after a while to let the filter finish the zmodem
+		time.Sleep(600 * time.Millisecond)
+		_, _ = serverOutWriter.Write([]byte("\r\n$ "))
+		if filter.zmodem.Load() == nil {
+			return clientOut.String()
+		}
+	}
+	require.FailNow("zmodem timeout", clientOut.String())
+	return ""
+}
+
+func TestNativeZmodem(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	localPath := filepath.Join(testPath, "local")
+	remotePath := filepath.Join(testPath, "remote")
+	require.Nil(os.MkdirAll(localPath, 0755))
+	require.Nil(os.MkdirAll(remotePath, 0755))
+	content := bytes.Repeat([]byte("\x00\x18\x11\x13*zmodem\r\n"), 10000)
+	require.Nil(os.WriteFile(filepath.Join(remotePath, "download.bin"), content, 0644))
+	require.Nil(os.WriteFile(filepath.Join(localPath, "upload.bin"), content, 0644))
+
+	output := runZmodemFilter(t, localPath, func(reader io.Reader, writer io.Writer) error {
+		return newZmodemSender(reader, writer, nil).run([]string{filepath.Join(remotePath, "download.bin")})
+	}, nil)
+	assertFileEqual(t, filepath.Join(remotePath, "download.bin"), filepath.Join(localPath, "download.bin"))
+	assert.Contains(output, "download.bin")
+	assert.Contains(output, "Success")
+
+	output = runZmodemFilter(t, localPath, func(reader io.Reader, writer io.Writer) error {
+		return newZmodemReceiver(reader, writer, remotePath, nil).run()
+	}, []string{filepath.Join(localPath, "upload.bin")})
+	assertFileEqual(t, filepath.Join(localPath, "upload.bin"), filepath.Join(remotePath, "upload.bin"))
+	assert.Contains(output, "upload.bin")
+	assert.Contains(output, "Success")
+}
@@ -0,0 +1,626 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kZmodemChunkSize  = 8 * 1024
+	kZmodemMaxRetries = 10
+	kZmodemTimeout    = 10 * time.Second
+)
+
+// the conversion options of ZFILE in ZF0
+const (
+	kZCBIN   byte = 1 // binary transfer
+	kZCRESUM byte = 3 // resume an interrupted transfer, e.g. `sz -r`
+)
+
+var errZmodemTimeout = simpleTrzszError("Zmodem timeout")
+
+type zmodemFileInfo struct {
+	name       string
+	size       int64 // -1 if unknown
+	modTime    int64
+	mode       os.FileMode
+	filesLeft  int64
+	bytesLeft  int64
+	hasPending bool
+}
+
+// parseZmodemFileInfo parses `name\0size mtime mode serial files_left bytes_left\0`,
+// all the fields after the name are optional, the mtime and the mode are octal.
+func parseZmodemFileInfo(data []byte) (*zmodemFileInfo, error) {
+	name, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(name) == 0 {
+		return nil, simpleTrzszError("Invalid zmodem file info: %q", data)
+	}
+	info := &zmodemFileInfo{name: string(name), size: -1}
+	rest, _, _ = bytes.Cut(rest, []byte{0})
+	fields := strings.Fields(string(rest))
+	parse := func(idx, base int) (int64, bool) {
+		if idx >= len(fields) {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(fields[idx], base, 64)
+		return v, err == nil
+	}
+	if v, ok := parse(0, 10); ok {
+		info.size = v
+	}
+	if v, ok := parse(1, 8); ok {
+		info.modTime = v
+	}
+	if v, ok := parse(2, 8); ok {
+		info.mode = os.FileMode(v).Perm()
+	}
+	if v, ok := parse(4, 10); ok && v > 0 {
+		info.filesLeft = v
+		info.hasPending = true
+	}
+	if v, ok := parse(5, 10); ok && v > 0 {
+		info.bytesLeft = v
+	}
+	return info, nil
+}
+
+// getZmodemFileName keeps the base name only, the sender can't choose where to save the file.
+func getZmodemFileName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	if name == "/" || name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// zmodemReceiver receives files from the remote `sz`, as the local `rz` does.
+type zmodemReceiver struct {
+	reader    *zmodemReader
+	writer    io.Writer
+	path      string
+	progress  progressCallback
+	numShown  bool
+	savedName []string
+}
+
+func newZmodemReceiver(reader io.Reader, writer io.Writer, path string, progress progressCallback) *zmodemReceiver {
+	return &zmodemReceiver{reader: newZmodemReader(reader), writer: writer, path: path, progress: progress}
+}
+
+func (r *zmodemReceiver) sendHeader(header zmodemHeader) error {
+	return writeAll(r.writer, encodeHexHeader(header))
+}
+
+func (r *zmodemReceiver) sendZRINIT() error {
+	return r.sendHeader(newFlagsHeader(kZRINIT, kCANFDX|kCANOVIO|kCANFC32|kESCCTL))
+}
+
+func (r *zmodemReceiver) run() error {
+	if err := r.sendZRINIT(); err != nil {
+		return err
+	}
+	for {
+		header, useCRC32, err := r.reader.readHeader()
+		if err != nil {
+			return err
+		}
+		switch header.typ {
+		case kZRQINIT, kZEOF:
+			err = r.sendZRINIT()
+		case kZSINIT:
+			if _, _, err = r.reader.readSubpacket(useCRC32); err == nil {
+				err = r.sendHeader(newPosHeader(kZACK, 0))
+			} else if isZmodemGarbage(err) {
+				err = r.sendHeader(newPosHeader(kZNAK, 0))
+			}
+		case kZFILE:
+			var data []byte
+			if data, _, err = r.reader.readSubpacket(useCRC32); err == nil {
+				err = r.recvFile(data, header.zf0())
+			} else if isZmodemGarbage(err) {
+				err = r.sendHeader(newPosHeader(kZNAK, 0))
+			}
+		case kZFIN:
+			return r.sendHeader(newPosHeader(kZFIN, 0))
+		case kZCAN, kZABORT:
+			return errZmodemCanceled
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *zmodemReceiver) recvFile(data []byte, zf0 byte) error {
+	info, err := parseZmodemFileInfo(data)
+	if err != nil {
+		return err
+	}
+	name := getZmodemFileName(info.name)
+	if name == "" {
+		return r.sendHeader(newPosHeader(kZSKIP, 0))
+	}
+	if r.progress != nil && !r.numShown && info.hasPending {
+		r.numShown = true
+		r.progress.onNum(info.filesLeft)
+		if info.bytesLeft > 0 {
+			r.progress.onTotal(info.bytesLeft)
+		}
+	}
+
+	// resume from the partial file left by an interrupted transfer, only if the sender asks for it
+	partPath := getPartialFilePath(filepath.Join(r.path, name))
+	var offset int64
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if stat, err := os.Stat(partPath); zf0 == kZCRESUM && err == nil && stat.Mode().IsRegular() &&
+		info.size >= 0 && stat.Size() <= info.size {
+		offset = stat.Size()
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return simpleTrzszError("Open [%s] error: %v", partPath, err)
+	}
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+
+	if r.progress != nil {
+		r.progress.onName(name)
+		r.progress.setPreSize(offset)
+		if info.size >= 0 {
+			r.progress.onSize(info.size - offset)
+		} else {
+			r.progress.onSize(-1)
+		}
+	}
+
+	pos := offset
+	if err := r.sendHeader(newPosHeader(kZRPOS, pos)); err != nil {
+		return err
+	}
+	for {
+		header, useCRC32, err := r.reader.readHeader()
+		if err != nil {
+			return err
+		}
+		switch header.typ {
+		case kZDATA:
+			if header.pos() != pos {
+				err = r.sendHeader(newPosHeader(kZRPOS, pos))
+				break
+			}
+			pos, err = r.recvData(file, pos, offset, useCRC32)
+		case kZEOF:
+			if header.pos() != pos { // some data is lost
+				err = r.sendHeader(newPosHeader(kZRPOS, pos))
+				break
+			}
+			err = file.Close()
+			file = nil
+			if err != nil {
+				return simpleTrzszError("Close [%s] error: %v", partPath, err)
+			}
+			if err := r.saveFile(partPath, name, info); err != nil {
+				return err
+			}
+			return r.sendZRINIT()
+		case kZFILE: // the ZRPOS is lost
+			if _, _, err = r.reader.readSubpacket(useCRC32); err == nil || isZmodemGarbage(err) {
+				err = r.sendHeader(newPosHeader(kZRPOS, pos))
+			}
+		case kZNAK:
+			err = r.sendHeader(newPosHeader(kZRPOS, pos))
+		case kZFIN:
+			return simpleTrzszError("Zmodem finished before the end of %s", name)
+		case kZCAN, kZABORT:
+			return errZmodemCanceled
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recvData writes the subpackets after ZDATA, and asks to resend from the position if any is corrupted.
+func (r *zmodemReceiver) recvData(file *os.File, pos, offset int64, useCRC32 bool) (int64, error) {
+	for {
+		data, end, err := r.reader.readSubpacket(useCRC32)
+		if err != nil {
+			if isZmodemGarbage(err) {
+				return pos, r.sendHeader(newPosHeader(kZRPOS, pos))
+			}
+			return pos, err
+		}
+		if err := writeAll(file, data); err != nil {
+			return pos, simpleTrzszError("Write [%s] error: %v", file.Name(), err)
+		}
+		pos += int64(len(data))
+		if r.progress != nil {
+			r.progress.onStep(pos - offset)
+		}
+		if end == kZCRCW || end == kZCRCQ {
+			if err := r.sendHeader(newPosHeader(kZACK, pos)); err != nil {
+				return pos, err
+			}
+		}
+		if end == kZCRCW || end == kZCRCE {
+			return pos, nil
+		}
+	}
+}
+
+func (r *zmodemReceiver) saveFile(partPath, name string, info *zmodemFileInfo) error {
+	newName, err := saveZmodemFile(r.path, partPath, name, info)
+	if err != nil {
+		return err
+	}
+	r.savedName = append(r.savedName, newName)
+	if r.progress != nil {
+		r.progress.onDone()
+	}
+	return nil
+}
+
+// saveZmodemFile renames the partial file to a new name if the file exists, as `rz -E` does.
+func saveZmodemFile(path, partPath, name string, info *zmodemFileInfo) (string, error) {
+	newName, err := getNewName(path, name)
+	if err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(path, newName)
+	if err := os.Rename(partPath, fullPath); err != nil {
+		return "", simpleTrzszError("Rename [%s] to [%s] failed: %v", partPath, fullPath, err)
+	}
+	if info.mode != 0 {
+		_ = os.Chmod(fullPath, info.mode)
+	}
+	if info.modTime > 0 {
+		modTime := time.Unix(info.modTime, 0)
+		_ = os.Chtimes(fullPath, modTime, modTime)
+	}
+	return newName, nil
+}
+
+type zmodemEvent struct {
+	header zmodemHeader
+	err    error
+}
+
+// zmodemSender sends files to the remote `rz`, as the local `sz` does.
+type zmodemSender struct {
+	reader   *zmodemReader
+	writer   io.Writer
+	progress progressCallback
+	events   chan zmodemEvent
+	done     chan struct{}
+	useCRC32 bool
+	bufSize  int64
+	resume   bool // ask the receiver to resume from its partial file
+}
+
+func newZmodemSender(reader io.Reader, writer io.Writer, progress progressCallback) *zmodemSender {
+	return &zmodemSender{reader: newZmodemReader(reader), writer: writer, progress: progress,
+		events: make(chan zmodemEvent, 16), done: make(chan struct{})}
+}
+
+// readHeaders reads the headers from the receiver in the background, so that a ZRPOS
+// can interrupt the data which is being sent.
+func (s *zmodemSender) readHeaders() {
+	for {
+		header, _, err := s.reader.readHeader()
+		for {
+			select {
+			case s.events <- zmodemEvent{header, err}:
+			case <-s.done:
+				return
+			}
+			if err == nil {
+				break
+			}
+		}
+	}
+}
+
+func (s *zmodemSender) waitHeader(timeout time.Duration) (zmodemHeader, error) {
+	select {
+	case event := <-s.events:
+		if event.err == nil && (event.header.typ == kZCAN || event.header.typ == kZABORT) {
+			return event.header, errZmodemCanceled
+		}
+		return event.header, event.err
+	case <-time.After(timeout):
+		return zmodemHeader{}, errZmodemTimeout
+	}
+}
+
+// waitFor skips the other headers, such as a repeated ZRINIT, until one of the types.
+func (s *zmodemSender) waitFor(types ...byte) (zmodemHeader, error) {
+	for {
+		header, err := s.waitHeader(kZmodemTimeout)
+		if err != nil || slices.Contains(types, header.typ) {
+			return header, err
+		}
+	}
+}
+
+func (s *zmodemSender) pollHeader() (*zmodemHeader, error) {
+	select {
+	case event := <-s.events:
+		if event.err == nil && (event.header.typ == kZCAN || event.header.typ == kZABORT) {
+			return nil, errZmodemCanceled
+		}
+		return &event.header, event.err
+	default:
+		return nil, nil
+	}
+}
+
+func (s *zmodemSender) run(files []string) error {
+	go s.readHeaders()
+	defer close(s.done)
+
+	if err := s.init(); err != nil {
+		return err
+	}
+
+	var bytesLeft int64
+	for _, path := range files {
+		if stat, err := os.Stat(path); err == nil {
+			bytesLeft += stat.Size()
+		}
+	}
+	if s.progress != nil {
+		s.progress.onNum(int64(len(files)))
+		s.progress.onTotal(bytesLeft)
+	}
+	for i, path := range files {
+		size, err := s.sendFile(path, int64(len(files)-i), bytesLeft)
+		if err != nil {
+			return err
+		}
+		bytesLeft -= size
+	}
+
+	return s.finish()
+}
+
+// init asks the receiver to send ZRINIT again, the first one has been consumed while detecting.
+func (s *zmodemSender) init() error {
+	for range kZmodemMaxRetries {
+		if err := writeAll(s.writer, encodeHexHeader(newPosHeader(kZRQINIT, 0))); err != nil {
+			return err
+		}
+		header, err := s.waitFor(kZRINIT)
+		if err == errZmodemTimeout {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.useCRC32 = header.zf0()&kCANFC32 != 0
+		s.bufSize = int64(header.data[0]) | int64(header.data[1])<<8
+		return nil
+	}
+	return errZmodemTimeout
+}
+
+func (s *zmodemSender) finish() error {
+	for range kZmodemMaxRetries {
+		if err := writeAll(s.writer, encodeHexHeader(newPosHeader(kZFIN, 0))); err != nil {
+			return err
+		}
+		if _, err := s.waitFor(kZFIN); err == errZmodemTimeout {
+			continue
+		} else if err != nil {
+			return err
+		}
+		_ = writeAll(s.writer, zmodemOverAndOut) // the receiver may have exited
+		return nil
+	}
+	return errZmodemTimeout
+}
+
+// sendFile returns the size of the file, even if it is skipped by the receiver.
+func (s *zmodemSender) sendFile(path string, filesLeft, bytesLeft int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, simpleTrzszError("Open [%s] error: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, simpleTrzszError("Stat [%s] error: %v", path, err)
+	}
+	name := filepath.Base(path)
+	info := fmt.Appendf(nil, "%s\x00%d %o %o 0 %d %d\x00", name, stat.Size(), stat.ModTime().Unix(),
+		0100000|stat.Mode().Perm(), filesLeft, bytesLeft)
+	conversion := kZCBIN
+	if s.resume {
+		conversion = kZCRESUM
+	}
+	frame := append(encodeBinHeader(newFlagsHeader(kZFILE, conversion), s.useCRC32),
+		encodeSubpacket(info, kZCRCW, s.useCRC32)...)
+
+	var offset int64
+	for retries := 0; ; {
+		if err := writeAll(s.writer, frame); err != nil {
+			return 0, err
+		}
+		header, err := s.waitFor(kZSKIP, kZRPOS)
+		if err == errZmodemTimeout {
+			if retries++; retries >= kZmodemMaxRetries {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if header.typ == kZSKIP {
+			return stat.Size(), nil
+		}
+		offset = header.pos()
+		break
+	}
+
+	if s.progress != nil {
+		s.progress.onName(name)
+		s.progress.setPreSize(offset)
+		s.progress.onSize(stat.Size() - offset)
+	}
+	if err := s.sendData(file, offset); err != nil {
+		return 0, err
+	}
+	if s.progress != nil {
+		s.progress.onDone()
+	}
+	return stat.Size(), nil
+}
+
+// sendData sends the data from the offset, and starts again from the position of a ZRPOS.
+func (s *zmodemSender) sendData(file *os.File, offset int64) error {
+	start := offset
+	buffer := make([]byte, kZmodemChunkSize)
+	for retries := 0; retries < kZmodemMaxRetries; retries++ {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return simpleTrzszError("Seek [%s] error: %v", file.Name(), err)
+		}
+		if err := writeAll(s.writer, encodeBinHeader(newPosHeader(kZDATA, offset), s.useCRC32)); err != nil {
+			return err
+		}
+		var unacked int64
+		resent := false
+		for !resent {
+			header, err := s.pollHeader()
+			if err != nil {
+				return err
+			}
+			if header != nil && header.typ == kZSKIP {
+				return nil
+			}
+			if header != nil && header.typ == kZRPOS {
+				offset, resent = header.pos(), true
+				break
+			}
+
+			n, err := io.ReadFull(file, buffer)
+			eof := err == io.EOF || err == io.ErrUnexpectedEOF
+			if err != nil && !eof {
+				return simpleTrzszError("Read [%s] error: %v", file.Name(), err)
+			}
+			end := kZCRCG
+			if eof {
+				end = kZCRCE
+			} else if s.bufSize > 0 && unacked+int64(n) >= s.bufSize {
+				end = kZCRCW
+			}
+			if err := writeAll(s.writer, encodeSubpacket(buffer[:n], end, s.useCRC32)); err != nil {
+				return err
+			}
+			offset += int64(n)
+			unacked += int64(n)
+			if s.progress != nil {
+				s.progress.onStep(offset - start)
+			}
+
+			if end == kZCRCW {
+				if offset, resent, err = s.waitAck(offset); err != nil {
+					return err
+				}
+				if !resent {
+					unacked = 0
+					if err := writeAll(s.writer, encodeBinHeader(newPosHeader(kZDATA, offset), s.useCRC32)); err != nil {
+						return err
+					}
+				}
+			}
+			if eof && !resent {
+				pos, done, err := s.sendEOF(offset)
+				if err != nil || done {
+					return err
+				}
+				offset, resent = pos, true
+			}
+		}
+	}
+	return errZmodemTimeout
+}
+
+// waitAck waits for the ZACK of a ZCRCW subpacket, or returns the position to send again.
+func (s *zmodemSender) waitAck(offset int64) (int64, bool, error) {
+	for {
+		header, err := s.waitHeader(kZmodemTimeout)
+		if err == errZmodemTimeout {
+			return offset, true, nil
+		}
+		if err != nil {
+			return offset, false, err
+		}
+		switch header.typ {
+		case kZACK:
+			return offset, false, nil
+		case kZRPOS:
+			return header.pos(), true, nil
+		}
+	}
+}
+
+// sendEOF returns true if the receiver has saved the file, or the position to send again.
+func (s *zmodemSender) sendEOF(offset int64) (int64, bool, error) {
+	for range kZmodemMaxRetries {
+		if err := writeAll(s.writer, encodeBinHeader(newPosHeader(kZEOF, offset), s.useCRC32)); err != nil {
+			return 0, false, err
+		}
+		for {
+			header, err := s.waitHeader(kZmodemTimeout)
+			if err == errZmodemTimeout {
+				break
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			switch header.typ {
+			case kZRINIT, kZSKIP:
+				return offset, true, nil
+			case kZRPOS:
+				return header.pos(), false, nil
+			}
+		}
+	}
+	return 0, false, errZmodemTimeout
+}
@@ -0,0 +1,250 @@
+/*
+MIT License
+
+Copyright (c) 2022-2026 The Trzsz Authors.
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package trzsz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type zmodemTestProgress struct {
+	mutex   sync.Mutex
+	num     int64
+	total   int64
+	names   []string
+	sizes   []int64
+	step    int64
+	preSize int64
+	done    int
+}
+
+func (p *zmodemTestProgress) onNum(num int64)           { p.num = num }
+func (p *zmodemTestProgress) onTotal(total int64)       { p.total = total }
+func (p *zmodemTestProgress) onName(name string)        { p.names = append(p.names, name) }
+func (p *zmodemTestProgress) onSize(size int64)         { p.sizes = append(p.sizes, size) }
+func (p *zmodemTestProgress) onStep(step int64)         { p.step = step }
+func (p *zmodemTestProgress) onDone()                   { p.done++ }
+func (p *zmodemTestProgress) onSkip(size int64)         {}
+func (p *zmodemTestProgress) setPause(pausing bool)     {}
+func (p *zmodemTestProgress) setRetry(retry, limit int) {}
+func (p *zmodemTestProgress) setPreSize(size int64)     { p.preSize = size }
+
+// corruptWriter flips a bit of the byte at the position once.
+type corruptWriter struct {
+	writer  io.Writer
+	written int
+	pos     int
+}
+
+func (w *corruptWriter) Write(buf []byte) (int, error) {
+	if w.pos >= w.written && w.pos < w.written+len(buf) {
+		buf = bytes.Clone(buf)
+		buf[w.pos-w.written] ^= 0x01
+	}
+	w.written += len(buf)
+	return w.writer.Write(buf)
+}
+
+func runZmodemTransfer(t *testing.T, files []string, dstPath string, corruptPos int,
+	resume bool) (*zmodemTestProgress, *zmodemTestProgress) {
+	t.Helper()
+	require := require.New(t)
+
+	senderReader, receiverWriter := io.Pipe()
+	receiverReader, senderWriter := io.Pipe()
+	var writer io.Writer = senderWriter
+	if corruptPos > 0 {
+		writer = &corruptWriter{writer: senderWriter, pos: corruptPos}
+	}
+
+	var sendProgress, recvProgress zmodemTestProgress
+	sender := newZmodemSender(senderReader, writer, &sendProgress)
+	sender.resume = resume
+	receiver := newZmodemReceiver(receiverReader, receiverWriter, dstPath, &recvProgress)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- receiver.run()
+		_ = receiverReader.Close()
+		_ = receiverWriter.Close()
+	}()
+	go func() {
+		errs <- sender.run(files)
+		_ = senderReader.Close()
+		_ = senderWriter.Close()
+	}()
+	for range 2 {
+		select {
+		case err := <-errs:
+			require.Nil(err)
+		case <-time.After(30 * time.Second):
+			require.FailNow("zmodem transfer timeout")
+		}
+	}
+	return &sendProgress, &recvProgress
+}
+
+func TestParseZmodemFileInfo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	info, err := parseZmodemFileInfo([]byte("a.txt\x0012345 14533462721 100644 0 3 20000\x00"))
+	require.Nil(err)
+	assert.Equal("a.txt", info.name)
+	assert.Equal(int64(12345), info.size)
+	assert.Equal(int64(0o14533462721), info.modTime)
+	assert.Equal(os.FileMode(0644), info.mode)
+	assert.True(info.hasPending)
+	assert.Equal(int64(3), info.filesLeft)
+	assert.Equal(int64(20000), info.bytesLeft)
+
+	info, err = parseZmodemFileInfo([]byte("b.txt\x00\x00"))
+	require.Nil(err)
+	assert.Equal("b.txt", info.name)
+	assert.Equal(int64(-1), info.size)
+	assert.False(info.hasPending)
+
+	_, err = parseZmodemFileInfo([]byte("\x00123"))
+	assert.NotNil(err)
+	_, err = parseZmodemFileInfo([]byte("c.txt"))
+	assert.NotNil(err)
+
+	assert.Equal("a.txt", getZmodemFileName("a.txt"))
+	assert.Equal("a.txt", getZmodemFileName("/tmp/a.txt"))
+	assert.Equal("a.txt", getZmodemFileName("../../a.txt"))
+	assert.Equal("a.txt", getZmodemFileName("C:\\tmp\\a.txt"))
+	assert.Equal("", getZmodemFileName(".."))
+	assert.Equal("", getZmodemFileName("/"))
+}
+
+func TestZmodemTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	binary := make([]byte, 100*1024)
+	for i := range binary {
+		binary[i] = byte(i * 7)
+	}
+	contents := map[string][]byte{
+		"empty.txt":  {},
+		"small.txt":  []byte("hello zmodem\r\n"),
+		"binary.bin": binary,
+	}
+	var files []string
+	var total int64
+	for _, name := range []string{"empty.txt", "small.txt", "binary.bin"} {
+		path := filepath.Join(srcPath, name)
+		require.Nil(os.WriteFile(path, contents[name], 0640))
+		modTime := time.Unix(1700000000, 0)
+		require.Nil(os.Chtimes(path, modTime, modTime))
+		files = append(files, path)
+		total += int64(len(contents[name]))
+	}
+	require.Nil(os.WriteFile(filepath.Join(dstPath, "small.txt"), []byte("existing"), 0644))
+
+	sendProgress, recvProgress := runZmodemTransfer(t, files, dstPath, 0, false)
+
+	assertFileEqual(t, filepath.Join(srcPath, "empty.txt"), filepath.Join(dstPath, "empty.txt"))
+	assertFileEqual(t, filepath.Join(srcPath, "small.txt"), filepath.Join(dstPath, "small.txt.0"))
+	assertFileEqual(t, filepath.Join(srcPath, "binary.bin"), filepath.Join(dstPath, "binary.bin"))
+	existing, err := os.ReadFile(filepath.Join(dstPath, "small.txt"))
+	require.Nil(err)
+	assert.Equal("existing", string(existing))
+	stat, err := os.Stat(filepath.Join(dstPath, "binary.bin"))
+	require.Nil(err)
+	assert.Equal(int64(1700000000), stat.ModTime().Unix())
+	if !isRunningOnWindows() {
+		assert.Equal(os.FileMode(0640), stat.Mode().Perm())
+	}
+
+	for _, progress := range []*zmodemTestProgress{sendProgress, recvProgress} {
+		assert.Equal(int64(3), progress.num)
+		assert.Equal(total, progress.total)
+		assert.Equal([]string{"empty.txt", "small.txt", "binary.bin"}, progress.names)
+		assert.Equal([]int64{0, int64(len(contents["small.txt"])), int64(len(binary))}, progress.sizes)
+		assert.Equal(int64(len(binary)), progress.step)
+		assert.Equal(3, progress.done)
+	}
+}
+
+func TestZmodemResumeAndRecover(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	testPath, err := os.MkdirTemp("", "trzsz_test_")
+	require.Nil(err)
+	defer func() { _ = os.RemoveAll(testPath) }()
+	srcPath := filepath.Join(testPath, "src")
+	dstPath := filepath.Join(testPath, "dst")
+	require.Nil(os.MkdirAll(srcPath, 0755))
+	require.Nil(os.MkdirAll(dstPath, 0755))
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	require.Nil(os.WriteFile(filepath.Join(srcPath, "file.bin"), content, 0644))
+	files := []string{filepath.Join(srcPath, "file.bin")}
+
+	// the partial file is not resumed unless the sender asks for it
+	partPath := getPartialFilePath(filepath.Join(dstPath, "file.bin"))
+	require.Nil(os.WriteFile(partPath, []byte("stale data"), 0644))
+	_, recvProgress := runZmodemTransfer(t, files, dstPath, 0, false)
+	assertFileEqual(t, filepath.Join(srcPath, "file.bin"), filepath.Join(dstPath, "file.bin"))
+	assert.Equal(int64(0), recvProgress.preSize)
+	require.Nil(os.Remove(filepath.Join(dstPath, "file.bin")))
+
+	// resume from the partial file left by an interrupted transfer
+	offset := int64(300000)
+	require.Nil(os.WriteFile(partPath, content[:offset], 0644))
+	sendProgress, recvProgress := runZmodemTransfer(t, files, dstPath, 0, true)
+	assertFileEqual(t, filepath.Join(srcPath, "file.bin"), filepath.Join(dstPath, "file.bin"))
+	for _, progress := range []*zmodemTestProgress{sendProgress, recvProgress} {
+		assert.Equal(offset, progress.preSize)
+		assert.Equal([]int64{int64(len(content)) - offset}, progress.sizes)
+		assert.Equal(int64(len(content))-offset, progress.step)
+	}
+
+	// the corrupted data is sent again from the position of ZRPOS
+	require.Nil(os.Remove(filepath.Join(dstPath, "file.bin")))
+	_, recvProgress = runZmodemTransfer(t, files, dstPath, 500000, false)
+	assertFileEqual(t, filepath.Join(srcPath, "file.bin"), filepath.Join(dstPath, "file.bin"))
+	assert.Equal(int64(len(content)), recvProgress.step)
+	_, err = os.Stat(getPartialFilePath(filepath.Join(dstPath, "file.bin")))
+	assert.True(os.IsNotExist(err))
+}